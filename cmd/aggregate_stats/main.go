@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"kyouen-server/internal/config"
+	"kyouen-server/internal/datastore"
+	"kyouen-server/internal/statics"
+)
+
+func main() {
+	ctx := context.Background()
+	cfg := config.Load()
+
+	datastoreService, err := datastore.NewDatastoreService(cfg.ProjectID)
+	if err != nil {
+		log.Fatalf("Failed to initialize Datastore service: %v", err)
+	}
+	defer datastoreService.Close()
+
+	log.Printf("Aggregating statistics")
+
+	result, err := statics.Aggregate(ctx, datastoreService, time.Now())
+	if err != nil {
+		log.Fatalf("Failed to aggregate statistics: %v", err)
+	}
+
+	log.Printf("Aggregated %d stages, %d clears by %d players over %d days",
+		result.Summary.StageCount, result.Summary.TotalClears, result.Summary.Players, result.Days)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"kyouen-server/internal/datastore"
+	"kyouen-server/internal/stage"
+)
+
+func main() {
+	apply := flag.Bool("apply", false, "true にすると Datastore に書き込む（未指定時は dry-run）")
+	flag.Parse()
+
+	projectID := os.Getenv("GOOGLE_CLOUD_PROJECT")
+	if projectID == "" {
+		projectID = "my-android-server"
+		log.Printf("GOOGLE_CLOUD_PROJECT が未設定のためデフォルトを使用: %s", projectID)
+	}
+
+	svc, err := datastore.NewDatastoreService(projectID)
+	if err != nil {
+		log.Fatalf("Datastore 接続に失敗: %v", err)
+	}
+	defer svc.Close()
+
+	ctx := context.Background()
+	stageService := stage.NewService(svc, nil)
+
+	fmt.Printf("接続先プロジェクト: %s\n", projectID)
+	if !*apply {
+		fmt.Println("dry-run モードです。書き込むには -apply を指定してください。")
+	}
+
+	userKeys, err := svc.GetAllUserKeys(ctx)
+	if err != nil {
+		log.Fatalf("ユーザー一覧の取得に失敗: %v", err)
+	}
+	fmt.Printf("対象ユーザー: %d 人\n", len(userKeys))
+
+	var usersUnlocked, badgesUnlocked, failed int
+	for _, userKey := range userKeys {
+		user, err := svc.GetUserByKey(ctx, userKey)
+		if err != nil {
+			fmt.Printf("Warning: ユーザーの取得に失敗（%s）: %v\n", userKey.Name, err)
+			failed++
+			continue
+		}
+
+		result, err := stageService.RefreshAchievements(ctx, user, userKey, !*apply)
+		if err != nil {
+			fmt.Printf("Warning: 実績の計算に失敗（%s）: %v\n", userKey.Name, err)
+			failed++
+			continue
+		}
+		if len(result.Unlocked) == 0 {
+			continue
+		}
+
+		usersUnlocked++
+		badgesUnlocked += len(result.Unlocked)
+		badges := make([]string, len(result.Unlocked))
+		for i, a := range result.Unlocked {
+			badges[i] = a.Badge
+		}
+		fmt.Printf("uid=%s screenName=%s 新規バッジ=%v\n", user.UserID, user.ScreenName, badges)
+	}
+
+	fmt.Println("---")
+	fmt.Printf("新規バッジ: %d 個（%d 人）, 失敗: %d 人\n", badgesUnlocked, usersUnlocked, failed)
+	if !*apply && badgesUnlocked > 0 {
+		fmt.Println("内容を確認後、-apply を指定して再実行してください。")
+	}
+}
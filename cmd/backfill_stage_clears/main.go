@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"kyouen-server/internal/datastore"
+)
+
+func main() {
+	apply := flag.Bool("apply", false, "true にすると Datastore に書き込む（未指定時は dry-run）")
+	concurrency := flag.Int("concurrency", 8, "同時に更新するステージ数")
+	flag.Parse()
+
+	projectID := os.Getenv("GOOGLE_CLOUD_PROJECT")
+	if projectID == "" {
+		projectID = "my-android-server"
+		log.Printf("GOOGLE_CLOUD_PROJECT が未設定のためデフォルトを使用: %s", projectID)
+	}
+
+	svc, err := datastore.NewDatastoreService(projectID)
+	if err != nil {
+		log.Fatalf("Datastore 接続に失敗: %v", err)
+	}
+	defer svc.Close()
+
+	fmt.Printf("接続先プロジェクト: %s\n", projectID)
+	if !*apply {
+		fmt.Println("dry-run モードです。書き込むには -apply を指定してください。")
+	}
+
+	result, err := svc.BackfillStageClears(context.Background(), !*apply, *concurrency)
+	if result != nil {
+		for _, m := range result.Mismatches {
+			fmt.Printf("Warning: クリア数が一致しません（ステージ %d）: カウンタ=%d, StageUser=%d\n", m.StageNo, m.Counter, m.Records)
+		}
+		fmt.Println("---")
+		fmt.Printf("ステージ: %d 件, クリア記録: %d 件\n", result.Stages, result.Clears)
+		fmt.Printf("初期化したクリア数カウンタ: %d 件, 不一致: %d 件\n", result.CountersSeeded, len(result.Mismatches))
+		fmt.Printf("設定した最初のクリア: %d 件, 失敗: %d 件\n", result.FirstClearsSet, result.FirstClearsFail)
+	}
+	if err != nil {
+		log.Fatalf("バックフィルに失敗: %v", err)
+	}
+	if !*apply && (result.CountersSeeded > 0 || result.FirstClearsSet > 0) {
+		fmt.Println("内容を確認後、-apply を指定して再実行してください。")
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"time"
+
+	"kyouen-server/internal/config"
+	"kyouen-server/internal/datastore"
+	"kyouen-server/internal/stage"
+)
+
+func main() {
+	date := flag.String("date", "", "stage of the day to select (YYYY-MM-DD, JST). Defaults to the day starting at the upcoming midnight JST, or today")
+	flag.Parse()
+
+	ctx := context.Background()
+	cfg := config.Load()
+
+	if *date == "" {
+		*date = stage.DailySelectionDate(time.Now())
+	}
+
+	datastoreService, err := datastore.NewDatastoreService(cfg.ProjectID)
+	if err != nil {
+		log.Fatalf("Failed to initialize Datastore service: %v", err)
+	}
+	defer datastoreService.Close()
+
+	firebaseService, err := datastore.NewFirebaseService(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize Firebase service: %v", err)
+	}
+
+	// The selection does not need a token verifier
+	stageService := stage.NewService(datastoreService, nil)
+
+	challenge, created, err := stageService.SelectDailyChallenge(ctx, *date)
+	if err != nil {
+		log.Fatalf("Failed to select daily challenge for %s: %v", *date, err)
+	}
+	if created {
+		log.Printf("Selected stage %d as daily challenge for %s", challenge.StageNo, challenge.Date)
+	} else {
+		log.Printf("Daily challenge for %s is already stage %d", challenge.Date, challenge.StageNo)
+	}
+
+	if challenge.Notified {
+		log.Printf("Daily challenge for %s was already notified, skipping notification", challenge.Date)
+		return
+	}
+
+	log.Printf("Sending push notification to topic: %s", datastore.DailyChallengeTopic)
+
+	if err := firebaseService.SendDailyChallengeNotification(ctx, challenge.Date, challenge.StageNo); err != nil {
+		log.Fatalf("Failed to send notification: %v", err)
+	}
+	if err := datastoreService.MarkDailyChallengeNotified(ctx, challenge.Date); err != nil {
+		log.Fatalf("Notification sent, but failed to mark daily challenge as notified: %v", err)
+	}
+
+	log.Printf("Push notification sent successfully")
+}
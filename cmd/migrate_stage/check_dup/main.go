@@ -9,19 +9,12 @@ import (
 	"time"
 
 	"cloud.google.com/go/datastore"
+	datastoreservice "kyouen-server/internal/datastore"
 	"kyouen-server/pkg/models"
 )
 
 const productionProjectID = "my-android-server"
 
-type KyouenPuzzle struct {
-	StageNo    int64     `datastore:"stageNo"`
-	Size       int64     `datastore:"size"`
-	Stage      string    `datastore:"stage"`
-	Creator    string    `datastore:"creator"`
-	RegistDate time.Time `datastore:"registDate"`
-}
-
 type PaddedStageRecord struct {
 	StageNo       int64     `json:"stageNo"`
 	Size          int64     `json:"size"`
@@ -102,7 +95,7 @@ func main() {
 
 	log.Println("本番Datastoreからステージデータを取得中...")
 
-	var allStages []KyouenPuzzle
+	var allStages []datastoreservice.KyouenPuzzle
 	query := datastore.NewQuery("KyouenPuzzle").Order("stageNo")
 	_, err = client.GetAll(ctx, query, &allStages)
 	if err != nil {
@@ -124,7 +117,11 @@ func main() {
 	var duplicates []DuplicateResult
 
 	for _, record := range migratedRecords {
-		stage := models.NewKyouenStage(int(record.Size), record.TrimmedStage)
+		stage, err := models.ParseStage(int(record.Size), record.TrimmedStage)
+		if err != nil {
+			log.Printf("StageNo=%d: 不正なステージのためスキップします: %v\n", record.StageNo, err)
+			continue
+		}
 		variants := allVariants(*stage)
 
 		for _, v := range variants {
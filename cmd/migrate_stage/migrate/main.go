@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -10,18 +11,12 @@ import (
 	"time"
 
 	"cloud.google.com/go/datastore"
+	datastoreservice "kyouen-server/internal/datastore"
+	"kyouen-server/pkg/models"
 )
 
 const productionProjectID = "my-android-server"
 
-type KyouenPuzzle struct {
-	StageNo    int64     `datastore:"stageNo"`
-	Size       int64     `datastore:"size"`
-	Stage      string    `datastore:"stage"`
-	Creator    string    `datastore:"creator"`
-	RegistDate time.Time `datastore:"registDate"`
-}
-
 type PaddedStageRecord struct {
 	StageNo       int64     `json:"stageNo"`
 	Size          int64     `json:"size"`
@@ -54,7 +49,7 @@ func main() {
 
 	log.Println("本番Datastoreからステージデータを取得中...")
 
-	var allStages []KyouenPuzzle
+	var allStages []datastoreservice.KyouenPuzzle
 	var allKeys []*datastore.Key
 	query := datastore.NewQuery("KyouenPuzzle").Order("stageNo")
 	allKeys, err = client.GetAll(ctx, query, &allStages)
@@ -67,25 +62,28 @@ func main() {
 	// 補正対象の抽出
 	type target struct {
 		key   *datastore.Key
-		stage KyouenPuzzle
+		stage datastoreservice.KyouenPuzzle
 	}
 	var targets []target
 	var records []PaddedStageRecord
 
 	for i, s := range allStages {
-		if s.Size <= 0 {
-			continue
-		}
-		expectedLen := int(s.Size * s.Size)
-		if len(s.Stage) <= expectedLen {
+		_, err := models.ParseStage(int(s.Size), s.Stage)
+		var lengthErr *models.StageLengthError
+		if !errors.As(err, &lengthErr) || lengthErr.Length <= lengthErr.Size*lengthErr.Size {
 			continue
 		}
+		expectedLen := lengthErr.Size * lengthErr.Size
 		padding := s.Stage[expectedLen:]
 		if strings.Count(padding, "0") != len(padding) {
 			continue
 		}
 		// ゼロパディングパターン
 		trimmed := s.Stage[:expectedLen]
+		if _, err := models.ParseStage(int(s.Size), trimmed); err != nil {
+			log.Printf("StageNo=%d: 補正後も不正なためスキップします: %v\n", s.StageNo, err)
+			continue
+		}
 		records = append(records, PaddedStageRecord{
 			StageNo:       s.StageNo,
 			Size:          s.Size,
@@ -136,7 +134,7 @@ func main() {
 		}
 
 		keys := make([]*datastore.Key, len(batch))
-		stages := make([]*KyouenPuzzle, len(batch))
+		stages := make([]*datastoreservice.KyouenPuzzle, len(batch))
 		for j, t := range batch {
 			keys[j] = t.key
 			s := t.stage
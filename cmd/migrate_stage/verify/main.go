@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -10,19 +11,12 @@ import (
 	"time"
 
 	"cloud.google.com/go/datastore"
+	datastoreservice "kyouen-server/internal/datastore"
 	"kyouen-server/pkg/models"
 )
 
 const productionProjectID = "my-android-server"
 
-type KyouenPuzzle struct {
-	StageNo    int64     `datastore:"stageNo"`
-	Size       int64     `datastore:"size"`
-	Stage      string    `datastore:"stage"`
-	Creator    string    `datastore:"creator"`
-	RegistDate time.Time `datastore:"registDate"`
-}
-
 type PaddedStageRecord struct {
 	StageNo      int64     `json:"stageNo"`
 	Size         int64     `json:"size"`
@@ -60,7 +54,7 @@ func main() {
 
 	log.Println("本番Datastoreからステージデータを取得中...")
 
-	var allStages []KyouenPuzzle
+	var allStages []datastoreservice.KyouenPuzzle
 	query := datastore.NewQuery("KyouenPuzzle").Order("stageNo")
 	_, err = client.GetAll(ctx, query, &allStages)
 	if err != nil {
@@ -178,7 +172,7 @@ func main() {
 	}
 }
 
-func validateStage(stage KyouenPuzzle) ValidationResult {
+func validateStage(stage datastoreservice.KyouenPuzzle) ValidationResult {
 	result := ValidationResult{
 		StageNo:    stage.StageNo,
 		Size:       stage.Size,
@@ -187,15 +181,12 @@ func validateStage(stage KyouenPuzzle) ValidationResult {
 		RegistDate: stage.RegistDate,
 	}
 
-	if stage.Size <= 0 {
-		result.Errors = append(result.Errors, fmt.Sprintf("sizeが不正: %d", stage.Size))
-		return result
-	}
-
-	expectedLen := int(stage.Size * stage.Size)
-	actualLen := len(stage.Stage)
-
-	if actualLen > expectedLen {
+	// 文字列長の不正のうち、末尾のゼロパディングは補正対象として分類する
+	_, err := models.ParseStage(int(stage.Size), stage.Stage)
+	var lengthErr *models.StageLengthError
+	if errors.As(err, &lengthErr) && lengthErr.Length > lengthErr.Size*lengthErr.Size {
+		expectedLen := lengthErr.Size * lengthErr.Size
+		actualLen := lengthErr.Length
 		padding := stage.Stage[expectedLen:]
 		if strings.Count(padding, "0") == len(padding) {
 			result.PaddedZero = true
@@ -222,11 +213,6 @@ func validateStage(stage KyouenPuzzle) ValidationResult {
 		return result
 	}
 
-	if actualLen < expectedLen {
-		result.Errors = append(result.Errors, fmt.Sprintf("stage文字列長が不正: 期待=%d 実際=%d", expectedLen, actualLen))
-		return result
-	}
-
 	if errs := validateStageContent(stage.Stage, stage.Size); len(errs) > 0 {
 		result.Errors = append(result.Errors, errs...)
 	}
@@ -237,22 +223,18 @@ func validateStage(stage KyouenPuzzle) ValidationResult {
 func validateStageContent(stageStr string, size int64) []string {
 	var errs []string
 
-	for i, c := range stageStr {
-		if c != '0' && c != '1' && c != '2' {
-			errs = append(errs, fmt.Sprintf("不正な文字 %q がインデックス %d に存在", c, i))
-		}
-	}
-	if len(errs) > 0 {
+	kyouenStage, err := models.ParseStage(int(size), stageStr)
+	if err != nil {
+		errs = append(errs, fmt.Sprintf("ステージが不正: %v", err))
 		return errs
 	}
 
-	stoneCount := strings.Count(stageStr, "1")
+	stoneCount := kyouenStage.StoneCount()
 	if stoneCount < 5 {
 		errs = append(errs, fmt.Sprintf("石の数が不足: %d個 (最低5個必要)", stoneCount))
 		return errs
 	}
 
-	kyouenStage := models.NewKyouenStage(int(size), stageStr)
 	if kyouenStage.HasKyouen() == nil {
 		errs = append(errs, "有効な共円が存在しない")
 	}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"kyouen-server/internal/datastore"
+)
+
+func main() {
+	apply := flag.Bool("apply", false, "true にすると Datastore に書き込む（未指定時は dry-run）")
+	flag.Parse()
+
+	projectID := os.Getenv("GOOGLE_CLOUD_PROJECT")
+	if projectID == "" {
+		projectID = "my-android-server"
+		log.Printf("GOOGLE_CLOUD_PROJECT が未設定のためデフォルトを使用: %s", projectID)
+	}
+
+	svc, err := datastore.NewDatastoreService(projectID)
+	if err != nil {
+		log.Fatalf("Datastore 接続に失敗: %v", err)
+	}
+	defer svc.Close()
+
+	fmt.Printf("接続先プロジェクト: %s\n", projectID)
+	if *apply {
+		fmt.Println("モード: 実行（Datastore に書き込みます）")
+	} else {
+		fmt.Println("モード: dry-run（書き込みは行いません。-apply を指定すると実行されます）")
+	}
+	fmt.Println("---")
+
+	result, err := svc.RekeyStageUsers(context.Background(), !*apply)
+	if result != nil {
+		fmt.Printf("StageUser 読み込み件数: %d 件\n", result.Scanned)
+		fmt.Printf("（ステージ, ユーザー）の組: %d 組\n", result.Pairs)
+		fmt.Printf("決定的キーへの書き込み: %d 件\n", result.Rekeyed)
+		fmt.Printf("旧レコード・重複の削除: %d 件\n", result.Duplicates)
+		fmt.Printf("参照欠落によりスキップ: %d 件\n", result.Skipped)
+		fmt.Printf("clearStageCount の補正: %d ユーザー\n", result.UsersUpdated)
+	}
+	if err != nil {
+		log.Fatalf("StageUser のキー変換に失敗しました（再実行で続きから補正できます）: %v", err)
+	}
+
+	fmt.Println("---")
+	if !*apply {
+		fmt.Println("dry-run 完了。上記の変更は行われていません。")
+		return
+	}
+	fmt.Println("キー変換完了。再度 dry-run を実行し、書き込み・削除件数が 0 になっていることを確認してください。")
+}
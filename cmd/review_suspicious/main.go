@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"kyouen-server/internal/datastore"
+)
+
+func main() {
+	flagUID := flag.String("flag", "", "不正の疑いありとしてマークするユーザーの Firebase UID")
+	unflagUID := flag.String("unflag", "", "確認の結果、不正の疑いを解除するユーザーの Firebase UID")
+	apply := flag.Bool("apply", false, "true にすると Datastore に書き込む（未指定時は dry-run）")
+	flag.Parse()
+
+	if *flagUID != "" && *unflagUID != "" {
+		fmt.Fprintln(os.Stderr, "使用方法: review_suspicious [-flag=<UID> | -unflag=<UID>] [-apply]")
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+
+	projectID := os.Getenv("GOOGLE_CLOUD_PROJECT")
+	if projectID == "" {
+		projectID = "my-android-server"
+		log.Printf("GOOGLE_CLOUD_PROJECT が未設定のためデフォルトを使用: %s", projectID)
+	}
+
+	svc, err := datastore.NewDatastoreService(projectID)
+	if err != nil {
+		log.Fatalf("Datastore 接続に失敗: %v", err)
+	}
+	defer svc.Close()
+
+	ctx := context.Background()
+
+	fmt.Printf("接続先プロジェクト: %s\n", projectID)
+
+	switch {
+	case *flagUID != "":
+		review(ctx, svc, *flagUID, true, *apply)
+	case *unflagUID != "":
+		review(ctx, svc, *unflagUID, false, *apply)
+	default:
+		list(ctx, svc)
+	}
+}
+
+// list prints all users flagged as suspicious
+func list(ctx context.Context, svc *datastore.DatastoreService) {
+	users, err := svc.GetSuspiciousUsers(ctx)
+	if err != nil {
+		log.Fatalf("不正の疑いがあるユーザーの取得に失敗: %v", err)
+	}
+
+	fmt.Printf("不正の疑いがあるユーザー: %d 人\n", len(users))
+	fmt.Println("---")
+	for _, u := range users {
+		fmt.Printf("uid=%s screenName=%s reason=%s flaggedAt=%s clearStageCount=%d\n",
+			u.UserID, u.ScreenName, u.SuspiciousReason, u.FlaggedAt.Format(time.RFC3339), u.ClearStageCount)
+	}
+	if len(users) > 0 {
+		fmt.Println("---")
+		fmt.Println("確認後、誤検知であれば -unflag=<UID> -apply で解除してください。")
+	}
+}
+
+// review sets or clears the suspicious flag of a user
+func review(ctx context.Context, svc *datastore.DatastoreService, uid string, suspicious, apply bool) {
+	user, userKey, err := svc.GetUserByID(ctx, uid)
+	if err != nil {
+		log.Fatalf("ユーザーが見つかりません（%s）: %v", uid, err)
+	}
+	fmt.Printf("ユーザー: screenName=%s, clearStageCount=%d, suspicious=%t, reason=%s\n",
+		user.ScreenName, user.ClearStageCount, user.Suspicious, user.SuspiciousReason)
+
+	if user.Suspicious == suspicious {
+		fmt.Println("変更はありません。")
+		return
+	}
+	if !apply {
+		fmt.Println("dry-run 完了。-apply を指定すると変更を書き込みます。")
+		return
+	}
+
+	if suspicious {
+		if _, err := svc.FlagUser(ctx, userKey, datastore.SuspicionManual); err != nil {
+			log.Fatalf("マークに失敗: %v", err)
+		}
+		fmt.Println("不正の疑いありとしてマークしました。ランキング・アクティビティから除外されます。")
+		return
+	}
+	if err := svc.UnflagUser(ctx, userKey); err != nil {
+		log.Fatalf("解除に失敗: %v", err)
+	}
+	fmt.Println("不正の疑いを解除しました。")
+}
@@ -67,7 +67,10 @@ func createStage(ctx context.Context, datastoreService *datastore.DatastoreServi
 		return fmt.Errorf("invalid size: %s", seed.Size)
 	}
 
-	kyouenStage := models.NewKyouenStage(int(size), seed.Stage)
+	kyouenStage, err := models.ParseStage(int(size), seed.Stage)
+	if err != nil {
+		return err
+	}
 	if kyouenStage.StoneCount() <= 4 {
 		return fmt.Errorf("invalid stage: insufficient stones")
 	}
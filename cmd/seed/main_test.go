@@ -0,0 +1,40 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+
+	"kyouen-server/pkg/models"
+)
+
+func TestSeedStagesAreValid(t *testing.T) {
+	for _, seed := range seedData {
+		size, _ := strconv.Atoi(seed.Size)
+		stage, err := models.ParseStage(size, seed.Stage)
+		if err != nil {
+			t.Errorf("stage %s must be parsed. err = %v", seed.StageNo, err)
+			continue
+		}
+		if stage.StoneCount() <= 4 || stage.HasKyouen() == nil {
+			t.Errorf("stage %s must have 5 stones and a kyouen", seed.StageNo)
+		}
+	}
+}
+
+func TestSeedStagesCompactRoundTrip(t *testing.T) {
+	for _, seed := range seedData {
+		size, err := strconv.Atoi(seed.Size)
+		if err != nil {
+			t.Fatalf("stage %s has an invalid size %q", seed.StageNo, seed.Size)
+		}
+		encoded, err := models.EncodeCompactStage(size, seed.Stage)
+		if err != nil {
+			t.Errorf("stage %s must be encoded. err = %v", seed.StageNo, err)
+			continue
+		}
+		decodedSize, decoded, err := models.DecodeCompactStage(encoded)
+		if err != nil || decodedSize != size || decoded != seed.Stage {
+			t.Errorf("stage %s: %q must be decoded to %d %q. actual = %d %q, %v", seed.StageNo, encoded, size, seed.Stage, decodedSize, decoded, err)
+		}
+	}
+}
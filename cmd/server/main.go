@@ -12,6 +12,7 @@ import (
 	"kyouen-server/internal/auth"
 	"kyouen-server/internal/config"
 	"kyouen-server/internal/datastore"
+	"kyouen-server/internal/events"
 	"kyouen-server/internal/middleware"
 	"kyouen-server/internal/stage"
 	"kyouen-server/internal/statics"
@@ -22,12 +23,20 @@ type App struct {
 	Config           *config.Config
 	DatastoreService *datastore.DatastoreService
 	FirebaseService  *datastore.FirebaseService
+	TokenVerifier    auth.TokenVerifier
 }
 
 func main() {
 	ctx := context.Background()
 
 	cfg := config.Load()
+	if cfg.DeviceTokenSecret == "" {
+		// A per-process secret would reject device tokens issued by other instances or before a restart
+		if cfg.DeployEnvironment != "" {
+			log.Fatalf("DEVICE_TOKEN_SECRET is required on Cloud Run")
+		}
+		log.Printf("Warning: DEVICE_TOKEN_SECRET is not set, device tokens are only valid until the server restarts")
+	}
 
 	shutdown := tracing.Init(ctx, cfg.ProjectID)
 	defer shutdown()
@@ -37,16 +46,23 @@ func main() {
 		log.Fatalf("Failed to initialize Datastore service: %v", err)
 	}
 	defer datastoreService.Close()
+	datastoreService.SetClearEventLog(cfg.ClearEventLog)
 
 	firebaseService, err := datastore.NewFirebaseService(cfg)
 	if err != nil {
 		log.Fatalf("Failed to initialize Firebase service: %v", err)
 	}
 
+	tokenVerifier, err := auth.NewTokenVerifier(cfg.AuthConfig, firebaseService)
+	if err != nil {
+		log.Fatalf("Failed to initialize token verifier: %v", err)
+	}
+
 	app := &App{
 		Config:           cfg,
 		DatastoreService: datastoreService,
 		FirebaseService:  firebaseService,
+		TokenVerifier:    tokenVerifier,
 	}
 
 	gin.SetMode(cfg.Environment)
@@ -56,6 +72,7 @@ func main() {
 	log.Printf("Cloud Run Kyouen Server starting on port %s", cfg.Port)
 	log.Printf("Environment: %s", cfg.Environment)
 	log.Printf("Project ID: %s", cfg.ProjectID)
+	log.Printf("Auth mode: %s", cfg.AuthConfig.Mode)
 
 	if err := http.ListenAndServe(":"+cfg.Port, router); err != nil {
 		log.Fatalf("Failed to start server: %v", err)
@@ -64,12 +81,20 @@ func main() {
 
 func setupRouter(app *App) *gin.Engine {
 	router := gin.Default()
+	// Identify clients by the address appended by Google, not by a client-controlled X-Forwarded-For
+	trustedProxies := app.Config.RateLimit.TrustedProxies
+	if trustedProxies == nil {
+		trustedProxies = middleware.DefaultTrustedProxies
+	}
+	if err := router.SetTrustedProxies(trustedProxies); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
 
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"*"}, // In production, specify allowed origins
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", middleware.IdempotencyKeyHeader, auth.DeviceIDHeader, "Last-Event-ID", "If-None-Match", "If-Modified-Since"},
+		ExposeHeaders:    []string{"Content-Length", "Retry-After", middleware.IdempotentReplayedHeader, "X-Next-Cursor", "ETag", "Last-Modified"},
 		AllowCredentials: true,
 	}))
 
@@ -78,41 +103,110 @@ func setupRouter(app *App) *gin.Engine {
 	router.Use(gin.Recovery())
 
 	router.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{
+		health := gin.H{
 			"status":      "ok",
 			"version":     "2.0.0-cloudrun",
 			"service":     "kyouen-server",
 			"platform":    "Cloud Run + Datastore mode Firestore",
 			"description": "共円パズルゲーム API Server",
-		})
+		}
+		if cachingVerifier, ok := app.TokenVerifier.(*auth.CachingVerifier); ok {
+			health["authCache"] = cachingVerifier.Stats()
+		}
+		c.JSON(http.StatusOK, health)
 	})
 
 	router.StaticFile("/docs/specs/index.yaml", "./docs/specs/index.yaml")
 	router.StaticFile("/static/swagger-ui.html", "./static-files/swagger-ui.html")
 
-	stageHandler := stage.NewHandler(app.DatastoreService, app.FirebaseService)
+	stageHandler := stage.NewHandler(app.DatastoreService, app.TokenVerifier)
+	if app.Config.DeviceTokenSecret != "" {
+		stageHandler.SetDeviceTokenSecret(app.Config.DeviceTokenSecret)
+	}
+	antiCheat := stage.DefaultAntiCheatPolicy()
+	antiCheat.MinSolveTimeMs = app.Config.AntiCheat.MinSolveTimeMs
+	antiCheat.ClearRateLimit = app.Config.AntiCheat.ClearRateLimit
+	antiCheat.ClearRateWindow = app.Config.AntiCheat.ClearRateWindow
+	stageHandler.SetAntiCheatPolicy(antiCheat)
+	var broker events.Broker
+	if app.Config.ActivityStream.Broker == "datastore" {
+		broker = events.NewDatastoreBroker(app.DatastoreService.GetClient(), app.Config.ActivityStream.PollInterval)
+	}
+	eventBus := events.NewBus(broker, events.DefaultHistorySize)
+	eventBus.Start(context.Background())
+	stageHandler.SetActivityStream(eventBus, app.Config.ActivityStream.Heartbeat)
 	staticsHandler := statics.NewHandler(app.DatastoreService)
 
+	var rateLimitStore middleware.RateLimitStore = middleware.NewMemoryStore()
+	if app.Config.RateLimit.Store == "datastore" {
+		rateLimitStore = middleware.NewDatastoreStore(app.DatastoreService.GetClient())
+	}
+	rateLimit := func(name string, limit config.RouteLimit) gin.HandlerFunc {
+		return middleware.RateLimit(name, middleware.Limit{Requests: limit.Requests, Per: limit.Per}, rateLimitStore)
+	}
+
+	var idempotencyStore middleware.IdempotencyStore = middleware.NewDatastoreIdempotencyStore(app.DatastoreService.GetClient())
+	if app.Config.Idempotency.Store == "memory" {
+		idempotencyStore = middleware.NewMemoryIdempotencyStore()
+	}
+	idempotent := func(name string) gin.HandlerFunc {
+		return middleware.Idempotency(name, app.Config.Idempotency.TTL, idempotencyStore)
+	}
+
+	var responseCacheStore middleware.ResponseCacheStore = middleware.NewMemoryResponseCacheStore(app.Config.ResponseCache.MaxEntries)
+	if app.Config.ResponseCache.Store == "redis" {
+		responseCacheStore = middleware.NewRedisResponseCacheStore(app.Config.ResponseCache.RedisAddr, app.Config.ResponseCache.RedisPassword)
+	}
+	cached := func(name string) gin.HandlerFunc {
+		return middleware.ResponseCache(name, app.Config.ResponseCache.TTL, responseCacheStore)
+	}
+	// Clears change the clear counts of stage lists and the clear dates of the user; new stages also change the stage count
+	clearCaches := []string{"stages", "recent_stages"}
+	stageCaches := []string{"stages", "recent_stages", "statics"}
+	middleware.WatchResponseCacheInvalidation(context.Background(), eventBus, responseCacheStore, map[string][]string{
+		events.TypeClear: clearCaches,
+		events.TypeStage: stageCaches,
+	})
+	invalidates := func(names []string) gin.HandlerFunc {
+		return middleware.InvalidatesResponseCaches(responseCacheStore, names...)
+	}
+
 	v2 := router.Group("/v2")
 	{
-		v2.GET("/statics", staticsHandler.GetStatics)
+		v2.GET("/statics", cached("statics"), staticsHandler.GetStatics)
+		v2.GET("/statics/extended", staticsHandler.GetExtendedStatics)
 
-		v2.GET("/recent_stages", stageHandler.GetRecentStages)
+		v2.GET("/recent_stages", cached("recent_stages"), stageHandler.GetRecentStages)
 		v2.GET("/activities", stageHandler.GetActivities)
+		v2.GET("/activities/stream", stageHandler.StreamActivities)
+		v2.GET("/daily", stageHandler.GetDailyChallenge)
 
 		stages := v2.Group("/stages")
 		{
-			stages.GET("", auth.OptionalFirebaseAuth(app.FirebaseService), stageHandler.GetStages)
-			stages.POST("", stageHandler.CreateStage)
-			stages.POST("/sync", auth.FirebaseAuth(app.FirebaseService), stageHandler.SyncStages)
+			stages.GET("", auth.GuestOrFirebaseAuth(app.TokenVerifier), cached("stages"), stageHandler.GetStages)
+			stages.GET("/export", stageHandler.ExportStages)
+			stages.POST("", idempotent("create_stage"), rateLimit("create_stage", app.Config.RateLimit.CreateStage), invalidates(stageCaches), stageHandler.CreateStage)
+			stages.POST("/sync", auth.FirebaseAuth(app.TokenVerifier), rateLimit("sync", app.Config.RateLimit.Sync), invalidates(clearCaches), stageHandler.SyncStages)
 			// This endpoint accepts both authenticated and guest users
-			stages.PUT("/:stageNo/clear", auth.OptionalFirebaseAuth(app.FirebaseService), stageHandler.ClearStage)
+			stages.PUT("/:stageNo/clear", auth.GuestOrFirebaseAuth(app.TokenVerifier), idempotent("clear_stage"), rateLimit("clear_stage", app.Config.RateLimit.ClearStage), invalidates(clearCaches), stageHandler.ClearStage)
+			stages.GET("/:stageNo/stats", stageHandler.GetStageStats)
+		}
+
+		collections := v2.Group("/collections")
+		{
+			collections.GET("", auth.GuestOrFirebaseAuth(app.TokenVerifier), stageHandler.GetCollections)
+			collections.GET("/:collectionId", auth.GuestOrFirebaseAuth(app.TokenVerifier), stageHandler.GetCollection)
+			collections.PUT("/:collectionId", auth.FirebaseAuth(app.TokenVerifier), auth.RequireAdmin(), stageHandler.PutCollection)
+			collections.DELETE("/:collectionId", auth.FirebaseAuth(app.TokenVerifier), auth.RequireAdmin(), stageHandler.DeleteCollection)
 		}
 
 		users := v2.Group("/users")
 		{
-			users.POST("/login", stageHandler.Login)
-			users.DELETE("/delete-account", auth.FirebaseAuth(app.FirebaseService), stageHandler.DeleteAccount)
+			users.POST("/login", rateLimit("login", app.Config.RateLimit.Login), stageHandler.Login)
+			users.POST("/devices", stageHandler.IssueDeviceID)
+			users.GET("/me", auth.GuestOrFirebaseAuth(app.TokenVerifier), stageHandler.GetProfile)
+			users.POST("/link", auth.FirebaseAuth(app.TokenVerifier), stageHandler.LinkAccount)
+			users.DELETE("/delete-account", auth.FirebaseAuth(app.TokenVerifier), stageHandler.DeleteAccount)
 		}
 	}
 
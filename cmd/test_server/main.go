@@ -4,19 +4,27 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	
+	"kyouen-server/internal/auth"
 	"kyouen-server/internal/config"
 	"kyouen-server/internal/datastore"
+	"kyouen-server/internal/events"
 	"kyouen-server/internal/middleware"
+	"kyouen-server/internal/stage"
 	"kyouen-server/internal/statics"
 )
 
+// devSecret is the default HS256 key for the local token verifier
+const devSecret = "kyouen-test-server-secret"
+
 type App struct {
 	Config           *config.Config
 	DatastoreService *datastore.DatastoreService
+	TokenVerifier    *auth.LocalVerifier
 }
 
 func main() {
@@ -36,10 +44,40 @@ func main() {
 	}
 	defer datastoreService.Close()
 	
+	// Use locally signed JWTs instead of Firebase Authentication
+	secret := os.Getenv("LOCAL_AUTH_HMAC_SECRET")
+	if secret == "" {
+		secret = devSecret
+	}
+	tokenVerifier, err := auth.NewLocalVerifier(auth.LocalConfig{HMACSecret: []byte(secret)})
+	if err != nil {
+		log.Fatalf("Failed to initialize token verifier: %v", err)
+	}
+	
+	// Issue a token for manual testing of authenticated endpoints
+	devToken, err := tokenVerifier.SignHS256(map[string]interface{}{
+		"sub":  "test-user",
+		"name": "test_user",
+		"exp":  time.Now().Add(24 * time.Hour).Unix(),
+	})
+	if err != nil {
+		log.Fatalf("Failed to issue dev token: %v", err)
+	}
+	adminToken, err := tokenVerifier.SignHS256(map[string]interface{}{
+		"sub":           "test-admin",
+		"name":          "test_admin",
+		"exp":           time.Now().Add(24 * time.Hour).Unix(),
+		auth.AdminClaim: true,
+	})
+	if err != nil {
+		log.Fatalf("Failed to issue admin token: %v", err)
+	}
+	
 	// Create application instance
 	app := &App{
 		Config:           cfg,
 		DatastoreService: datastoreService,
+		TokenVerifier:    tokenVerifier,
 	}
 	
 	// Set Gin mode
@@ -55,10 +93,19 @@ func main() {
 	log.Println("Available endpoints:")
 	log.Println("  GET  /health")
 	log.Println("  GET  /v2/statics")
+	log.Println("  GET  /v2/statics/extended")
 	log.Println("  GET  /v2/stages")
 	log.Println("  POST /v2/stages")
-	log.Println("  POST /v2/stages/{stageNo}/clear")
+	log.Println("  POST /v2/stages/sync")
+	log.Println("  PUT  /v2/stages/{stageNo}/clear")
 	log.Println("  POST /v2/users/login")
+	log.Println("  GET  /v2/users/me")
+	log.Println("  DELETE /v2/users/delete-account")
+	log.Println("  GET  /v2/collections")
+	log.Println("  GET  /v2/activities/stream")
+	log.Println("  PUT  /v2/collections/{collectionId} (admin)")
+	log.Printf("Dev token (uid=test-user): %s", devToken)
+	log.Printf("Admin token (uid=test-admin): %s", adminToken)
 	
 	if err := http.ListenAndServe(":"+cfg.Port, router); err != nil {
 		log.Fatalf("Failed to start server: %v", err)
@@ -73,7 +120,7 @@ func setupRouter(app *App) *gin.Engine {
 		AllowOrigins:     []string{"*"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
 		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		ExposeHeaders:    []string{"Content-Length", "X-Next-Cursor"},
 		AllowCredentials: true,
 	}))
 	
@@ -89,34 +136,54 @@ func setupRouter(app *App) *gin.Engine {
 			"status":    "ok",
 			"message":   "Cloud Run + Firestore migration test server",
 			"version":   "2.0.0-alpha",
-			"endpoints": []string{"/health", "/v2/statics", "/v2/stages", "/v2/users/login"},
+			"endpoints": []string{"/health", "/v2/statics", "/v2/stages", "/v2/users/login", "/v2/users/delete-account"},
 		})
 	})
 	
 	// Initialize handlers
 	staticsHandler := statics.NewHandler(app.DatastoreService)
+	stageHandler := stage.NewHandler(app.DatastoreService, app.TokenVerifier)
+	stageHandler.SetActivityStream(events.NewBus(nil, events.DefaultHistorySize), 15*time.Second)
 	
 	// API v2 routes
 	v2 := router.Group("/v2")
 	{
 		// Statistics endpoint
 		v2.GET("/statics", staticsHandler.GetStatics)
+		v2.GET("/statics/extended", staticsHandler.GetExtendedStatics)
+		v2.GET("/daily", stageHandler.GetDailyChallenge)
+		v2.GET("/activities/stream", stageHandler.StreamActivities)
 		
-		// Note: Stages endpoints are disabled in test server for simplicity
-		// They would require Firebase authentication setup
+		// Stages endpoints authenticate with locally signed tokens
+		stages := v2.Group("/stages")
+		{
+			stages.GET("", auth.GuestOrFirebaseAuth(app.TokenVerifier), stageHandler.GetStages)
+			stages.GET("/export", stageHandler.ExportStages)
+			stages.POST("", stageHandler.CreateStage)
+			stages.POST("/sync", auth.FirebaseAuth(app.TokenVerifier), stageHandler.SyncStages)
+			stages.PUT("/:stageNo/clear", auth.GuestOrFirebaseAuth(app.TokenVerifier), stageHandler.ClearStage)
+			stages.GET("/:stageNo/stats", stageHandler.GetStageStats)
+		}
+
 		
-		// Users endpoints (test login without Firebase)
+		collections := v2.Group("/collections")
+		{
+			collections.GET("", auth.GuestOrFirebaseAuth(app.TokenVerifier), stageHandler.GetCollections)
+			collections.GET("/:collectionId", auth.GuestOrFirebaseAuth(app.TokenVerifier), stageHandler.GetCollection)
+			collections.PUT("/:collectionId", auth.FirebaseAuth(app.TokenVerifier), auth.RequireAdmin(), stageHandler.PutCollection)
+			collections.DELETE("/:collectionId", auth.FirebaseAuth(app.TokenVerifier), auth.RequireAdmin(), stageHandler.DeleteCollection)
+		}
+		
+		// Users endpoints
 		users := v2.Group("/users")
 		{
-			users.POST("/login", func(c *gin.Context) {
-				c.JSON(http.StatusOK, gin.H{
-					"screenName": "test_user",
-					"token":      "test_token",
-					"message":    "Test login - Firebase auth disabled",
-				})
-			})
+			users.POST("/login", stageHandler.Login)
+			users.POST("/devices", stageHandler.IssueDeviceID)
+			users.GET("/me", auth.GuestOrFirebaseAuth(app.TokenVerifier), stageHandler.GetProfile)
+			users.POST("/link", auth.FirebaseAuth(app.TokenVerifier), stageHandler.LinkAccount)
+			users.DELETE("/delete-account", auth.FirebaseAuth(app.TokenVerifier), stageHandler.DeleteAccount)
 		}
 	}
 	
 	return router
-}
\ No newline at end of file
+}
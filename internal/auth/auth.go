@@ -2,11 +2,14 @@ package auth
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"net/http"
 	"strings"
 
-	"kyouen-server/internal/datastore"
+	"kyouen-server/internal/problem"
 
 	"github.com/gin-gonic/gin"
 )
@@ -18,15 +21,53 @@ const (
 	AuthUIDKey = "auth_uid"
 	// GuestUID is the special UID used for guest account (matches existing production data)
 	GuestUID = "0"
+	// DeviceIDHeader carries a server-issued device ID identifying a per-device anonymous player
+	DeviceIDHeader = "X-Device-ID"
+	// AnonymousUIDPrefix prefixes the UID of per-device anonymous users
+	AnonymousUIDPrefix = "device-"
+	// AdminClaim is the custom claim granting access to administrative endpoints
+	// (set with the Firebase Admin SDK, e.g. SetCustomUserClaims(uid, {"admin": true}))
+	AdminClaim = "admin"
 )
 
+// Reasons reported when a request fails authentication
+const (
+	ReasonMissing   = "missing"
+	ReasonMalformed = "malformed"
+	ReasonExpired   = "expired"
+	ReasonRevoked   = "revoked"
+	ReasonInvalid   = "invalid"
+	ReasonInternal  = "internal"
+)
+
+// Problem types of authentication. The codes are part of the API and must not change.
+var (
+	ProblemInvalidToken    = problem.Type{Status: http.StatusUnauthorized, Code: "INVALID_TOKEN", Title: "Invalid Firebase ID token"}
+	ProblemInvalidDeviceID = problem.Type{Status: http.StatusBadRequest, Code: "INVALID_DEVICE_ID", Title: "Invalid device ID"}
+	problemMalformedToken  = problem.Type{Status: http.StatusUnauthorized, Code: "MALFORMED_TOKEN", Title: "Malformed ID token"}
+	problemTokenExpired    = problem.Type{Status: http.StatusUnauthorized, Code: "TOKEN_EXPIRED", Title: "ID token has expired"}
+	problemTokenRevoked    = problem.Type{Status: http.StatusUnauthorized, Code: "TOKEN_REVOKED", Title: "ID token has been revoked"}
+	problemAdminRequired   = problem.Type{Status: http.StatusForbidden, Code: "ADMIN_REQUIRED", Title: "Administrator privileges required"}
+)
+
+// reasonProblems is the problem type of each authentication failure reason other than ReasonInternal
+var reasonProblems = map[string]problem.Type{
+	ReasonMissing:   problem.AuthenticationRequired,
+	ReasonMalformed: problemMalformedToken,
+	ReasonExpired:   problemTokenExpired,
+	ReasonRevoked:   problemTokenRevoked,
+	ReasonInvalid:   ProblemInvalidToken,
+}
+
 // AuthenticatedUser represents the authenticated user information
 type AuthenticatedUser struct {
 	UID        string
 	Email      string
 	Name       string
 	Picture    string
-	TwitterUID string // Twitter User ID from custom claims
+	TwitterUID string   // Twitter User ID from custom claims
+	Providers  []string // IDs of the sign-in providers linked to the account
+	Admin      bool     // true if the token carries the admin custom claim
 }
 
 // AuthResult represents the result of authentication attempt
@@ -35,54 +76,56 @@ type AuthResult struct {
 	User    *AuthenticatedUser
 	UID     string
 	Error   error
+	Reason  string // machine-readable failure reason (one of the Reason* constants)
 }
 
-// authenticateToken performs Firebase token authentication
-func authenticateToken(firebaseService *datastore.FirebaseService, authHeader string) *AuthResult {
+// authenticateToken performs ID token authentication with the given verifier
+func authenticateToken(ctx context.Context, verifier TokenVerifier, authHeader string) *AuthResult {
 	if authHeader == "" {
-		return &AuthResult{Success: false, Error: errors.New("authorization header is required")}
+		return &AuthResult{Success: false, Error: errors.New("authorization header is required"), Reason: ReasonMissing}
 	}
 
 	// Check Bearer token format
 	parts := strings.SplitN(authHeader, " ", 2)
 	if len(parts) != 2 || parts[0] != "Bearer" {
-		return &AuthResult{Success: false, Error: errors.New("authorization header must be Bearer token")}
+		return &AuthResult{Success: false, Error: errors.New("authorization header must be Bearer token"), Reason: ReasonMalformed}
 	}
 
 	idToken := parts[1]
-
-	// Verify Firebase ID token
-	ctx := context.Background()
-	token, err := firebaseService.VerifyIDToken(ctx, idToken)
-	if err != nil {
-		return &AuthResult{Success: false, Error: errors.New("invalid Firebase ID token")}
+	if strings.Count(idToken, ".") != 2 {
+		return &AuthResult{Success: false, Error: errors.New("malformed ID token"), Reason: ReasonMalformed}
 	}
 
-	// Get user information from Firebase Auth
-	userRecord, err := firebaseService.GetUserByUID(ctx, token.UID)
+	// Verify ID token
+	token, err := verifier.VerifyIDToken(ctx, idToken)
 	if err != nil {
-		return &AuthResult{Success: false, Error: errors.New("failed to get user information")}
+		switch {
+		case errors.Is(err, ErrTokenExpired):
+			return &AuthResult{Success: false, Error: errors.New("ID token has expired"), Reason: ReasonExpired}
+		case errors.Is(err, ErrTokenRevoked):
+			return &AuthResult{Success: false, Error: errors.New("ID token has been revoked"), Reason: ReasonRevoked}
+		case errors.Is(err, ErrTokenMalformed):
+			return &AuthResult{Success: false, Error: errors.New("malformed ID token"), Reason: ReasonMalformed}
+		}
+		return &AuthResult{Success: false, Error: errors.New("invalid Firebase ID token"), Reason: ReasonInvalid}
 	}
 
-	// Extract Twitter UID from custom claims (if available)
-	twitterUID := ""
-	if claims, ok := token.Claims["firebase"].(map[string]interface{}); ok {
-		if identities, ok := claims["identities"].(map[string]interface{}); ok {
-			if twitterIds, ok := identities["twitter.com"].([]interface{}); ok && len(twitterIds) > 0 {
-				if twitterID, ok := twitterIds[0].(string); ok {
-					twitterUID = twitterID
-				}
-			}
-		}
+	// Get user information from the identity provider
+	userRecord, err := verifier.GetUser(ctx, token.UID)
+	if err != nil {
+		return &AuthResult{Success: false, Error: fmt.Errorf("failed to get user information: %w", err), Reason: ReasonInternal}
 	}
 
 	// Create authenticated user object
+	profile := ExtractProfile(token, userRecord)
 	authUser := &AuthenticatedUser{
 		UID:        token.UID,
 		Email:      userRecord.Email,
-		Name:       userRecord.DisplayName,
-		Picture:    userRecord.PhotoURL,
-		TwitterUID: twitterUID,
+		Name:       profile.ScreenName,
+		Picture:    profile.Image,
+		TwitterUID: profile.TwitterUID,
+		Providers:  profile.Providers,
+		Admin:      token.Claims[AdminClaim] == true,
 	}
 
 	return &AuthResult{Success: true, User: authUser, UID: token.UID}
@@ -98,33 +141,67 @@ func setAuthContextFromResult(c *gin.Context, authResult *AuthResult) {
 	}
 }
 
-// FirebaseAuth creates a middleware that validates Firebase ID tokens
-func FirebaseAuth(firebaseService *datastore.FirebaseService) gin.HandlerFunc {
+// FirebaseAuth creates a middleware that validates ID tokens with the given verifier
+func FirebaseAuth(verifier TokenVerifier) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		authResult := authenticateToken(firebaseService, c.GetHeader("Authorization"))
+		authResult := authenticateToken(c.Request.Context(), verifier, c.GetHeader("Authorization"))
 
 		if !authResult.Success {
-			var statusCode int
-			if authResult.Error.Error() == "failed to get user information" {
-				statusCode = http.StatusInternalServerError
-			} else {
-				statusCode = http.StatusUnauthorized
-			}
+			abortWithAuthError(c, authResult)
+			return
+		}
 
-			c.JSON(statusCode, gin.H{"error": authResult.Error.Error()})
-			c.Abort()
+		setAuthContextFromResult(c, authResult)
+		c.Next()
+	}
+}
+
+// GuestOrFirebaseAuth creates a middleware that treats requests without an Authorization header as guests
+// (or as the per-device anonymous user when X-Device-ID is sent),
+// but rejects requests whose Authorization header is present and invalid (e.g. an expired token)
+// so that signed-in players are not silently downgraded to the guest account.
+func GuestOrFirebaseAuth(verifier TokenVerifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authResult := authenticateToken(c.Request.Context(), verifier, c.GetHeader("Authorization"))
+
+		if !authResult.Success && authResult.Reason != ReasonMissing {
+			abortWithAuthError(c, authResult)
 			return
 		}
 
 		setAuthContextFromResult(c, authResult)
+
+		// Without an Authorization header, a device ID selects the per-device anonymous user
+		if deviceID := c.GetHeader(DeviceIDHeader); !authResult.Success && deviceID != "" {
+			if !IsValidDeviceID(deviceID) {
+				problem.Write(c, ProblemInvalidDeviceID, "")
+				c.Abort()
+				return
+			}
+			c.Set(AuthUIDKey, AnonymousUID(deviceID))
+		}
+
 		c.Next()
 	}
 }
 
-// OptionalFirebaseAuth creates a middleware that validates Firebase ID tokens but allows guest access
-func OptionalFirebaseAuth(firebaseService *datastore.FirebaseService) gin.HandlerFunc {
+// abortWithAuthError responds with the problem of the authentication failure and its reason.
+// Internal failures are logged and sent without their details.
+func abortWithAuthError(c *gin.Context, authResult *AuthResult) {
+	t, ok := reasonProblems[authResult.Reason]
+	if ok {
+		problem.WriteReason(c, t, authResult.Error.Error(), authResult.Reason)
+	} else {
+		fmt.Printf("Error: %s %s: %v\n", c.Request.Method, c.Request.URL.Path, authResult.Error)
+		problem.WriteReason(c, problem.Internal, "", authResult.Reason)
+	}
+	c.Abort()
+}
+
+// OptionalFirebaseAuth creates a middleware that validates ID tokens but allows guest access
+func OptionalFirebaseAuth(verifier TokenVerifier) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		authResult := authenticateToken(firebaseService, c.GetHeader("Authorization"))
+		authResult := authenticateToken(c.Request.Context(), verifier, c.GetHeader("Authorization"))
 		setAuthContextFromResult(c, authResult)
 
 		// Continue to next handler (never abort)
@@ -132,6 +209,19 @@ func OptionalFirebaseAuth(firebaseService *datastore.FirebaseService) gin.Handle
 	}
 }
 
+// RequireAdmin creates a middleware that rejects users without the admin custom claim.
+// Register it after FirebaseAuth.
+func RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if user, ok := GetAuthenticatedUser(c); !ok || !user.Admin {
+			problem.Write(c, problemAdminRequired, "")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
 // GetAuthenticatedUser retrieves the authenticated user from gin context
 func GetAuthenticatedUser(c *gin.Context) (*AuthenticatedUser, bool) {
 	if user, exists := c.Get(AuthUserKey); exists {
@@ -156,3 +246,35 @@ func GetAuthenticatedUID(c *gin.Context) (string, bool) {
 func IsGuestUser(uid string) bool {
 	return uid == GuestUID
 }
+
+// NewDeviceID issues a random device ID for a per-device anonymous user
+func NewDeviceID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// IsValidDeviceID checks that the device ID has the format issued by NewDeviceID
+func IsValidDeviceID(deviceID string) bool {
+	if len(deviceID) != 32 {
+		return false
+	}
+	for _, c := range deviceID {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// AnonymousUID returns the UID of the anonymous user for a device ID
+func AnonymousUID(deviceID string) string {
+	return AnonymousUIDPrefix + deviceID
+}
+
+// IsAnonymousUser checks if the UID belongs to a per-device anonymous user
+func IsAnonymousUser(uid string) bool {
+	return strings.HasPrefix(uid, AnonymousUIDPrefix)
+}
@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"kyouen-server/internal/problem"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestGuestOrFirebaseAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	v := newTestVerifier(t)
+	valid, _ := v.SignHS256(map[string]interface{}{"iss": "kyouen-dev", "sub": "user-1", "exp": time.Now().Add(time.Hour).Unix()})
+	expired, _ := v.SignHS256(map[string]interface{}{"iss": "kyouen-dev", "sub": "user-1", "exp": time.Now().Add(-time.Hour).Unix()})
+
+	deviceID, err := NewDeviceID()
+	if err != nil {
+		t.Fatalf("NewDeviceID failed: %v", err)
+	}
+	if !IsValidDeviceID(deviceID) {
+		t.Fatalf("NewDeviceID returned an invalid device ID: %s", deviceID)
+	}
+
+	router := gin.New()
+	router.GET("/stages", GuestOrFirebaseAuth(v), func(c *gin.Context) {
+		uid, _ := GetAuthenticatedUID(c)
+		c.String(http.StatusOK, uid)
+	})
+
+	tests := []struct {
+		name       string
+		header     string
+		deviceID   string
+		wantStatus int
+		wantBody   string
+	}{
+		{"no header is guest", "", "", http.StatusOK, GuestUID},
+		{"valid token", "Bearer " + valid, "", http.StatusOK, "user-1"},
+		{"expired token", "Bearer " + expired, "", http.StatusUnauthorized, `"code":"TOKEN_EXPIRED","reason":"expired"`},
+		{"malformed token", "Bearer not-a-jwt", "", http.StatusUnauthorized, `"reason":"malformed"`},
+		{"not bearer", "Basic abc", "", http.StatusUnauthorized, `"reason":"malformed"`},
+		{"device ID is anonymous", "", deviceID, http.StatusOK, AnonymousUID(deviceID)},
+		{"token wins over device ID", "Bearer " + valid, deviceID, http.StatusOK, "user-1"},
+		{"invalid device ID", "", "not-a-device", http.StatusBadRequest, `"code":"INVALID_DEVICE_ID"`},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", "/stages", nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		if tt.deviceID != "" {
+			req.Header.Set(DeviceIDHeader, tt.deviceID)
+		}
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		if resp.Code != tt.wantStatus {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.wantStatus, resp.Code)
+		}
+		if !strings.Contains(resp.Body.String(), tt.wantBody) {
+			t.Errorf("%s: expected body to contain %q, got %s", tt.name, tt.wantBody, resp.Body.String())
+		}
+		if resp.Code != http.StatusOK && resp.Header().Get("Content-Type") != problem.ContentType {
+			t.Errorf("%s: expected %s, got %s", tt.name, problem.ContentType, resp.Header().Get("Content-Type"))
+		}
+	}
+}
+
+func TestRequireAdmin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	v := newTestVerifier(t)
+	admin, _ := v.SignHS256(map[string]interface{}{"iss": "kyouen-dev", "sub": "admin-1", "exp": time.Now().Add(time.Hour).Unix(), AdminClaim: true})
+	user, _ := v.SignHS256(map[string]interface{}{"iss": "kyouen-dev", "sub": "user-1", "exp": time.Now().Add(time.Hour).Unix()})
+
+	router := gin.New()
+	router.PUT("/collections", FirebaseAuth(v), RequireAdmin(), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		name       string
+		token      string
+		wantStatus int
+	}{
+		{"admin claim", admin, http.StatusOK},
+		{"no admin claim", user, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest("PUT", "/collections", nil)
+		req.Header.Set("Authorization", "Bearer "+tt.token)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		if resp.Code != tt.wantStatus {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.wantStatus, resp.Code)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CacheOptions configures a CachingVerifier
+type CacheOptions struct {
+	// MaxEntries bounds the number of cached tokens and user records (each)
+	MaxEntries int
+	// TokenTTL is how long a verified token is reused at most (never past its own expiry).
+	// It bounds how long a revoked token is still accepted, since revocation is only checked on verification.
+	TokenTTL time.Duration
+	// UserTTL is how long a user record is reused before it is fetched again
+	UserTTL time.Duration
+}
+
+// DefaultCacheOptions is used for the Firebase verifier
+var DefaultCacheOptions = CacheOptions{
+	MaxEntries: 10000,
+	TokenTTL:   time.Minute,
+	UserTTL:    5 * time.Minute,
+}
+
+// CacheStats holds hit/miss counters of a CachingVerifier
+type CacheStats struct {
+	TokenHits   int64   `json:"token_hits"`
+	TokenMisses int64   `json:"token_misses"`
+	UserHits    int64   `json:"user_hits"`
+	UserMisses  int64   `json:"user_misses"`
+	HitRate     float64 `json:"hit_rate"`
+}
+
+// CachingVerifier wraps a TokenVerifier and caches verified tokens and user records in process.
+// Tokens are keyed by their SHA-256 hash and kept for TokenTTL, never outliving their own expiry.
+type CachingVerifier struct {
+	next    TokenVerifier
+	options CacheOptions
+	now     func() time.Time
+
+	tokens *expiringCache[*Token]
+	users  *expiringCache[*UserRecord]
+
+	tokenHits, tokenMisses atomic.Int64
+	userHits, userMisses   atomic.Int64
+}
+
+// NewCachingVerifier creates a CachingVerifier in front of next
+func NewCachingVerifier(next TokenVerifier, options CacheOptions) *CachingVerifier {
+	return &CachingVerifier{
+		next:    next,
+		options: options,
+		now:     time.Now,
+		tokens:  newExpiringCache[*Token](options.MaxEntries),
+		users:   newExpiringCache[*UserRecord](options.MaxEntries),
+	}
+}
+
+// VerifyIDToken returns the cached verification result or verifies the token with the wrapped verifier
+func (v *CachingVerifier) VerifyIDToken(ctx context.Context, idToken string) (*Token, error) {
+	sum := sha256.Sum256([]byte(idToken))
+	key := hex.EncodeToString(sum[:])
+	now := v.now()
+
+	if token, ok := v.tokens.get(key, now); ok {
+		v.tokenHits.Add(1)
+		return token, nil
+	}
+	v.tokenMisses.Add(1)
+
+	token, err := v.next.VerifyIDToken(ctx, idToken)
+	if err != nil {
+		return nil, err
+	}
+	expiresAt := now.Add(v.options.TokenTTL)
+	if token.Expires.Before(expiresAt) {
+		expiresAt = token.Expires
+	}
+	v.tokens.set(key, token, expiresAt, now)
+	return token, nil
+}
+
+// GetUser returns the cached user record or fetches it from the wrapped verifier
+func (v *CachingVerifier) GetUser(ctx context.Context, uid string) (*UserRecord, error) {
+	now := v.now()
+
+	if user, ok := v.users.get(uid, now); ok {
+		v.userHits.Add(1)
+		return user, nil
+	}
+	v.userMisses.Add(1)
+
+	user, err := v.next.GetUser(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	v.users.set(uid, user, now.Add(v.options.UserTTL), now)
+	return user, nil
+}
+
+// DeleteUser deletes the user and drops every cached entry belonging to it
+func (v *CachingVerifier) DeleteUser(ctx context.Context, uid string) error {
+	v.users.delete(uid)
+	v.tokens.deleteFunc(func(token *Token) bool { return token.UID == uid })
+	return v.next.DeleteUser(ctx, uid)
+}
+
+// Stats returns the current hit/miss counters
+func (v *CachingVerifier) Stats() CacheStats {
+	stats := CacheStats{
+		TokenHits:   v.tokenHits.Load(),
+		TokenMisses: v.tokenMisses.Load(),
+		UserHits:    v.userHits.Load(),
+		UserMisses:  v.userMisses.Load(),
+	}
+	hits := stats.TokenHits + stats.UserHits
+	if total := hits + stats.TokenMisses + stats.UserMisses; total > 0 {
+		stats.HitRate = float64(hits) / float64(total)
+	}
+	return stats
+}
+
+type expiringEntry[V any] struct {
+	value     V
+	expiresAt time.Time
+}
+
+// expiringCache is a size-bounded map whose entries expire at a fixed time
+type expiringCache[V any] struct {
+	mu         sync.Mutex
+	maxEntries int
+	entries    map[string]expiringEntry[V]
+}
+
+func newExpiringCache[V any](maxEntries int) *expiringCache[V] {
+	return &expiringCache[V]{
+		maxEntries: maxEntries,
+		entries:    make(map[string]expiringEntry[V]),
+	}
+}
+
+func (c *expiringCache[V]) get(key string, now time.Time) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || !now.Before(entry.expiresAt) {
+		delete(c.entries, key)
+		var zero V
+		return zero, false
+	}
+	return entry.value, true
+}
+
+func (c *expiringCache[V]) set(key string, value V, expiresAt, now time.Time) {
+	if !now.Before(expiresAt) || c.maxEntries <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, exists := c.entries[key]; !exists && len(c.entries) >= c.maxEntries {
+		c.evict(now)
+	}
+	c.entries[key] = expiringEntry[V]{value: value, expiresAt: expiresAt}
+}
+
+func (c *expiringCache[V]) delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+}
+
+func (c *expiringCache[V]) deleteFunc(match func(V) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, entry := range c.entries {
+		if match(entry.value) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// evict drops expired entries, or the entry closest to expiry if none have expired
+func (c *expiringCache[V]) evict(now time.Time) {
+	var oldestKey string
+	var oldest time.Time
+	for key, entry := range c.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(c.entries, key)
+			continue
+		}
+		if oldestKey == "" || entry.expiresAt.Before(oldest) {
+			oldestKey, oldest = key, entry.expiresAt
+		}
+	}
+	if len(c.entries) >= c.maxEntries && oldestKey != "" {
+		delete(c.entries, oldestKey)
+	}
+}
@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// countingVerifier is a TokenVerifier stub that counts calls
+type countingVerifier struct {
+	expires     time.Time
+	verifyCalls int
+	getCalls    int
+}
+
+func (v *countingVerifier) VerifyIDToken(ctx context.Context, idToken string) (*Token, error) {
+	v.verifyCalls++
+	return &Token{UID: "uid-" + idToken, Expires: v.expires}, nil
+}
+
+func (v *countingVerifier) GetUser(ctx context.Context, uid string) (*UserRecord, error) {
+	v.getCalls++
+	return &UserRecord{UID: uid}, nil
+}
+
+func (v *countingVerifier) DeleteUser(ctx context.Context, uid string) error {
+	return nil
+}
+
+func TestCachingVerifier_CachesUntilExpiry(t *testing.T) {
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	next := &countingVerifier{expires: now.Add(time.Minute)}
+	v := NewCachingVerifier(next, CacheOptions{MaxEntries: 10, TokenTTL: time.Hour, UserTTL: time.Hour})
+	v.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		if _, err := v.VerifyIDToken(ctx, "a"); err != nil {
+			t.Fatalf("VerifyIDToken failed: %v", err)
+		}
+		if _, err := v.GetUser(ctx, "uid-a"); err != nil {
+			t.Fatalf("GetUser failed: %v", err)
+		}
+	}
+	if next.verifyCalls != 1 || next.getCalls != 1 {
+		t.Errorf("Expected 1 verify and 1 get call, got %d and %d", next.verifyCalls, next.getCalls)
+	}
+
+	// The token expires before the user TTL, so it is verified again
+	now = now.Add(2 * time.Minute)
+	if _, err := v.VerifyIDToken(ctx, "a"); err != nil {
+		t.Fatalf("VerifyIDToken failed: %v", err)
+	}
+	if next.verifyCalls != 2 {
+		t.Errorf("Expected expired token to be verified again, got %d calls", next.verifyCalls)
+	}
+
+	stats := v.Stats()
+	if stats.TokenHits != 2 || stats.TokenMisses != 2 || stats.UserHits != 2 || stats.UserMisses != 1 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+	if stats.HitRate != 4.0/7.0 {
+		t.Errorf("Expected hit rate 4/7, got %f", stats.HitRate)
+	}
+}
+
+func TestCachingVerifier_BoundedAndInvalidatedOnDelete(t *testing.T) {
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	next := &countingVerifier{expires: now.Add(time.Hour)}
+	v := NewCachingVerifier(next, CacheOptions{MaxEntries: 2, TokenTTL: time.Hour, UserTTL: time.Hour})
+	v.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	for _, token := range []string{"a", "b", "c"} {
+		v.VerifyIDToken(ctx, token)
+	}
+	if len(v.tokens.entries) != 2 {
+		t.Errorf("Expected cache to hold 2 tokens, got %d", len(v.tokens.entries))
+	}
+
+	v.GetUser(ctx, "uid-c")
+	if err := v.DeleteUser(ctx, "uid-c"); err != nil {
+		t.Fatalf("DeleteUser failed: %v", err)
+	}
+	v.VerifyIDToken(ctx, "c")
+	v.GetUser(ctx, "uid-c")
+	if next.verifyCalls != 4 || next.getCalls != 2 {
+		t.Errorf("Expected deleted user to be fetched again, got %d verify and %d get calls", next.verifyCalls, next.getCalls)
+	}
+}
+
+func TestCachingVerifier_TokenTTL(t *testing.T) {
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	next := &countingVerifier{expires: now.Add(time.Hour)}
+	v := NewCachingVerifier(next, CacheOptions{MaxEntries: 10, TokenTTL: time.Minute, UserTTL: time.Hour})
+	v.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	for _, elapsed := range []time.Duration{0, 30 * time.Second, 90 * time.Second} {
+		now = now.Add(elapsed)
+		if _, err := v.VerifyIDToken(ctx, "a"); err != nil {
+			t.Fatalf("VerifyIDToken failed: %v", err)
+		}
+	}
+	// A token valid for an hour is verified again (and checked for revocation) after TokenTTL
+	if next.verifyCalls != 2 {
+		t.Errorf("Expected the token to be verified again after TokenTTL, got %d calls", next.verifyCalls)
+	}
+}
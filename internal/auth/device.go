@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// DeviceTokens issues and verifies device tokens, which prove the ownership of a device ID.
+// The device ID is sent in the X-Device-ID header of every request, so knowing it is not enough
+// to merge its anonymous user into an account; the token is only sent on login.
+// A token is the HMAC-SHA256 of the device ID, so no state is stored when a device ID is issued.
+type DeviceTokens struct {
+	secret []byte
+}
+
+// NewDeviceTokens creates DeviceTokens signing with secret. Every instance must use the same secret.
+func NewDeviceTokens(secret []byte) *DeviceTokens {
+	return &DeviceTokens{secret: secret}
+}
+
+// NewRandomDeviceTokens creates DeviceTokens with a random secret, whose tokens are only valid in this process
+func NewRandomDeviceTokens() (*DeviceTokens, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	return NewDeviceTokens(secret), nil
+}
+
+// Issue returns the token of a device ID
+func (d *DeviceTokens) Issue(deviceID string) string {
+	mac := hmac.New(sha256.New, d.secret)
+	mac.Write([]byte(deviceID))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether token was issued for the device ID
+func (d *DeviceTokens) Verify(deviceID, token string) bool {
+	return hmac.Equal([]byte(token), []byte(d.Issue(deviceID)))
+}
@@ -0,0 +1,29 @@
+package auth
+
+import "testing"
+
+func TestDeviceTokens(t *testing.T) {
+	tokens := NewDeviceTokens([]byte("secret"))
+	deviceID, err := NewDeviceID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherID, err := NewDeviceID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := tokens.Issue(deviceID)
+
+	if !tokens.Verify(deviceID, token) {
+		t.Errorf("Expected the issued token to be valid")
+	}
+	if tokens.Verify(otherID, token) {
+		t.Errorf("Expected the token to be rejected for another device")
+	}
+	if tokens.Verify(deviceID, "") || tokens.Verify(deviceID, deviceID) {
+		t.Errorf("Expected a missing or forged token to be rejected")
+	}
+	if NewDeviceTokens([]byte("other secret")).Verify(deviceID, token) {
+		t.Errorf("Expected the token to be rejected with another secret")
+	}
+}
@@ -0,0 +1,259 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LocalConfig configures a LocalVerifier
+type LocalConfig struct {
+	// HMACSecret enables HS256 tokens signed with this secret
+	HMACSecret []byte
+	// RSAPublicKey enables RS256 tokens signed with the matching private key
+	RSAPublicKey *rsa.PublicKey
+	// Issuer, if set, must match the "iss" claim
+	Issuer string
+	// Audience, if set, must be contained in the "aud" claim
+	Audience string
+	// UIDClaim is the claim used as the user's UID (default: "sub")
+	UIDClaim string
+	// Leeway is the allowed clock skew when checking "exp" and "nbf"
+	Leeway time.Duration
+}
+
+// LocalVerifier implements TokenVerifier with JWTs signed by a development key.
+// User records are built from the claims of the tokens it has verified,
+// so no external identity provider is needed.
+type LocalVerifier struct {
+	config LocalConfig
+	now    func() time.Time
+
+	mu    sync.RWMutex
+	users map[string]*UserRecord
+}
+
+// NewLocalVerifier creates a LocalVerifier; at least one signing key must be configured
+func NewLocalVerifier(config LocalConfig) (*LocalVerifier, error) {
+	if len(config.HMACSecret) == 0 && config.RSAPublicKey == nil {
+		return nil, errors.New("local verifier requires an HMAC secret or an RSA public key")
+	}
+	if config.UIDClaim == "" {
+		config.UIDClaim = "sub"
+	}
+
+	return &LocalVerifier{
+		config: config,
+		now:    time.Now,
+		users:  make(map[string]*UserRecord),
+	}, nil
+}
+
+// ParseRSAPublicKeyPEM parses a PEM encoded PKIX or PKCS#1 RSA public key
+func ParseRSAPublicKeyPEM(data []byte) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("failed to decode PEM block")
+	}
+
+	if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %w", err)
+	}
+	key, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("public key is not an RSA key")
+	}
+	return key, nil
+}
+
+// VerifyIDToken verifies the signature and standard claims of a HS256/RS256 JWT
+func (v *LocalVerifier) VerifyIDToken(ctx context.Context, idToken string) (*Token, error) {
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: token must have 3 segments", ErrTokenMalformed)
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: malformed header: %v", ErrTokenMalformed, err)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed signature: %v", ErrTokenMalformed, err)
+	}
+	if err := v.verifySignature(header.Alg, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: malformed claims: %v", ErrTokenMalformed, err)
+	}
+
+	now := v.now()
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return nil, fmt.Errorf("%w: missing 'exp' claim", ErrInvalidToken)
+	}
+	expires := time.Unix(int64(exp), 0)
+	if now.After(expires.Add(v.config.Leeway)) {
+		return nil, ErrTokenExpired
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(v.config.Leeway).Before(time.Unix(int64(nbf), 0)) {
+		return nil, fmt.Errorf("%w: token is not valid yet", ErrInvalidToken)
+	}
+	if v.config.Issuer != "" && claims["iss"] != v.config.Issuer {
+		return nil, fmt.Errorf("%w: unexpected issuer %v", ErrInvalidToken, claims["iss"])
+	}
+	if v.config.Audience != "" && !hasAudience(claims["aud"], v.config.Audience) {
+		return nil, fmt.Errorf("%w: unexpected audience %v", ErrInvalidToken, claims["aud"])
+	}
+
+	uid, _ := claims[v.config.UIDClaim].(string)
+	if uid == "" {
+		return nil, fmt.Errorf("%w: missing %q claim", ErrInvalidToken, v.config.UIDClaim)
+	}
+
+	for _, standardClaim := range []string{"iss", "aud", "exp", "iat", "nbf", "sub", "uid"} {
+		delete(claims, standardClaim)
+	}
+
+	v.rememberUser(uid, claims)
+
+	return &Token{UID: uid, Expires: expires, Claims: claims}, nil
+}
+
+// GetUser returns the user record built from the latest verified token for the UID
+func (v *LocalVerifier) GetUser(ctx context.Context, uid string) (*UserRecord, error) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	user, ok := v.users[uid]
+	if !ok {
+		return nil, fmt.Errorf("user not found: %s", uid)
+	}
+	copied := *user
+	return &copied, nil
+}
+
+// DeleteUser forgets the user record for the UID
+func (v *LocalVerifier) DeleteUser(ctx context.Context, uid string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	delete(v.users, uid)
+	return nil
+}
+
+// SignHS256 issues a HS256 token with the configured secret.
+// It is intended for test servers and integration tests.
+func (v *LocalVerifier) SignHS256(claims map[string]interface{}) (string, error) {
+	if len(v.config.HMACSecret) == 0 {
+		return "", errors.New("HMAC secret is not configured")
+	}
+
+	header, err := json.Marshal(map[string]string{"alg": "HS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, v.config.HMACSecret)
+	mac.Write([]byte(signingInput))
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+func (v *LocalVerifier) verifySignature(alg, signingInput string, signature []byte) error {
+	switch alg {
+	case "HS256":
+		if len(v.config.HMACSecret) == 0 {
+			return fmt.Errorf("%w: HS256 is not enabled", ErrInvalidToken)
+		}
+		mac := hmac.New(sha256.New, v.config.HMACSecret)
+		mac.Write([]byte(signingInput))
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return fmt.Errorf("%w: signature mismatch", ErrInvalidToken)
+		}
+	case "RS256":
+		if v.config.RSAPublicKey == nil {
+			return fmt.Errorf("%w: RS256 is not enabled", ErrInvalidToken)
+		}
+		digest := sha256.Sum256([]byte(signingInput))
+		if err := rsa.VerifyPKCS1v15(v.config.RSAPublicKey, crypto.SHA256, digest[:], signature); err != nil {
+			return fmt.Errorf("%w: signature mismatch", ErrInvalidToken)
+		}
+	default:
+		return fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidToken, alg)
+	}
+	return nil
+}
+
+// rememberUser stores the profile claims of a verified token so GetUser can return them
+func (v *LocalVerifier) rememberUser(uid string, claims map[string]interface{}) {
+	user := &UserRecord{UID: uid}
+	user.Email, _ = claims["email"].(string)
+	user.DisplayName, _ = claims["name"].(string)
+	user.PhotoURL, _ = claims["picture"].(string)
+	for providerID, providerUID := range identitiesFromClaims(claims) {
+		user.Providers = append(user.Providers, ProviderInfo{
+			ProviderID:  providerID,
+			UID:         providerUID,
+			Email:       user.Email,
+			DisplayName: user.DisplayName,
+			PhotoURL:    user.PhotoURL,
+		})
+	}
+	sort.Slice(user.Providers, func(i, j int) bool {
+		return user.Providers[i].ProviderID < user.Providers[j].ProviderID
+	})
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.users[uid] = user
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func hasAudience(aud interface{}, expected string) bool {
+	switch a := aud.(type) {
+	case string:
+		return a == expected
+	case []interface{}:
+		for _, item := range a {
+			if item == expected {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,181 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newTestVerifier(t *testing.T) *LocalVerifier {
+	t.Helper()
+	v, err := NewLocalVerifier(LocalConfig{HMACSecret: []byte("test-secret"), Issuer: "kyouen-dev"})
+	if err != nil {
+		t.Fatalf("NewLocalVerifier failed: %v", err)
+	}
+	return v
+}
+
+func signRS256(t *testing.T, key *rsa.PrivateKey, claims map[string]interface{}) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestLocalVerifier_HS256(t *testing.T) {
+	v := newTestVerifier(t)
+	token, err := v.SignHS256(map[string]interface{}{
+		"iss":  "kyouen-dev",
+		"sub":  "user-1",
+		"name": "alice",
+		"exp":  time.Now().Add(time.Hour).Unix(),
+		"firebase": map[string]interface{}{
+			"identities": map[string]interface{}{"twitter.com": []interface{}{"12345"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SignHS256 failed: %v", err)
+	}
+
+	verified, err := v.VerifyIDToken(context.Background(), token)
+	if err != nil {
+		t.Fatalf("VerifyIDToken failed: %v", err)
+	}
+	if verified.UID != "user-1" {
+		t.Errorf("Expected UID user-1, got %s", verified.UID)
+	}
+	if got := TwitterUIDFromClaims(verified.Claims); got != "12345" {
+		t.Errorf("Expected Twitter UID 12345, got %q", got)
+	}
+
+	user, err := v.GetUser(context.Background(), "user-1")
+	if err != nil {
+		t.Fatalf("GetUser failed: %v", err)
+	}
+	if user.DisplayName != "alice" {
+		t.Errorf("Expected display name alice, got %q", user.DisplayName)
+	}
+}
+
+func TestLocalVerifier_Expired(t *testing.T) {
+	v := newTestVerifier(t)
+	token, _ := v.SignHS256(map[string]interface{}{
+		"iss": "kyouen-dev",
+		"sub": "user-1",
+		"exp": time.Now().Add(-time.Hour).Unix(),
+	})
+
+	_, err := v.VerifyIDToken(context.Background(), token)
+	if !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("Expected ErrTokenExpired, got %v", err)
+	}
+}
+
+func TestLocalVerifier_InvalidTokens(t *testing.T) {
+	v := newTestVerifier(t)
+	other, _ := NewLocalVerifier(LocalConfig{HMACSecret: []byte("other-secret")})
+	exp := time.Now().Add(time.Hour).Unix()
+
+	wrongKey, _ := other.SignHS256(map[string]interface{}{"iss": "kyouen-dev", "sub": "user-1", "exp": exp})
+	wrongIssuer, _ := v.SignHS256(map[string]interface{}{"iss": "someone-else", "sub": "user-1", "exp": exp})
+	noSubject, _ := v.SignHS256(map[string]interface{}{"iss": "kyouen-dev", "exp": exp})
+
+	if _, err := v.VerifyIDToken(context.Background(), "not-a-jwt"); !errors.Is(err, ErrTokenMalformed) {
+		t.Errorf("malformed: expected ErrTokenMalformed, got %v", err)
+	}
+
+	tests := map[string]string{
+		"wrong key":    wrongKey,
+		"wrong issuer": wrongIssuer,
+		"no subject":   noSubject,
+	}
+	for name, token := range tests {
+		if _, err := v.VerifyIDToken(context.Background(), token); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: expected ErrInvalidToken, got %v", name, err)
+		}
+	}
+}
+
+func TestLocalVerifier_RS256(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	v, err := NewLocalVerifier(LocalConfig{RSAPublicKey: &key.PublicKey, Audience: "kyouen"})
+	if err != nil {
+		t.Fatalf("NewLocalVerifier failed: %v", err)
+	}
+
+	token := signRS256(t, key, map[string]interface{}{
+		"aud": []string{"kyouen"},
+		"sub": "user-2",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	verified, err := v.VerifyIDToken(context.Background(), token)
+	if err != nil {
+		t.Fatalf("VerifyIDToken failed: %v", err)
+	}
+	if verified.UID != "user-2" {
+		t.Errorf("Expected UID user-2, got %s", verified.UID)
+	}
+
+	// HS256 is not enabled for this verifier
+	hsVerifier := newTestVerifier(t)
+	hsToken, _ := hsVerifier.SignHS256(map[string]interface{}{"aud": "kyouen", "sub": "user-2", "exp": time.Now().Add(time.Hour).Unix()})
+	if _, err := v.VerifyIDToken(context.Background(), hsToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected ErrInvalidToken for HS256 token, got %v", err)
+	}
+}
+
+func TestFirebaseAuth_WithLocalVerifier(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	v := newTestVerifier(t)
+	token, _ := v.SignHS256(map[string]interface{}{
+		"iss": "kyouen-dev",
+		"sub": "user-1",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+
+	router := gin.New()
+	router.GET("/private", FirebaseAuth(v), func(c *gin.Context) {
+		uid, _ := GetAuthenticatedUID(c)
+		c.String(http.StatusOK, uid)
+	})
+
+	req, _ := http.NewRequest("GET", "/private", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, resp.Code)
+	}
+	if resp.Body.String() != "user-1" {
+		t.Errorf("Expected uid user-1, got %s", resp.Body.String())
+	}
+
+	req, _ = http.NewRequest("GET", "/private", nil)
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	if resp.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d without token, got %d", http.StatusUnauthorized, resp.Code)
+	}
+}
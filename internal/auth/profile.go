@@ -0,0 +1,134 @@
+package auth
+
+import (
+	"sort"
+	"strings"
+)
+
+// Sign-in provider IDs as reported by Firebase Authentication
+const (
+	ProviderTwitter  = "twitter.com"
+	ProviderGoogle   = "google.com"
+	ProviderApple    = "apple.com"
+	ProviderGitHub   = "github.com"
+	ProviderPassword = "password"
+)
+
+// providerPriority is the order in which linked providers are consulted for a screen name and image
+// when neither the user record nor the provider used to sign in has one
+var providerPriority = []string{ProviderTwitter, ProviderGoogle, ProviderApple, ProviderGitHub, ProviderPassword}
+
+// Profile is the provider-independent profile of a signed-in user
+type Profile struct {
+	ScreenName string
+	Image      string
+	TwitterUID string
+	// Providers holds the IDs of all providers linked to the account, sorted
+	Providers []string
+}
+
+// ExtractProfile builds the user's profile from the verified token and the identity provider's user record.
+// The display name and photo of the user record take precedence; missing values are filled from the provider
+// used to sign in, then from the other linked providers, and finally the screen name falls back to the local
+// part of the email address (Apple and email/password accounts often have no display name).
+func ExtractProfile(token *Token, user *UserRecord) Profile {
+	profile := Profile{
+		ScreenName: user.DisplayName,
+		Image:      user.PhotoURL,
+		TwitterUID: TwitterUIDFromClaims(token.Claims),
+	}
+
+	byID := make(map[string]ProviderInfo, len(user.Providers))
+	for _, p := range user.Providers {
+		byID[p.ProviderID] = p
+	}
+
+	candidates := []string{SignInProviderFromClaims(token.Claims)}
+	candidates = append(candidates, providerPriority...)
+	for _, p := range user.Providers {
+		candidates = append(candidates, p.ProviderID)
+	}
+	for _, id := range candidates {
+		p, ok := byID[id]
+		if !ok {
+			continue
+		}
+		if profile.ScreenName == "" {
+			profile.ScreenName = p.DisplayName
+		}
+		if profile.Image == "" {
+			profile.Image = p.PhotoURL
+		}
+	}
+
+	if profile.TwitterUID == "" {
+		if p, ok := byID[ProviderTwitter]; ok {
+			profile.TwitterUID = p.UID
+		}
+	}
+
+	if profile.ScreenName == "" {
+		email := user.Email
+		for _, id := range candidates {
+			if email != "" {
+				break
+			}
+			email = byID[id].Email
+		}
+		if at := strings.Index(email, "@"); at > 0 {
+			profile.ScreenName = email[:at]
+		}
+	}
+
+	providers := make(map[string]bool)
+	for _, p := range user.Providers {
+		providers[p.ProviderID] = true
+	}
+	for id := range identitiesFromClaims(token.Claims) {
+		providers[id] = true
+	}
+	if signIn := SignInProviderFromClaims(token.Claims); signIn != "" && signIn != "custom" && signIn != "anonymous" {
+		providers[signIn] = true
+	}
+	for id := range providers {
+		profile.Providers = append(profile.Providers, id)
+	}
+	sort.Strings(profile.Providers)
+
+	return profile
+}
+
+// SignInProviderFromClaims returns the provider used to sign in ("firebase.sign_in_provider" claim)
+func SignInProviderFromClaims(claims map[string]interface{}) string {
+	if firebaseClaims, ok := claims["firebase"].(map[string]interface{}); ok {
+		if provider, ok := firebaseClaims["sign_in_provider"].(string); ok {
+			return provider
+		}
+	}
+	return ""
+}
+
+// identitiesFromClaims returns the first user ID of each provider in the "firebase.identities" claim.
+// The "email" identity only mirrors the account's email address and is not a provider.
+func identitiesFromClaims(claims map[string]interface{}) map[string]string {
+	result := make(map[string]string)
+	firebaseClaims, ok := claims["firebase"].(map[string]interface{})
+	if !ok {
+		return result
+	}
+	identities, ok := firebaseClaims["identities"].(map[string]interface{})
+	if !ok {
+		return result
+	}
+	for provider, ids := range identities {
+		if provider == "email" {
+			continue
+		}
+		if list, ok := ids.([]interface{}); ok && len(list) > 0 {
+			if id, ok := list[0].(string); ok {
+				result[provider] = id
+			}
+		}
+	}
+	return result
+}
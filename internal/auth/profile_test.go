@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"reflect"
+	"testing"
+)
+
+func firebaseClaims(signInProvider string, identities map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"firebase": map[string]interface{}{
+			"sign_in_provider": signInProvider,
+			"identities":       identities,
+		},
+	}
+}
+
+func TestExtractProfile(t *testing.T) {
+	tests := []struct {
+		name  string
+		token *Token
+		user  *UserRecord
+		want  Profile
+	}{
+		{
+			name:  "twitter",
+			token: &Token{Claims: firebaseClaims(ProviderTwitter, map[string]interface{}{"twitter.com": []interface{}{"12345"}})},
+			user: &UserRecord{Providers: []ProviderInfo{
+				{ProviderID: ProviderTwitter, UID: "12345", DisplayName: "alice", PhotoURL: "https://example.com/alice.png"},
+			}},
+			want: Profile{ScreenName: "alice", Image: "https://example.com/alice.png", TwitterUID: "12345", Providers: []string{ProviderTwitter}},
+		},
+		{
+			name:  "google with user record profile",
+			token: &Token{Claims: firebaseClaims(ProviderGoogle, map[string]interface{}{"google.com": []interface{}{"g-1"}, "email": []interface{}{"bob@example.com"}})},
+			user: &UserRecord{DisplayName: "Bob", PhotoURL: "https://example.com/bob.png", Providers: []ProviderInfo{
+				{ProviderID: ProviderGoogle, UID: "g-1", DisplayName: "Bob G"},
+			}},
+			want: Profile{ScreenName: "Bob", Image: "https://example.com/bob.png", Providers: []string{ProviderGoogle}},
+		},
+		{
+			name:  "sign-in provider is preferred over other linked providers",
+			token: &Token{Claims: firebaseClaims(ProviderGitHub, nil)},
+			user: &UserRecord{Providers: []ProviderInfo{
+				{ProviderID: ProviderTwitter, UID: "12345", DisplayName: "carol_tw"},
+				{ProviderID: ProviderGitHub, UID: "gh-1", DisplayName: "carol_gh", PhotoURL: "https://example.com/gh.png"},
+			}},
+			want: Profile{ScreenName: "carol_gh", Image: "https://example.com/gh.png", TwitterUID: "12345", Providers: []string{ProviderGitHub, ProviderTwitter}},
+		},
+		{
+			name:  "apple without a name falls back to email",
+			token: &Token{Claims: firebaseClaims(ProviderApple, map[string]interface{}{"apple.com": []interface{}{"a-1"}})},
+			user: &UserRecord{Providers: []ProviderInfo{
+				{ProviderID: ProviderApple, UID: "a-1", Email: "dave@privaterelay.appleid.com"},
+			}},
+			want: Profile{ScreenName: "dave", Providers: []string{ProviderApple}},
+		},
+		{
+			name:  "email and password",
+			token: &Token{Claims: firebaseClaims(ProviderPassword, map[string]interface{}{"email": []interface{}{"erin@example.com"}})},
+			user:  &UserRecord{Email: "erin@example.com"},
+			want:  Profile{ScreenName: "erin", Providers: []string{ProviderPassword}},
+		},
+	}
+
+	for _, tt := range tests {
+		got := ExtractProfile(tt.token, tt.user)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: expected %+v, got %+v", tt.name, tt.want, got)
+		}
+	}
+}
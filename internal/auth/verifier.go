@@ -0,0 +1,165 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	firebaseauth "firebase.google.com/go/v4/auth"
+	"kyouen-server/internal/config"
+	"kyouen-server/internal/datastore"
+)
+
+var (
+	// ErrInvalidToken is returned when an ID token cannot be verified
+	ErrInvalidToken = errors.New("invalid ID token")
+	// ErrTokenMalformed is returned when an ID token is not a well-formed JWT
+	ErrTokenMalformed = errors.New("malformed ID token")
+	// ErrTokenExpired is returned when an ID token is well-formed but past its expiry
+	ErrTokenExpired = errors.New("ID token has expired")
+	// ErrTokenRevoked is returned when an ID token has been revoked or its user disabled
+	ErrTokenRevoked = errors.New("ID token has been revoked")
+)
+
+// Token is the provider-independent result of a successful ID token verification
+type Token struct {
+	UID     string
+	Expires time.Time
+	// Claims holds the non-standard claims of the token (e.g. "firebase", "name", "picture")
+	Claims map[string]interface{}
+}
+
+// ProviderInfo represents a sign-in provider linked to a user
+type ProviderInfo struct {
+	ProviderID  string
+	UID         string
+	Email       string
+	DisplayName string
+	PhotoURL    string
+}
+
+// UserRecord represents the user information held by the identity provider
+type UserRecord struct {
+	UID         string
+	Email       string
+	DisplayName string
+	PhotoURL    string
+	Providers   []ProviderInfo
+}
+
+// TokenVerifier abstracts the identity provider used to authenticate requests.
+// FirebaseVerifier is used in production; LocalVerifier allows running and testing offline.
+type TokenVerifier interface {
+	// VerifyIDToken verifies the ID token and returns its claims
+	VerifyIDToken(ctx context.Context, idToken string) (*Token, error)
+	// GetUser retrieves user information for the given UID
+	GetUser(ctx context.Context, uid string) (*UserRecord, error)
+	// DeleteUser removes the user from the identity provider
+	DeleteUser(ctx context.Context, uid string) error
+}
+
+// FirebaseVerifier implements TokenVerifier using Firebase Authentication
+type FirebaseVerifier struct {
+	firebaseService *datastore.FirebaseService
+}
+
+// NewFirebaseVerifier creates a TokenVerifier backed by Firebase Authentication
+func NewFirebaseVerifier(firebaseService *datastore.FirebaseService) *FirebaseVerifier {
+	return &FirebaseVerifier{firebaseService: firebaseService}
+}
+
+// VerifyIDToken verifies a Firebase ID token, including its revocation status
+func (v *FirebaseVerifier) VerifyIDToken(ctx context.Context, idToken string) (*Token, error) {
+	token, err := v.firebaseService.VerifyIDTokenAndCheckRevoked(ctx, idToken)
+	if err != nil {
+		return nil, classifyFirebaseError(err)
+	}
+
+	return &Token{
+		UID:     token.UID,
+		Expires: time.Unix(token.Expires, 0),
+		Claims:  token.Claims,
+	}, nil
+}
+
+// GetUser retrieves the Firebase Auth user record
+func (v *FirebaseVerifier) GetUser(ctx context.Context, uid string) (*UserRecord, error) {
+	userRecord, err := v.firebaseService.GetUserByUID(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	providers := make([]ProviderInfo, 0, len(userRecord.ProviderUserInfo))
+	for _, p := range userRecord.ProviderUserInfo {
+		providers = append(providers, ProviderInfo{
+			ProviderID:  p.ProviderID,
+			UID:         p.UID,
+			Email:       p.Email,
+			DisplayName: p.DisplayName,
+			PhotoURL:    p.PhotoURL,
+		})
+	}
+
+	return &UserRecord{
+		UID:         userRecord.UID,
+		Email:       userRecord.Email,
+		DisplayName: userRecord.DisplayName,
+		PhotoURL:    userRecord.PhotoURL,
+		Providers:   providers,
+	}, nil
+}
+
+// DeleteUser deletes the user from Firebase Auth
+func (v *FirebaseVerifier) DeleteUser(ctx context.Context, uid string) error {
+	return v.firebaseService.DeleteUser(ctx, uid)
+}
+
+// classifyFirebaseError maps Firebase Auth token errors to the package's sentinel errors
+func classifyFirebaseError(err error) error {
+	cause := err
+	if unwrapped := errors.Unwrap(err); unwrapped != nil {
+		cause = unwrapped
+	}
+
+	switch {
+	case firebaseauth.IsIDTokenExpired(cause):
+		return fmt.Errorf("%w: %v", ErrTokenExpired, err)
+	case firebaseauth.IsIDTokenRevoked(cause), firebaseauth.IsUserDisabled(cause):
+		return fmt.Errorf("%w: %v", ErrTokenRevoked, err)
+	case firebaseauth.IsIDTokenInvalid(cause):
+		return fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	return err
+}
+
+// TwitterUIDFromClaims extracts the Twitter user ID from the "firebase.identities" claim
+func TwitterUIDFromClaims(claims map[string]interface{}) string {
+	return identitiesFromClaims(claims)[ProviderTwitter]
+}
+
+// NewTokenVerifier creates the TokenVerifier selected by the auth configuration
+func NewTokenVerifier(cfg config.AuthConfig, firebaseService *datastore.FirebaseService) (TokenVerifier, error) {
+	if cfg.Mode != "local" {
+		return NewCachingVerifier(NewFirebaseVerifier(firebaseService), DefaultCacheOptions), nil
+	}
+
+	localConfig := LocalConfig{
+		HMACSecret: []byte(cfg.LocalHMACSecret),
+		Issuer:     cfg.LocalIssuer,
+		Audience:   cfg.LocalAudience,
+	}
+	if cfg.LocalPublicKeyFile != "" {
+		data, err := os.ReadFile(cfg.LocalPublicKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read local auth public key: %w", err)
+		}
+		localConfig.RSAPublicKey, err = ParseRSAPublicKeyPEM(data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return NewLocalVerifier(localConfig)
+}
@@ -1,8 +1,12 @@
 package config
 
 import (
+	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
@@ -10,16 +14,95 @@ type Config struct {
 	ProjectID      string
 	Environment    string
 	FirebaseConfig FirebaseConfig
+	AuthConfig     AuthConfig
+	// ClearEventLog enables the append-only log of every stage clear (ClearEvent)
+	ClearEventLog  bool
+	AntiCheat      AntiCheatConfig
+	RateLimit      RateLimitConfig
+	Idempotency    IdempotencyConfig
+	ActivityStream ActivityStreamConfig
+	ResponseCache  ResponseCacheConfig
+
+	// DeviceTokenSecret signs the tokens proving the ownership of device IDs; empty means a per-process secret.
+	// The API server requires it on Cloud Run, where tokens must be valid on every instance.
+	DeviceTokenSecret string
+	// DeployEnvironment is "dev" or "prod" on Cloud Run (ENVIRONMENT, set by the deploy workflow), empty locally
+	DeployEnvironment string
 }
 
 type FirebaseConfig struct {
 	CredentialsFile string
 }
 
+// AuthConfig selects the ID token verifier.
+// Mode "firebase" (default) uses Firebase Authentication; "local" verifies JWTs signed by a development key.
+type AuthConfig struct {
+	Mode               string
+	LocalHMACSecret    string
+	LocalPublicKeyFile string
+	LocalIssuer        string
+	LocalAudience      string
+}
+
+// AntiCheatConfig configures the heuristics applied to clear submissions.
+// Zero MinSolveTimeMs or ClearRateLimit disables the corresponding check.
+type AntiCheatConfig struct {
+	MinSolveTimeMs  int64
+	ClearRateLimit  int64
+	ClearRateWindow time.Duration
+}
+
+// RateLimitConfig holds the per-route request budgets.
+// Store is "memory" (per instance, default) or "datastore" (shared by all instances).
+// TrustedProxies are the CIDRs whose X-Forwarded-For is trusted when identifying clients by IP;
+// nil means the Cloud Run defaults (middleware.DefaultTrustedProxies).
+type RateLimitConfig struct {
+	Store          string
+	TrustedProxies []string
+	CreateStage    RouteLimit
+	ClearStage     RouteLimit
+	Login          RouteLimit
+	Sync           RouteLimit
+}
+
+// RouteLimit allows Requests requests per Per for each client; a zero RouteLimit disables the limit
+type RouteLimit struct {
+	Requests int
+	Per      time.Duration
+}
+
+// IdempotencyConfig configures how long responses to requests with an Idempotency-Key are kept.
+// Store is "datastore" (default, shared by all instances) or "memory".
+type IdempotencyConfig struct {
+	Store string
+	TTL   time.Duration
+}
+
+// ActivityStreamConfig configures GET /v2/activities/stream.
+// Broker is "memory" (events reach the streams of the same instance only, default) or "datastore"
+// (events are shared by all instances, polled every PollInterval).
+type ActivityStreamConfig struct {
+	Broker       string
+	PollInterval time.Duration
+	Heartbeat    time.Duration
+}
+
+// ResponseCacheConfig configures the cache of read-heavy GET responses.
+// Store is "memory" (per instance, LRU of MaxEntries responses, default) or "redis"
+// (a Redis-compatible server at RedisAddr, shared by all instances).
+type ResponseCacheConfig struct {
+	Store         string
+	TTL           time.Duration
+	MaxEntries    int
+	RedisAddr     string
+	RedisPassword string
+}
+
 func Load() *Config {
 	// Determine default project ID based on environment
+	deployEnvironment := getEnv("ENVIRONMENT", "")
 	defaultProjectID := "my-android-server" // Production default
-	if env := getEnv("ENVIRONMENT", ""); env == "dev" {
+	if deployEnvironment == "dev" {
 		defaultProjectID = "api-project-732262258565"
 	}
 
@@ -30,6 +113,33 @@ func Load() *Config {
 		FirebaseConfig: FirebaseConfig{
 			CredentialsFile: getEnv("FIREBASE_CREDENTIALS_FILE", ""),
 		},
+		AuthConfig: AuthConfig{
+			Mode:               getEnv("AUTH_MODE", "firebase"),
+			LocalHMACSecret:    getEnv("LOCAL_AUTH_HMAC_SECRET", ""),
+			LocalPublicKeyFile: getEnv("LOCAL_AUTH_PUBLIC_KEY_FILE", ""),
+			LocalIssuer:        getEnv("LOCAL_AUTH_ISSUER", ""),
+			LocalAudience:      getEnv("LOCAL_AUTH_AUDIENCE", ""),
+		},
+		ClearEventLog:     getEnv("CLEAR_EVENT_LOG", "false") == "true",
+		DeviceTokenSecret: getEnv("DEVICE_TOKEN_SECRET", ""),
+		DeployEnvironment: deployEnvironment,
+	}
+
+	var err error
+	if config.AntiCheat, err = loadAntiCheatConfig(); err != nil {
+		log.Fatalf("Configuration validation failed: %v", err)
+	}
+	if config.RateLimit, err = loadRateLimitConfig(); err != nil {
+		log.Fatalf("Configuration validation failed: %v", err)
+	}
+	if config.Idempotency, err = loadIdempotencyConfig(); err != nil {
+		log.Fatalf("Configuration validation failed: %v", err)
+	}
+	if config.ActivityStream, err = loadActivityStreamConfig(); err != nil {
+		log.Fatalf("Configuration validation failed: %v", err)
+	}
+	if config.ResponseCache, err = loadResponseCacheConfig(); err != nil {
+		log.Fatalf("Configuration validation failed: %v", err)
 	}
 
 	if err := validateConfig(config); err != nil {
@@ -45,9 +155,129 @@ func validateConfig(config *Config) error {
 		log.Printf("Warning: GOOGLE_CLOUD_PROJECT is not set, using default: my-android-server")
 	}
 
+	if config.AuthConfig.Mode != "firebase" && config.AuthConfig.Mode != "local" {
+		return fmt.Errorf("AUTH_MODE must be \"firebase\" or \"local\": %s", config.AuthConfig.Mode)
+	}
+
 	return nil
 }
 
+func loadAntiCheatConfig() (AntiCheatConfig, error) {
+	var cfg AntiCheatConfig
+	var err error
+	if cfg.MinSolveTimeMs, err = strconv.ParseInt(getEnv("ANTI_CHEAT_MIN_SOLVE_TIME_MS", "1000"), 10, 64); err != nil || cfg.MinSolveTimeMs < 0 {
+		return cfg, fmt.Errorf("ANTI_CHEAT_MIN_SOLVE_TIME_MS must be a non-negative integer")
+	}
+	if cfg.ClearRateLimit, err = strconv.ParseInt(getEnv("ANTI_CHEAT_CLEAR_RATE_LIMIT", "60"), 10, 64); err != nil || cfg.ClearRateLimit < 0 {
+		return cfg, fmt.Errorf("ANTI_CHEAT_CLEAR_RATE_LIMIT must be a non-negative integer")
+	}
+	if cfg.ClearRateWindow, err = time.ParseDuration(getEnv("ANTI_CHEAT_CLEAR_RATE_WINDOW", "10m")); err != nil || cfg.ClearRateWindow <= 0 {
+		return cfg, fmt.Errorf("ANTI_CHEAT_CLEAR_RATE_WINDOW must be a positive duration (e.g. \"10m\")")
+	}
+	return cfg, nil
+}
+
+func loadRateLimitConfig() (RateLimitConfig, error) {
+	cfg := RateLimitConfig{Store: getEnv("RATE_LIMIT_STORE", "memory")}
+	if cfg.Store != "memory" && cfg.Store != "datastore" {
+		return cfg, fmt.Errorf("RATE_LIMIT_STORE must be \"memory\" or \"datastore\": %s", cfg.Store)
+	}
+	if proxies := getEnv("TRUSTED_PROXIES", ""); proxies != "" {
+		for _, proxy := range strings.Split(proxies, ",") {
+			cfg.TrustedProxies = append(cfg.TrustedProxies, strings.TrimSpace(proxy))
+		}
+	}
+
+	routes := []struct {
+		env          string
+		defaultValue string
+		limit        *RouteLimit
+	}{
+		{"RATE_LIMIT_CREATE_STAGE", "10/1h", &cfg.CreateStage},
+		{"RATE_LIMIT_CLEAR_STAGE", "60/1m", &cfg.ClearStage},
+		{"RATE_LIMIT_LOGIN", "20/1m", &cfg.Login},
+		{"RATE_LIMIT_SYNC", "10/1m", &cfg.Sync},
+	}
+	for _, route := range routes {
+		limit, err := parseRouteLimit(getEnv(route.env, route.defaultValue))
+		if err != nil {
+			return cfg, fmt.Errorf("%s: %w", route.env, err)
+		}
+		*route.limit = limit
+	}
+	return cfg, nil
+}
+
+func loadIdempotencyConfig() (IdempotencyConfig, error) {
+	cfg := IdempotencyConfig{Store: getEnv("IDEMPOTENCY_STORE", "datastore")}
+	if cfg.Store != "memory" && cfg.Store != "datastore" {
+		return cfg, fmt.Errorf("IDEMPOTENCY_STORE must be \"memory\" or \"datastore\": %s", cfg.Store)
+	}
+	ttl, err := time.ParseDuration(getEnv("IDEMPOTENCY_TTL", "24h"))
+	if err != nil || ttl <= 0 {
+		return cfg, fmt.Errorf("IDEMPOTENCY_TTL must be a positive duration (e.g. \"24h\")")
+	}
+	cfg.TTL = ttl
+	return cfg, nil
+}
+
+func loadActivityStreamConfig() (ActivityStreamConfig, error) {
+	cfg := ActivityStreamConfig{Broker: getEnv("ACTIVITY_STREAM_BROKER", "memory")}
+	if cfg.Broker != "memory" && cfg.Broker != "datastore" {
+		return cfg, fmt.Errorf("ACTIVITY_STREAM_BROKER must be \"memory\" or \"datastore\": %s", cfg.Broker)
+	}
+	var err error
+	if cfg.PollInterval, err = time.ParseDuration(getEnv("ACTIVITY_STREAM_POLL_INTERVAL", "2s")); err != nil || cfg.PollInterval <= 0 {
+		return cfg, fmt.Errorf("ACTIVITY_STREAM_POLL_INTERVAL must be a positive duration (e.g. \"2s\")")
+	}
+	if cfg.Heartbeat, err = time.ParseDuration(getEnv("ACTIVITY_STREAM_HEARTBEAT", "15s")); err != nil || cfg.Heartbeat <= 0 {
+		return cfg, fmt.Errorf("ACTIVITY_STREAM_HEARTBEAT must be a positive duration (e.g. \"15s\")")
+	}
+	return cfg, nil
+}
+
+func loadResponseCacheConfig() (ResponseCacheConfig, error) {
+	cfg := ResponseCacheConfig{
+		Store:         getEnv("RESPONSE_CACHE_STORE", "memory"),
+		RedisAddr:     getEnv("RESPONSE_CACHE_REDIS_ADDR", ""),
+		RedisPassword: getEnv("RESPONSE_CACHE_REDIS_PASSWORD", ""),
+	}
+	if cfg.Store != "memory" && cfg.Store != "redis" {
+		return cfg, fmt.Errorf("RESPONSE_CACHE_STORE must be \"memory\" or \"redis\": %s", cfg.Store)
+	}
+	if cfg.Store == "redis" && cfg.RedisAddr == "" {
+		return cfg, fmt.Errorf("RESPONSE_CACHE_REDIS_ADDR is required when RESPONSE_CACHE_STORE is \"redis\"")
+	}
+	var err error
+	if cfg.TTL, err = time.ParseDuration(getEnv("RESPONSE_CACHE_TTL", "60s")); err != nil || cfg.TTL <= 0 {
+		return cfg, fmt.Errorf("RESPONSE_CACHE_TTL must be a positive duration (e.g. \"60s\")")
+	}
+	if cfg.MaxEntries, err = strconv.Atoi(getEnv("RESPONSE_CACHE_MAX_ENTRIES", "1000")); err != nil || cfg.MaxEntries <= 0 {
+		return cfg, fmt.Errorf("RESPONSE_CACHE_MAX_ENTRIES must be a positive integer")
+	}
+	return cfg, nil
+}
+
+// parseRouteLimit parses a budget written as "<requests>/<duration>" (e.g. "60/1m"); "off" disables the limit
+func parseRouteLimit(value string) (RouteLimit, error) {
+	if value == "off" {
+		return RouteLimit{}, nil
+	}
+	requests, per, ok := strings.Cut(value, "/")
+	if !ok {
+		return RouteLimit{}, fmt.Errorf("must be \"<requests>/<duration>\" or \"off\": %s", value)
+	}
+	n, err := strconv.Atoi(requests)
+	if err != nil || n <= 0 {
+		return RouteLimit{}, fmt.Errorf("requests must be a positive integer: %s", value)
+	}
+	d, err := time.ParseDuration(per)
+	if err != nil || d <= 0 {
+		return RouteLimit{}, fmt.Errorf("duration must be positive (e.g. \"1m\"): %s", value)
+	}
+	return RouteLimit{Requests: n, Per: d}, nil
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
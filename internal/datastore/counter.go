@@ -0,0 +1,273 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/datastore"
+)
+
+const (
+	// DefaultCounterShards spreads a counter over enough entities for about 20 increments per second
+	DefaultCounterShards = 20
+	// counterCacheTTL is how long a counter read is served from memory
+	counterCacheTTL = 5 * time.Second
+	// maxCounterCacheEntries is the cache size above which expired entries are dropped
+	maxCounterCacheEntries = 10000
+	// counterBaseShard is the name of the shard holding the value a counter was seeded with
+	counterBaseShard = "base"
+	// stageClearShards is enough for the bursts of first clears of a single stage (e.g. the daily challenge)
+	// while keeping stage lists cheap to read
+	stageClearShards = 4
+)
+
+// ShardedCounter is a counter whose value is split over several CounterShard entities, so that
+// concurrent increments update different entities instead of contending on one (Datastore sustains
+// about one write per second per entity). Reads sum the shards.
+//
+// The number of shards may be increased at any time but never decreased, since the
+// shards above the new count would no longer be read.
+type ShardedCounter struct {
+	Name   string
+	Shards int
+}
+
+// CounterShard is one shard of a sharded counter (kind CounterShard, NameKey "<counter>/<shard>")
+type CounterShard struct {
+	Counter   string    `datastore:"counter"`
+	Count     int64     `datastore:"count,noindex"`
+	UpdatedAt time.Time `datastore:"updatedAt,noindex"`
+}
+
+// CounterValue is the sum of the shards of a counter
+type CounterValue struct {
+	Count     int64
+	UpdatedAt time.Time // latest update of any shard
+	Seeded    bool      // whether the base shard exists
+}
+
+// StageCounter counts the stages. It replaces the single KyouenPuzzleSummary entity.
+var StageCounter = ShardedCounter{Name: "stages", Shards: DefaultCounterShards}
+
+// StageClearCounter counts the users who cleared a stage
+func StageClearCounter(stageKey *datastore.Key) ShardedCounter {
+	return ShardedCounter{Name: "stage_clears/" + keyName(stageKey), Shards: stageClearShards}
+}
+
+func counterShardKey(counter, shard string) *datastore.Key {
+	return datastore.NameKey("CounterShard", counter+"/"+shard, nil)
+}
+
+// shardKeys returns the keys of every shard of the counter, base shard last
+func (c ShardedCounter) shardKeys() []*datastore.Key {
+	keys := make([]*datastore.Key, 0, c.Shards+1)
+	for i := 0; i < c.Shards; i++ {
+		keys = append(keys, counterShardKey(c.Name, strconv.Itoa(i)))
+	}
+	return append(keys, counterShardKey(c.Name, counterBaseShard))
+}
+
+// randomShardKey returns the key of one of the incremented shards (never the base shard)
+func (c ShardedCounter) randomShardKey() *datastore.Key {
+	return counterShardKey(c.Name, strconv.Itoa(rand.IntN(c.Shards)))
+}
+
+// sumCounterShards adds up the shards read with GetMulti; found reports which of them exist.
+// The base shard is the last one.
+func sumCounterShards(shards []CounterShard, found []bool) CounterValue {
+	var value CounterValue
+	for i, shard := range shards {
+		if !found[i] {
+			continue
+		}
+		value.Count += shard.Count
+		if shard.UpdatedAt.After(value.UpdatedAt) {
+			value.UpdatedAt = shard.UpdatedAt
+		}
+	}
+	value.Seeded = found[len(found)-1]
+	return value
+}
+
+// counterCache keeps recent counter reads so that hot read paths do not read every shard per request
+type counterCache struct {
+	mu      sync.Mutex
+	entries map[string]counterCacheEntry
+}
+
+type counterCacheEntry struct {
+	value     CounterValue
+	expiresAt time.Time
+}
+
+func (c *counterCache) get(name string, now time.Time) (CounterValue, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[name]
+	if !ok || now.After(entry.expiresAt) {
+		return CounterValue{}, false
+	}
+	return entry.value, true
+}
+
+func (c *counterCache) put(name string, value CounterValue, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.entries == nil {
+		c.entries = make(map[string]counterCacheEntry)
+	}
+	if len(c.entries) >= maxCounterCacheEntries {
+		for n, entry := range c.entries {
+			if now.After(entry.expiresAt) {
+				delete(c.entries, n)
+			}
+		}
+	}
+	c.entries[name] = counterCacheEntry{value: value, expiresAt: now.Add(counterCacheTTL)}
+}
+
+// add applies an increment made by this instance to the cached value, if any, so that it is visible immediately
+func (c *counterCache) add(name string, delta int64, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if entry, ok := c.entries[name]; ok {
+		entry.value.Count += delta
+		entry.value.UpdatedAt = now
+		c.entries[name] = entry
+	}
+}
+
+// invalidate drops the cached value of a counter
+func (c *counterCache) invalidate(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, name)
+}
+
+// IncrementCounter adds delta to a random shard of the counter
+func (s *DatastoreService) IncrementCounter(ctx context.Context, counter ShardedCounter, delta int64) error {
+	now := time.Now()
+	_, err := s.client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		return IncrementCounterInTransaction(tx, counter, delta, now)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to increment counter %s: %w", counter.Name, err)
+	}
+	s.counters.add(counter.Name, delta, now)
+	return nil
+}
+
+// IncrementCounterInTransaction adds delta to a random shard of the counter as part of tx,
+// so that the counter changes only if the rest of the transaction commits.
+// The increment is not reflected in cached reads until they expire.
+func IncrementCounterInTransaction(tx *datastore.Transaction, counter ShardedCounter, delta int64, now time.Time) error {
+	key := counter.randomShardKey()
+	shard := CounterShard{Counter: counter.Name}
+	if err := tx.Get(key, &shard); err != nil && err != datastore.ErrNoSuchEntity {
+		return fmt.Errorf("failed to get counter shard: %w", err)
+	}
+	shard.Count += delta
+	shard.UpdatedAt = now
+	if _, err := tx.Put(key, &shard); err != nil {
+		return fmt.Errorf("failed to save counter shard: %w", err)
+	}
+	return nil
+}
+
+// ReadCounter returns the sum of the counter's shards, served from memory for a few seconds after a read
+func (s *DatastoreService) ReadCounter(ctx context.Context, counter ShardedCounter) (CounterValue, error) {
+	values, err := s.ReadCounters(ctx, []ShardedCounter{counter})
+	if err != nil {
+		return CounterValue{}, err
+	}
+	return values[0], nil
+}
+
+// ReadCounters reads several counters at once, in the same order
+func (s *DatastoreService) ReadCounters(ctx context.Context, counters []ShardedCounter) ([]CounterValue, error) {
+	now := time.Now()
+	values := make([]CounterValue, len(counters))
+
+	// Read the shards of the counters missing from the cache in batched lookups
+	var keys []*datastore.Key
+	var missing []int
+	for i, counter := range counters {
+		if value, ok := s.counters.get(counter.Name, now); ok {
+			values[i] = value
+			continue
+		}
+		missing = append(missing, i)
+		keys = append(keys, counter.shardKeys()...)
+	}
+	shards := make([]CounterShard, len(keys))
+	found := make([]bool, len(keys))
+	for start := 0; start < len(keys); start += maxGetBatchSize {
+		end := min(start+maxGetBatchSize, len(keys))
+		err := s.client.GetMulti(ctx, keys[start:end], shards[start:end])
+		var multiErr datastore.MultiError
+		switch {
+		case err == nil:
+			for i := start; i < end; i++ {
+				found[i] = true
+			}
+		case errors.As(err, &multiErr):
+			for i, e := range multiErr {
+				if e != nil && e != datastore.ErrNoSuchEntity {
+					return nil, fmt.Errorf("failed to read counter shards: %w", e)
+				}
+				found[start+i] = e == nil
+			}
+		default:
+			return nil, fmt.Errorf("failed to read counter shards: %w", err)
+		}
+	}
+
+	offset := 0
+	for _, i := range missing {
+		n := counters[i].Shards + 1
+		values[i] = sumCounterShards(shards[offset:offset+n], found[offset:offset+n])
+		s.counters.put(counters[i].Name, values[i], now)
+		offset += n
+	}
+	return values, nil
+}
+
+// SeedCounter stores the part of the counter's value that predates its shards (e.g. the value of the
+// aggregate it replaces) in the base shard. It does nothing if the counter is already seeded,
+// so concurrent seeding is safe. It returns whether the base shard was created.
+func (s *DatastoreService) SeedCounter(ctx context.Context, counter ShardedCounter, base CounterValue) (bool, error) {
+	key := counterShardKey(counter.Name, counterBaseShard)
+	created := false
+	_, err := s.client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		created = false
+		var shard CounterShard
+		err := tx.Get(key, &shard)
+		if err == nil {
+			return nil
+		}
+		if err != datastore.ErrNoSuchEntity {
+			return fmt.Errorf("failed to get counter base shard: %w", err)
+		}
+		shard = CounterShard{Counter: counter.Name, Count: base.Count, UpdatedAt: base.UpdatedAt}
+		if _, err := tx.Put(key, &shard); err != nil {
+			return fmt.Errorf("failed to save counter base shard: %w", err)
+		}
+		created = true
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to seed counter %s: %w", counter.Name, err)
+	}
+	// The counter may have been seeded by this call or another instance; either way the cached value is stale
+	s.counters.invalidate(counter.Name)
+	return created, nil
+}
@@ -0,0 +1,67 @@
+package datastore
+
+import (
+	"testing"
+	"time"
+)
+
+func TestShardedCounterKeys(t *testing.T) {
+	counter := ShardedCounter{Name: "stages", Shards: 3}
+
+	keys := counter.shardKeys()
+	want := []string{"stages/0", "stages/1", "stages/2", "stages/base"}
+	if len(keys) != len(want) {
+		t.Fatalf("Expected %d keys, got %d", len(want), len(keys))
+	}
+	for i, key := range keys {
+		if key.Kind != "CounterShard" || key.Name != want[i] {
+			t.Errorf("Expected CounterShard %s, got %v", want[i], key)
+		}
+	}
+
+	for i := 0; i < 100; i++ {
+		if key := counter.randomShardKey(); key.Name == "stages/base" || key.Name == "stages/3" {
+			t.Fatalf("Expected an incremented shard, got %s", key.Name)
+		}
+	}
+}
+
+func TestSumCounterShards(t *testing.T) {
+	t1 := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Hour)
+	shards := []CounterShard{{Count: 2, UpdatedAt: t1}, {Count: 100}, {Count: 3, UpdatedAt: t2}, {Count: 10, UpdatedAt: t1}}
+
+	value := sumCounterShards(shards, []bool{true, false, true, true})
+	if value.Count != 15 || !value.UpdatedAt.Equal(t2) || !value.Seeded {
+		t.Errorf("Expected 15 updated at %v and seeded, got %+v", t2, value)
+	}
+
+	value = sumCounterShards(shards, []bool{true, false, true, false})
+	if value.Count != 5 || value.Seeded {
+		t.Errorf("Expected 5 and not seeded, got %+v", value)
+	}
+}
+
+func TestCounterCache(t *testing.T) {
+	var cache counterCache
+	now := time.Now()
+
+	cache.add("stages", 1, now)
+	if _, ok := cache.get("stages", now); ok {
+		t.Errorf("Expected no cached value before a read")
+	}
+
+	cache.put("stages", CounterValue{Count: 10, Seeded: true}, now)
+	cache.add("stages", 2, now)
+	if value, ok := cache.get("stages", now); !ok || value.Count != 12 {
+		t.Errorf("Expected a cached value of 12, got %+v (ok=%v)", value, ok)
+	}
+	if _, ok := cache.get("stages", now.Add(counterCacheTTL+time.Second)); ok {
+		t.Errorf("Expected the cached value to expire")
+	}
+
+	cache.invalidate("stages")
+	if _, ok := cache.get("stages", now); ok {
+		t.Errorf("Expected no cached value after invalidation")
+	}
+}
@@ -2,14 +2,40 @@ package datastore
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"cloud.google.com/go/datastore"
+	"google.golang.org/api/iterator"
+)
+
+// ErrInvalidCursor is returned when a page cursor cannot be decoded
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ErrUserNotFound is returned (wrapped) by GetUserByID when the user has no record
+var ErrUserNotFound = errors.New("user not found")
+
+// Datastore limits for batched operations
+const (
+	// maxGetBatchSize is the maximum number of keys in a single lookup
+	maxGetBatchSize = 1000
+	// maxPutBatchSize is the maximum number of entities in a single commit
+	maxPutBatchSize = 500
+	// maxInFilterValues is the maximum number of values of an "in" filter
+	maxInFilterValues = 30
 )
 
 type DatastoreService struct {
 	client *datastore.Client
+	// clearEventLog enables the append-only ClearEvent log
+	clearEventLog bool
+	// counters caches sharded counter reads
+	counters counterCache
 }
 
 func NewDatastoreService(projectID string) (*DatastoreService, error) {
@@ -21,6 +47,11 @@ func NewDatastoreService(projectID string) (*DatastoreService, error) {
 	return &DatastoreService{client: client}, nil
 }
 
+// SetClearEventLog enables or disables appending a ClearEvent for every clear
+func (s *DatastoreService) SetClearEventLog(enabled bool) {
+	s.clearEventLog = enabled
+}
+
 func (s *DatastoreService) Close() error {
 	return s.client.Close()
 }
@@ -31,25 +62,47 @@ func (s *DatastoreService) GetClient() *datastore.Client {
 }
 
 // Statistics operations
-func (s *DatastoreService) GetSummary(ctx context.Context) (*KyouenPuzzleSummary, error) {
-	key := datastore.IDKey("KyouenPuzzleSummary", 1, nil)
-	var summary KyouenPuzzleSummary
 
-	err := s.client.Get(ctx, key, &summary)
-	if err == datastore.ErrNoSuchEntity {
-		summary = KyouenPuzzleSummary{
-			Count:    0,
-			LastDate: time.Now(),
+// GetSummary returns the number of stages and when the last one was added, read from StageCounter.
+// The counter is seeded on first read (see seedStageCounter).
+func (s *DatastoreService) GetSummary(ctx context.Context) (*KyouenPuzzleSummary, error) {
+	value, err := s.ReadCounter(ctx, StageCounter)
+	if err != nil {
+		return nil, err
+	}
+	if !value.Seeded {
+		if err := s.seedStageCounter(ctx, value); err != nil {
+			return nil, err
 		}
-		_, err = s.client.Put(ctx, key, &summary)
+		if value, err = s.ReadCounter(ctx, StageCounter); err != nil {
+			return nil, err
+		}
+	}
+
+	return &KyouenPuzzleSummary{Count: value.Count, LastDate: value.UpdatedAt}, nil
+}
+
+// seedStageCounter seeds StageCounter from the legacy KyouenPuzzleSummary entity, which is no longer
+// updated once stages are counted by the shards. Without the legacy entity, the stages are counted,
+// minus the ones the shards have already counted.
+func (s *DatastoreService) seedStageCounter(ctx context.Context, shards CounterValue) error {
+	var base CounterValue
+	var legacy KyouenPuzzleSummary
+	err := s.client.Get(ctx, datastore.IDKey("KyouenPuzzleSummary", 1, nil), &legacy)
+	if err == nil {
+		base = CounterValue{Count: legacy.Count, UpdatedAt: legacy.LastDate}
+	} else if err == datastore.ErrNoSuchEntity {
+		count, err := s.client.Count(ctx, datastore.NewQuery("KyouenPuzzle").KeysOnly())
 		if err != nil {
-			return nil, fmt.Errorf("failed to create initial summary: %w", err)
+			return fmt.Errorf("failed to count stages: %w", err)
 		}
-	} else if err != nil {
-		return nil, fmt.Errorf("failed to get summary: %w", err)
+		base = CounterValue{Count: int64(count) - shards.Count, UpdatedAt: time.Now()}
+	} else {
+		return fmt.Errorf("failed to get summary: %w", err)
 	}
 
-	return &summary, nil
+	_, err = s.SeedCounter(ctx, StageCounter, base)
+	return err
 }
 
 // Stages operations
@@ -81,18 +134,18 @@ func (s *DatastoreService) GetClearedStageKeyIDs(ctx context.Context, userKey *d
 	return result, nil
 }
 
-func (s *DatastoreService) GetRecentStages(ctx context.Context, limit int) ([]KyouenPuzzle, error) {
+func (s *DatastoreService) GetRecentStages(ctx context.Context, limit int) ([]KyouenPuzzle, []*datastore.Key, error) {
 	var stages []KyouenPuzzle
 	query := datastore.NewQuery("KyouenPuzzle").
 		Order("-stageNo").
 		Limit(limit)
 
-	_, err := s.client.GetAll(ctx, query, &stages)
+	keys, err := s.client.GetAll(ctx, query, &stages)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get recent stages: %w", err)
+		return nil, nil, fmt.Errorf("failed to get recent stages: %w", err)
 	}
 
-	return stages, nil
+	return stages, keys, nil
 }
 
 func (s *DatastoreService) GetStageByNo(ctx context.Context, stageNo int) (*KyouenPuzzle, []*datastore.Key, error) {
@@ -111,6 +164,45 @@ func (s *DatastoreService) GetStageByNo(ctx context.Context, stageNo int) (*Kyou
 	return &stages[0], keys, nil
 }
 
+// GetStageKeysByNos resolves stage numbers to stage keys with "in" queries,
+// running at most concurrency queries at a time.
+// Stage numbers that do not exist are absent from the result.
+func (s *DatastoreService) GetStageKeysByNos(ctx context.Context, stageNos []int64, concurrency int) (map[int64]*datastore.Key, error) {
+	result := make(map[int64]*datastore.Key, len(stageNos))
+	var mu sync.Mutex
+	var firstErr error
+
+	chunks := chunkCount(len(stageNos), maxInFilterValues)
+	runBounded(chunks, concurrency, func(i int) {
+		chunk := stageNos[i*maxInFilterValues : min((i+1)*maxInFilterValues, len(stageNos))]
+		values := make([]interface{}, len(chunk))
+		for j, no := range chunk {
+			values[j] = no
+		}
+
+		var stages []KyouenPuzzle
+		query := datastore.NewQuery("KyouenPuzzle").FilterField("stageNo", "in", values)
+		keys, err := s.client.GetAll(ctx, query, &stages)
+
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("failed to get stages by numbers: %w", err)
+			}
+			return
+		}
+		for j := range stages {
+			result[stages[j].StageNo] = keys[j]
+		}
+	})
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	return result, nil
+}
+
 func (s *DatastoreService) CreateStage(ctx context.Context, stage KyouenPuzzle) (*KyouenPuzzle, error) {
 	nextStageNo, err := s.getNextStageNo(ctx)
 	if err != nil {
@@ -132,7 +224,7 @@ func (s *DatastoreService) CreateStage(ctx context.Context, stage KyouenPuzzle)
 	}
 
 	// Log error but don't fail the creation
-	if err := s.updateSummary(ctx); err != nil {
+	if err := s.IncrementCounter(ctx, StageCounter, 1); err != nil {
 		fmt.Printf("Warning: failed to update summary: %v\n", err)
 	}
 
@@ -164,36 +256,6 @@ func (s *DatastoreService) CheckStageExists(ctx context.Context, stageString str
 	return count > 0, nil
 }
 
-func (s *DatastoreService) updateSummary(ctx context.Context) error {
-	key := datastore.IDKey("KyouenPuzzleSummary", 1, nil)
-
-	_, err := s.client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
-		var summary KyouenPuzzleSummary
-		err := tx.Get(key, &summary)
-		if err == datastore.ErrNoSuchEntity {
-			query := datastore.NewQuery("KyouenPuzzle").KeysOnly()
-			count, err := s.client.Count(ctx, query)
-			if err != nil {
-				return fmt.Errorf("failed to count stages: %w", err)
-			}
-			summary = KyouenPuzzleSummary{
-				Count:    int64(count),
-				LastDate: time.Now(),
-			}
-		} else if err != nil {
-			return fmt.Errorf("failed to get summary: %w", err)
-		} else {
-			summary.Count++
-			summary.LastDate = time.Now()
-		}
-
-		_, err = tx.Put(key, &summary)
-		return err
-	})
-
-	return err
-}
-
 // Users operations
 func (s *DatastoreService) GetUserByID(ctx context.Context, userID string) (*User, *datastore.Key, error) {
 	key := datastore.NameKey("User", "KEY"+userID, nil)
@@ -201,7 +263,7 @@ func (s *DatastoreService) GetUserByID(ctx context.Context, userID string) (*Use
 
 	err := s.client.Get(ctx, key, &user)
 	if err == datastore.ErrNoSuchEntity {
-		return nil, nil, fmt.Errorf("user not found: %s", userID)
+		return nil, nil, fmt.Errorf("%w: %s", ErrUserNotFound, userID)
 	} else if err != nil {
 		return nil, nil, fmt.Errorf("failed to get user: %w", err)
 	}
@@ -220,7 +282,7 @@ func (s *DatastoreService) UpsertUser(ctx context.Context, user User, userID str
 
 // MigrateLegacyUser migrates a legacy Python-era user (keyed by Twitter UID) to a new Firebase UID-based key.
 // It preserves clearStageCount, records the migration in UserMigration, and re-points StageUser records.
-func (s *DatastoreService) MigrateLegacyUser(ctx context.Context, firebaseUID, screenName, image, twitterUID string) (*User, error) {
+func (s *DatastoreService) MigrateLegacyUser(ctx context.Context, firebaseUID, screenName, image, twitterUID string, providers []string) (*User, error) {
 	oldKey := datastore.NameKey("User", "KEY"+twitterUID, nil)
 	newKey := datastore.NameKey("User", "KEY"+firebaseUID, nil)
 
@@ -237,6 +299,7 @@ func (s *DatastoreService) MigrateLegacyUser(ctx context.Context, firebaseUID, s
 			ScreenName:      screenName,
 			Image:           image,
 			TwitterUID:      twitterUID,
+			Providers:       providers,
 			ClearStageCount: oldUser.ClearStageCount,
 		}
 		if _, err := tx.Put(newKey, &migratedUser); err != nil {
@@ -272,25 +335,125 @@ func (s *DatastoreService) MigrateLegacyUser(ctx context.Context, firebaseUID, s
 }
 
 // migrateStageUserRecords updates StageUser records that reference the old user key to point to the new key.
-func (s *DatastoreService) migrateStageUserRecords(ctx context.Context, oldUserKey, newUserKey *datastore.Key) {
+// Records for stages the new user has already cleared are deleted instead, so no duplicates are created.
+// The first clears and the ClearEvent log of the old user are moved to the new key as well.
+// It returns the number of records that were re-pointed.
+func (s *DatastoreService) migrateStageUserRecords(ctx context.Context, oldUserKey, newUserKey *datastore.Key) int {
 	query := datastore.NewQuery("StageUser").FilterField("user", "=", oldUserKey)
 	var stageUsers []StageUser
 	keys, err := s.client.GetAll(ctx, query, &stageUsers)
 	if err != nil {
 		fmt.Printf("Warning: failed to query StageUser records for migration: %v\n", err)
-		return
+		return 0
+	}
+
+	var existing []StageUser
+	existingKeys, err := s.client.GetAll(ctx, datastore.NewQuery("StageUser").FilterField("user", "=", newUserKey), &existing)
+	if err != nil {
+		fmt.Printf("Warning: failed to query StageUser records of new user for migration: %v\n", err)
+		return 0
+	}
+	clearedStages := make(map[string]int, len(existing))
+	for i, su := range existing {
+		clearedStages[su.StageKey.String()] = i
 	}
 
+	migrated := 0
 	for i := range stageUsers {
+		if j, ok := clearedStages[stageUsers[i].StageKey.String()]; ok {
+			// Both users cleared the stage: keep one record with the combined clear history
+			if j >= 0 {
+				existing[j].merge(stageUsers[i])
+				if _, err := s.client.Put(ctx, existingKeys[j], &existing[j]); err != nil {
+					fmt.Printf("Warning: failed to merge StageUser record %v: %v\n", existingKeys[j], err)
+				}
+			}
+			if err := s.client.Delete(ctx, keys[i]); err != nil {
+				fmt.Printf("Warning: failed to delete duplicate StageUser record %v: %v\n", keys[i], err)
+			} else if err := s.IncrementCounter(ctx, StageClearCounter(stageUsers[i].StageKey), -1); err != nil {
+				fmt.Printf("Warning: failed to update stage clear counter: %v\n", err)
+			}
+			continue
+		}
+
+		// StageUser keys are derived from the user key, so the record is re-created under the new key
 		stageUsers[i].UserKey = newUserKey
-		if _, err := s.client.Put(ctx, keys[i], &stageUsers[i]); err != nil {
+		if _, err := s.client.Put(ctx, StageUserKey(stageUsers[i].StageKey, newUserKey), &stageUsers[i]); err != nil {
 			fmt.Printf("Warning: failed to migrate StageUser record %v: %v\n", keys[i], err)
+			continue
+		}
+		if err := s.client.Delete(ctx, keys[i]); err != nil {
+			fmt.Printf("Warning: failed to delete migrated StageUser record %v: %v\n", keys[i], err)
+		}
+		clearedStages[stageUsers[i].StageKey.String()] = -1
+		migrated++
+	}
+
+	stageKeys := make([]*datastore.Key, len(stageUsers))
+	for i, su := range stageUsers {
+		stageKeys[i] = su.StageKey
+	}
+	if err := s.moveFirstClears(ctx, stageKeys, oldUserKey, newUserKey); err != nil {
+		fmt.Printf("Warning: failed to migrate first clears: %v\n", err)
+	}
+	if err := s.moveClearEvents(ctx, oldUserKey, newUserKey); err != nil {
+		fmt.Printf("Warning: failed to migrate ClearEvent records: %v\n", err)
+	}
+	return migrated
+}
+
+// moveClearEvents re-points the ClearEvent records of the old user to the new user
+func (s *DatastoreService) moveClearEvents(ctx context.Context, oldUserKey, newUserKey *datastore.Key) error {
+	query := datastore.NewQuery("ClearEvent").FilterField("user", "=", oldUserKey)
+	var events []ClearEvent
+	keys, err := s.client.GetAll(ctx, query, &events)
+	if err != nil {
+		return fmt.Errorf("failed to get ClearEvent records: %w", err)
+	}
+	for i := range events {
+		events[i].UserKey = newUserKey
+	}
+	for start := 0; start < len(keys); start += maxPutBatchSize {
+		end := min(start+maxPutBatchSize, len(keys))
+		if _, err := s.client.PutMulti(ctx, keys[start:end], events[start:end]); err != nil {
+			return fmt.Errorf("failed to update ClearEvent records: %w", err)
+		}
+	}
+	return nil
+}
+
+// moveFirstClears credits the first clears of the old user on the given stages to the new user
+func (s *DatastoreService) moveFirstClears(ctx context.Context, stageKeys []*datastore.Key, oldUserKey, newUserKey *datastore.Key) error {
+	stages, err := s.GetStagesByKeys(ctx, stageKeys)
+	if err != nil {
+		return err
+	}
+	for i, stage := range stages {
+		if stage.FirstClearedBy == nil || !stage.FirstClearedBy.Equal(oldUserKey) {
+			continue
+		}
+		_, err := s.client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+			var stage KyouenPuzzle
+			if err := tx.Get(stageKeys[i], &stage); err != nil {
+				return err
+			}
+			if stage.FirstClearedBy == nil || !stage.FirstClearedBy.Equal(oldUserKey) {
+				return nil
+			}
+			stage.FirstClearedBy = newUserKey
+			_, err := tx.Put(stageKeys[i], &stage)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to update first clear of stage %d: %w", stage.StageNo, err)
 		}
 	}
+	return nil
 }
 
-// CreateOrUpdateUserFromFirebase creates or updates a user from Firebase authentication data
-func (s *DatastoreService) CreateOrUpdateUserFromFirebase(ctx context.Context, firebaseUID, screenName, image, twitterUID string) (*User, error) {
+// CreateOrUpdateUserFromFirebase creates or updates a user from Firebase authentication data.
+// providers is the list of sign-in providers currently linked to the account; an empty list keeps the stored one.
+func (s *DatastoreService) CreateOrUpdateUserFromFirebase(ctx context.Context, firebaseUID, screenName, image, twitterUID string, providers []string) (*User, error) {
 	existingUser, _, err := s.GetUserByID(ctx, firebaseUID)
 	if err != nil {
 		// Firebase UID でユーザーが見つからない場合、レガシーユーザー（Twitter UID キー）を検索
@@ -298,7 +461,7 @@ func (s *DatastoreService) CreateOrUpdateUserFromFirebase(ctx context.Context, f
 			legacyUser, _, legacyErr := s.GetUserByID(ctx, twitterUID)
 			if legacyErr == nil && legacyUser != nil {
 				// Python時代のユーザーが見つかった → マイグレーション実行
-				return s.MigrateLegacyUser(ctx, firebaseUID, screenName, image, twitterUID)
+				return s.MigrateLegacyUser(ctx, firebaseUID, screenName, image, twitterUID, providers)
 			}
 		}
 
@@ -307,6 +470,7 @@ func (s *DatastoreService) CreateOrUpdateUserFromFirebase(ctx context.Context, f
 			ScreenName:      screenName,
 			Image:           image,
 			TwitterUID:      twitterUID,
+			Providers:       providers,
 			ClearStageCount: 0,
 		}
 		return s.UpsertUser(ctx, newUser, firebaseUID)
@@ -325,6 +489,10 @@ func (s *DatastoreService) CreateOrUpdateUserFromFirebase(ctx context.Context, f
 		existingUser.TwitterUID = twitterUID
 		updated = true
 	}
+	if len(providers) > 0 && !equalStrings(existingUser.Providers, providers) {
+		existingUser.Providers = providers
+		updated = true
+	}
 
 	if updated {
 		return s.UpsertUser(ctx, *existingUser, firebaseUID)
@@ -360,158 +528,813 @@ func (s *DatastoreService) GetOrCreateGuestUser(ctx context.Context) (*User, *da
 	return existingUser, key, nil
 }
 
-// StageUser operations
-func (s *DatastoreService) CreateStageUser(ctx context.Context, stageKey *datastore.Key, userKey *datastore.Key) error {
-	var stageUsers []StageUser
-	query := datastore.NewQuery("StageUser").
-		FilterField("stage", "=", stageKey).
-		FilterField("user", "=", userKey).
-		Limit(1)
+// GetOrCreateAnonymousUser gets or creates the per-device anonymous user for the given UID
+func (s *DatastoreService) GetOrCreateAnonymousUser(ctx context.Context, anonymousUID string) (*User, *datastore.Key, error) {
+	existingUser, key, err := s.GetUserByID(ctx, anonymousUID)
+	if err == nil {
+		return existingUser, key, nil
+	}
 
-	keys, err := s.client.GetAll(ctx, query, &stageUsers)
+	anonymousUser := User{
+		UserID:          anonymousUID,
+		ScreenName:      "Guest",
+		Image:           "https://kyouen.app/image/icon.png",
+		ClearStageCount: 0,
+	}
+	user, err := s.UpsertUser(ctx, anonymousUser, anonymousUID)
 	if err != nil {
-		return fmt.Errorf("failed to check existing StageUser: %w", err)
+		return nil, nil, fmt.Errorf("failed to create anonymous user: %w", err)
 	}
 
-	if len(stageUsers) == 0 {
-		stageUser := StageUser{
-			StageKey:  stageKey,
-			UserKey:   userKey,
-			ClearDate: time.Now(),
+	return user, datastore.NameKey("User", "KEY"+anonymousUID, nil), nil
+}
+
+// MergeAnonymousUser moves the clear history of a per-device anonymous user into a signed-in user
+// and deletes the anonymous user. It returns the number of StageUser records that were moved.
+// A missing anonymous user is not an error (the device has not cleared anything yet).
+func (s *DatastoreService) MergeAnonymousUser(ctx context.Context, anonymousUID, userID string) (int, error) {
+	_, migrated, err := s.MergeUsers(ctx, anonymousUID, userID)
+	return migrated, err
+}
+
+// MergeUsers merges the source user into the target user (account linking).
+// The StageUser history and ClearEvent log of the source are re-pointed to the target (stages cleared by both are kept once),
+// linked providers are combined, profile fields missing on the target are taken from the source,
+// and the source user is deleted with the merge recorded in UserMigration.
+// It returns the merged target user and the number of StageUser records that were moved.
+// A missing source user is not an error; the target is returned unchanged.
+func (s *DatastoreService) MergeUsers(ctx context.Context, sourceUID, targetUID string) (*User, int, error) {
+	sourceKey := datastore.NameKey("User", "KEY"+sourceUID, nil)
+	targetKey := datastore.NameKey("User", "KEY"+targetUID, nil)
+
+	var sourceUser User
+	if err := s.client.Get(ctx, sourceKey, &sourceUser); err != nil {
+		if err == datastore.ErrNoSuchEntity {
+			targetUser, _, err := s.GetUserByID(ctx, targetUID)
+			return targetUser, 0, err
 		}
-		key := datastore.IncompleteKey("StageUser", nil)
-		_, err = s.client.Put(ctx, key, &stageUser)
-		if err != nil {
-			return fmt.Errorf("failed to create StageUser: %w", err)
+		return nil, 0, fmt.Errorf("failed to get source user: %w", err)
+	}
+
+	// StageUser レコードのキーを更新（トランザクション外: 25エンティティグループ制限のため）
+	migrated := s.migrateStageUserRecords(ctx, sourceKey, targetKey)
+
+	var mergedUser User
+	_, err := s.client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		var user User
+		if err := tx.Get(targetKey, &user); err != nil {
+			return fmt.Errorf("failed to get target user: %w", err)
 		}
-	} else {
-		stageUsers[0].ClearDate = time.Now()
-		_, err = s.client.Put(ctx, keys[0], &stageUsers[0])
-		if err != nil {
-			return fmt.Errorf("failed to update StageUser: %w", err)
+		user.ClearStageCount += int64(migrated)
+		user.Providers = unionStrings(user.Providers, sourceUser.Providers)
+		if user.TwitterUID == "" {
+			user.TwitterUID = sourceUser.TwitterUID
+		}
+		if user.ScreenName == "" {
+			user.ScreenName = sourceUser.ScreenName
+		}
+		if user.Image == "" {
+			user.Image = sourceUser.Image
+		}
+		// Linking an account must not shed a suspicious flag
+		if sourceUser.Suspicious && !user.Suspicious {
+			user.Suspicious = true
+			user.SuspiciousReason = sourceUser.SuspiciousReason
+			user.FlaggedAt = sourceUser.FlaggedAt
+		}
+		if _, err := tx.Put(targetKey, &user); err != nil {
+			return fmt.Errorf("failed to update target user: %w", err)
+		}
+		mergedUser = user
+
+		migration := UserMigration{
+			OldKey:      "KEY" + sourceUID,
+			NewKey:      "KEY" + targetUID,
+			TwitterUID:  sourceUser.TwitterUID,
+			FirebaseUID: targetUID,
+			MigratedAt:  time.Now(),
+		}
+		if _, err := tx.Put(datastore.IncompleteKey("UserMigration", nil), &migration); err != nil {
+			return fmt.Errorf("failed to save UserMigration record: %w", err)
+		}
+
+		if err := tx.Delete(sourceKey); err != nil {
+			return fmt.Errorf("failed to delete source user: %w", err)
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, migrated, fmt.Errorf("failed to merge users: %w", err)
 	}
 
-	return nil
+	return &mergedUser, migrated, nil
 }
 
-// HasStageUser checks if a stage user relation exists
-func (s *DatastoreService) HasStageUser(ctx context.Context, stageKey *datastore.Key, userKey *datastore.Key) (bool, error) {
-	query := datastore.NewQuery("StageUser").
-		FilterField("stage", "=", stageKey).
-		FilterField("user", "=", userKey).
-		Limit(1)
+// ClearRateLimit bounds the clears a user may submit in a fixed window; a zero Limit disables it
+type ClearRateLimit struct {
+	Limit  int64
+	Window time.Duration
+}
 
-	var stageUsers []StageUser
-	_, err := s.client.GetAll(ctx, query, &stageUsers)
-	if err != nil {
-		return false, fmt.Errorf("failed to check StageUser existence: %w", err)
-	}
+// ClearRateExceededError is returned by CreateStageUser when a clear exceeds the user's rate limit.
+// Nothing is recorded, so the window stays full until WindowEnd.
+type ClearRateExceededError struct {
+	WindowEnd time.Time
+}
 
-	return len(stageUsers) > 0, nil
+func (e *ClearRateExceededError) Error() string {
+	return fmt.Sprintf("clear rate limit exceeded until %v", e.WindowEnd)
 }
 
-// GetClearedStagesByUser gets all cleared stages for a user
-func (s *DatastoreService) GetClearedStagesByUser(ctx context.Context, userKey *datastore.Key) ([]StageUser, error) {
-	query := datastore.NewQuery("StageUser").
-		FilterField("user", "=", userKey).
-		Order("clearDate")
+// countClearAttempt counts a clear submission in the user's fixed rate window,
+// returning a ClearRateExceededError if it exceeds the limit
+func countClearAttempt(user *User, rate ClearRateLimit, now time.Time) error {
+	if !now.Before(user.ClearWindowStart.Add(rate.Window)) {
+		user.ClearWindowStart = now
+		user.ClearWindowCount = 0
+	}
+	user.ClearWindowCount++
+	if user.ClearWindowCount > rate.Limit {
+		return &ClearRateExceededError{WindowEnd: user.ClearWindowStart.Add(rate.Window)}
+	}
+	return nil
+}
 
-	var stageUsers []StageUser
-	_, err := s.client.GetAll(ctx, query, &stageUsers)
+// FlagUser marks the user as suspicious. It returns false if the user was already flagged,
+// in which case the original reason and date are kept.
+func (s *DatastoreService) FlagUser(ctx context.Context, userKey *datastore.Key, reason string) (bool, error) {
+	flagged := false
+
+	_, err := s.client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		var user User
+		if err := tx.Get(userKey, &user); err != nil {
+			return fmt.Errorf("failed to get user: %w", err)
+		}
+		if user.Suspicious {
+			return nil
+		}
+		user.Suspicious = true
+		user.SuspiciousReason = reason
+		user.FlaggedAt = time.Now()
+		if _, err := tx.Put(userKey, &user); err != nil {
+			return fmt.Errorf("failed to update user: %w", err)
+		}
+		flagged = true
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to get cleared stages: %w", err)
+		return false, fmt.Errorf("failed to flag user: %w", err)
 	}
 
-	return stageUsers, nil
+	return flagged, nil
 }
 
-func (s *DatastoreService) IncrementUserClearCount(ctx context.Context, userKey *datastore.Key) error {
+// UnflagUser clears the suspicious flag of a user after review
+func (s *DatastoreService) UnflagUser(ctx context.Context, userKey *datastore.Key) error {
 	_, err := s.client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
 		var user User
-		err := tx.Get(userKey, &user)
-		if err != nil {
+		if err := tx.Get(userKey, &user); err != nil {
 			return fmt.Errorf("failed to get user: %w", err)
 		}
+		user.Suspicious = false
+		user.SuspiciousReason = ""
+		user.FlaggedAt = time.Time{}
+		if _, err := tx.Put(userKey, &user); err != nil {
+			return fmt.Errorf("failed to update user: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to unflag user: %w", err)
+	}
+	return nil
+}
 
-		user.ClearStageCount++
-		_, err = tx.Put(userKey, &user)
-		return err
+// GetSuspiciousUsers gets all users flagged as suspicious, oldest flag first
+func (s *DatastoreService) GetSuspiciousUsers(ctx context.Context) ([]User, error) {
+	var users []User
+	query := datastore.NewQuery("User").FilterField("suspicious", "=", true)
+
+	if _, err := s.client.GetAll(ctx, query, &users); err != nil {
+		return nil, fmt.Errorf("failed to get suspicious users: %w", err)
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].FlaggedAt.Before(users[j].FlaggedAt)
 	})
+	return users, nil
+}
 
-	return err
+// StageUser operations
+
+// StageUserKey returns the deterministic key of the StageUser record of a stage and a user,
+// so that recording the same clear again writes the same entity instead of a duplicate.
+func StageUserKey(stageKey, userKey *datastore.Key) *datastore.Key {
+	return datastore.NameKey("StageUser", keyName(stageKey)+"/"+keyName(userKey), nil)
 }
 
-// DeleteUser deletes a user and all associated data from Datastore
-func (s *DatastoreService) DeleteUser(ctx context.Context, userID string) error {
-	userKey := datastore.NameKey("User", "KEY"+userID, nil)
-	var user User
-	err := s.client.Get(ctx, userKey, &user)
+// keyName returns the name of a key, or its numeric ID as a string
+func keyName(key *datastore.Key) string {
+	if key.Name != "" {
+		return key.Name
+	}
+	return strconv.FormatInt(key.ID, 10)
+}
+
+// findLegacyStageUserKey returns the key of the user's record of the stage saved under an auto-allocated key
+// before the deterministic keys (ADR 005), or nil if the record has its deterministic key or does not exist.
+// Such records remain until cmd/migrate_stage_user has been applied.
+func (s *DatastoreService) findLegacyStageUserKey(ctx context.Context, stageKey, userKey *datastore.Key) (*datastore.Key, error) {
+	key := StageUserKey(stageKey, userKey)
+	var stageUser StageUser
+	err := s.client.Get(ctx, key, &stageUser)
+	if err == nil {
+		return nil, nil
+	}
+	if err != datastore.ErrNoSuchEntity {
+		return nil, fmt.Errorf("failed to check existing StageUser: %w", err)
+	}
+
+	// Non-ancestor queries cannot run in a transaction, so the legacy record is looked up beforehand
+	query := datastore.NewQuery("StageUser").
+		FilterField("stage", "=", stageKey).
+		FilterField("user", "=", userKey).
+		KeysOnly()
+	keys, err := s.client.GetAll(ctx, query, nil)
 	if err != nil {
-		if err == datastore.ErrNoSuchEntity {
-			return fmt.Errorf("user not found: %s", userID)
+		return nil, fmt.Errorf("failed to find legacy StageUser: %w", err)
+	}
+	for _, k := range keys {
+		if !k.Equal(key) {
+			return k, nil
 		}
-		return fmt.Errorf("failed to get user: %w", err)
 	}
+	return nil, nil
+}
 
-	// TODO: Add audit log for user account deletion (required for compliance)
+// CreateStageUser records that the user cleared the stage.
+// A new record increments the user's clearStageCount and the stage's clear counter in the same transaction,
+// and makes the user the stage's first clearer if nobody cleared it before;
+// clearing an already cleared stage keeps the first clear date and details,
+// and updates the last clear date, clear count and fastest solve time.
+// A record still under a legacy auto-allocated key counts as existing and is moved to its deterministic key.
+// The clear is counted in the user's rate window in the same transaction; beyond the limit nothing is recorded
+// and a ClearRateExceededError is returned.
+func (s *DatastoreService) CreateStageUser(ctx context.Context, stageKey *datastore.Key, userKey *datastore.Key, details ClearDetails, rate ClearRateLimit) error {
+	key := StageUserKey(stageKey, userKey)
+	now := time.Now()
+	created := false
+
+	legacyKey, err := s.findLegacyStageUserKey(ctx, stageKey, userKey)
+	if err != nil {
+		return err
+	}
 
 	_, err = s.client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
-		query := datastore.NewQuery("StageUser").FilterField("user", "=", userKey)
-		keys, err := s.client.GetAll(ctx, query, &[]StageUser{})
-		if err != nil {
-			return fmt.Errorf("failed to get StageUser records: %w", err)
+		var user User
+		userLoaded := false
+		if rate.Limit > 0 {
+			if err := tx.Get(userKey, &user); err != nil {
+				return fmt.Errorf("failed to get user: %w", err)
+			}
+			userLoaded = true
+			if err := countClearAttempt(&user, rate, now); err != nil {
+				return err
+			}
 		}
 
-		if len(keys) > 0 {
-			err = tx.DeleteMulti(keys)
-			if err != nil {
-				return fmt.Errorf("failed to delete StageUser records: %w", err)
+		var stageUser StageUser
+		err := tx.Get(key, &stageUser)
+		if err == datastore.ErrNoSuchEntity && legacyKey != nil {
+			if err = tx.Get(legacyKey, &stageUser); err == nil {
+				if err := tx.Delete(legacyKey); err != nil {
+					return fmt.Errorf("failed to delete legacy StageUser: %w", err)
+				}
 			}
 		}
-
-		// Anonymize creator field in KyouenPuzzle entities created by this user
-		stageQuery := datastore.NewQuery("KyouenPuzzle").FilterField("creator", "=", user.ScreenName)
-		var stages []KyouenPuzzle
-		stageKeys, err := s.client.GetAll(ctx, stageQuery, &stages)
-		if err != nil {
-			return fmt.Errorf("failed to get user's stages: %w", err)
+		if err != nil && err != datastore.ErrNoSuchEntity {
+			return fmt.Errorf("failed to check existing StageUser: %w", err)
 		}
-
-		for i, stage := range stages {
-			stage.Creator = "[deleted user]"
-			_, err = tx.Put(stageKeys[i], &stage)
-			if err != nil {
-				return fmt.Errorf("failed to anonymize stage creator: %w", err)
+		created = err == datastore.ErrNoSuchEntity
+
+		if created {
+			stageUser = StageUser{
+				StageKey:      stageKey,
+				UserKey:       userKey,
+				ClearDate:     now,
+				LastClearDate: now,
+				ClearCount:    1,
 			}
+			stageUser.applyFirstClear(details)
+		} else {
+			stageUser.ClearCount = stageUser.Clears() + 1
+			stageUser.LastClearDate = now
+			stageUser.applyReclear(details)
+		}
+		if _, err := tx.Put(key, &stageUser); err != nil {
+			return fmt.Errorf("failed to save StageUser: %w", err)
 		}
 
-		err = tx.Delete(userKey)
-		if err != nil {
-			return fmt.Errorf("failed to delete user: %w", err)
+		if s.clearEventLog {
+			event := ClearEvent{
+				StageKey:    stageKey,
+				UserKey:     userKey,
+				ClearDate:   now,
+				FirstClear:  created,
+				Source:      ClearSourceClear,
+				SolveTimeMs: details.SolveTimeMs,
+				Attempts:    details.Attempts,
+				HintsUsed:   details.HintsUsed,
+				Shape:       details.Shape,
+			}
+			if _, err := tx.Put(datastore.IncompleteKey("ClearEvent", nil), &event); err != nil {
+				return fmt.Errorf("failed to append ClearEvent: %w", err)
+			}
 		}
 
-		return nil
+		if created {
+			if !userLoaded {
+				if err := tx.Get(userKey, &user); err != nil {
+					return fmt.Errorf("failed to get user: %w", err)
+				}
+				userLoaded = true
+			}
+			user.ClearStageCount++
+		}
+		if userLoaded {
+			if _, err := tx.Put(userKey, &user); err != nil {
+				return fmt.Errorf("failed to update user: %w", err)
+			}
+		}
+		if !created {
+			return nil
+		}
+		return IncrementCounterInTransaction(tx, StageClearCounter(stageKey), 1, now)
 	})
+	if err != nil {
+		return err
+	}
 
-	return err
+	if created {
+		// Log error but don't fail the clear
+		if err := s.recordFirstClears(ctx, []StageUser{{StageKey: stageKey, UserKey: userKey, ClearDate: now}}); err != nil {
+			fmt.Printf("Warning: failed to record first clear: %v\n", err)
+		}
+	}
+	return nil
 }
 
-// GetRecentActivities gets recent user activities (stage completions)
-func (s *DatastoreService) GetRecentActivities(ctx context.Context, limit int) ([]StageUser, error) {
+// PutStageUsers creates the StageUser records (first clears) that do not exist yet under their deterministic keys,
+// running at most concurrency batches at a time. Each batch gets and puts its missing records in one transaction,
+// so a record written meanwhile by a clear or another sync is kept; stageUsers[i] is then replaced with the stored record.
+// It returns one error per record (nil on success) so that callers can report partial failures.
+// The stage clear counters count only the records created. Synced clears never become a stage's first clear,
+// since their dates come from the client. The users' clearStageCount is not updated; call RefreshUserClearCount afterwards.
+// When the clear event log is enabled, a "sync" ClearEvent is appended for every record created.
+func (s *DatastoreService) PutStageUsers(ctx context.Context, stageUsers []StageUser, concurrency int) []error {
+	errs := make([]error, len(stageUsers))
+	created := make([]bool, len(stageUsers))
+
+	runBounded(chunkCount(len(stageUsers), maxPutBatchSize), concurrency, func(i int) {
+		start := i * maxPutBatchSize
+		end := min(start+maxPutBatchSize, len(stageUsers))
+
+		keys := make([]*datastore.Key, end-start)
+		for j := range keys {
+			keys[j] = StageUserKey(stageUsers[start+j].StageKey, stageUsers[start+j].UserKey)
+		}
+
+		batch := stageUsers[start:end]
+		for j := range batch {
+			batch[j].LastClearDate = batch[j].ClearDate
+			batch[j].ClearCount = 1
+		}
+
+		var stored []StageUser
+		var missing []int
+		_, err := s.client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+			stored = make([]StageUser, len(keys))
+			missing = missing[:0]
+			if err := tx.GetMulti(keys, stored); err != nil {
+				merr, ok := err.(datastore.MultiError)
+				if !ok {
+					return err
+				}
+				for j, e := range merr {
+					switch e {
+					case nil:
+					case datastore.ErrNoSuchEntity:
+						missing = append(missing, j)
+					default:
+						return e
+					}
+				}
+			}
+			if len(missing) == 0 {
+				return nil
+			}
+
+			putKeys := make([]*datastore.Key, len(missing))
+			records := make([]StageUser, len(missing))
+			for n, j := range missing {
+				putKeys[n] = keys[j]
+				records[n] = batch[j]
+			}
+			_, err := tx.PutMulti(putKeys, records)
+			return err
+		})
+		if err != nil {
+			for j := start; j < end; j++ {
+				errs[j] = fmt.Errorf("failed to create StageUser: %w", err)
+			}
+			return
+		}
+
+		isMissing := make([]bool, len(batch))
+		for _, j := range missing {
+			isMissing[j] = true
+			created[start+j] = true
+		}
+		for j := range batch {
+			if !isMissing[j] {
+				batch[j] = stored[j]
+			}
+		}
+
+		if !s.clearEventLog {
+			return
+		}
+		events := make([]ClearEvent, len(missing))
+		for n, j := range missing {
+			events[n] = ClearEvent{
+				StageKey:   batch[j].StageKey,
+				UserKey:    batch[j].UserKey,
+				ClearDate:  batch[j].ClearDate,
+				FirstClear: true,
+				Source:     ClearSourceSync,
+			}
+		}
+		if err := s.appendClearEvents(ctx, events); err != nil {
+			fmt.Printf("Warning: failed to append ClearEvent records: %v\n", err)
+		}
+	})
+
+	var createdRecords []StageUser
+	for i, su := range stageUsers {
+		if created[i] {
+			createdRecords = append(createdRecords, su)
+		}
+	}
+	// Log errors but don't fail the sync
+	if err := s.addStageClears(ctx, createdRecords, 1); err != nil {
+		fmt.Printf("Warning: failed to update stage clear counters: %v\n", err)
+	}
+
+	return errs
+}
+
+// addStageClears adds delta to the clear counter of the stage of every record, with one increment per stage
+func (s *DatastoreService) addStageClears(ctx context.Context, stageUsers []StageUser, delta int64) error {
+	counts := make(map[string]int64)
+	stageKeys := make(map[string]*datastore.Key)
+	for _, su := range stageUsers {
+		name := keyName(su.StageKey)
+		counts[name] += delta
+		stageKeys[name] = su.StageKey
+	}
+
+	var firstErr error
+	for name, count := range counts {
+		if err := s.IncrementCounter(ctx, StageClearCounter(stageKeys[name]), count); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// recordFirstClears makes the user of each record the first clearer of its stage if nobody cleared
+// the stage earlier. Stages that already have an earlier first clearer are not written.
+func (s *DatastoreService) recordFirstClears(ctx context.Context, stageUsers []StageUser) error {
+	// Keep the earliest record per stage
+	earliest := make(map[string]StageUser)
+	for _, su := range stageUsers {
+		name := keyName(su.StageKey)
+		if e, ok := earliest[name]; !ok || su.ClearDate.Before(e.ClearDate) {
+			earliest[name] = su
+		}
+	}
+	candidates := make([]StageUser, 0, len(earliest))
+	stageKeys := make([]*datastore.Key, 0, len(earliest))
+	for _, su := range earliest {
+		candidates = append(candidates, su)
+		stageKeys = append(stageKeys, su.StageKey)
+	}
+	stages, err := s.GetStagesByKeys(ctx, stageKeys)
+	if err != nil {
+		return err
+	}
+
+	var firstErr error
+	for i, su := range candidates {
+		if !precedesFirstClear(stages[i], su.ClearDate) {
+			continue
+		}
+		_, err := s.client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+			var stage KyouenPuzzle
+			if err := tx.Get(su.StageKey, &stage); err != nil {
+				return err
+			}
+			if !precedesFirstClear(stage, su.ClearDate) {
+				return nil
+			}
+			stage.FirstClearedBy = su.UserKey
+			stage.FirstClearedAt = su.ClearDate
+			_, err := tx.Put(su.StageKey, &stage)
+			return err
+		})
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to update first clear of stage %d: %w", stages[i].StageNo, err)
+		}
+	}
+	return firstErr
+}
+
+// precedesFirstClear reports whether a clear at clearDate would be the stage's first clear.
+// Deleted stages (zero StageNo) are never updated, and a clear dated before the stage was registered
+// (e.g. a synced clear with a forged date) never counts.
+func precedesFirstClear(stage KyouenPuzzle, clearDate time.Time) bool {
+	if stage.StageNo == 0 || clearDate.Before(stage.RegistDate) {
+		return false
+	}
+	return stage.FirstClearedBy == nil || clearDate.Before(stage.FirstClearedAt)
+}
+
+// appendClearEvents appends ClearEvent records to the clear event log
+func (s *DatastoreService) appendClearEvents(ctx context.Context, events []ClearEvent) error {
+	for start := 0; start < len(events); start += maxPutBatchSize {
+		end := min(start+maxPutBatchSize, len(events))
+		keys := make([]*datastore.Key, end-start)
+		for i := range keys {
+			keys[i] = datastore.IncompleteKey("ClearEvent", nil)
+		}
+		if _, err := s.client.PutMulti(ctx, keys, events[start:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetRecentClearEvents gets the latest entries of the clear event log, newest first
+func (s *DatastoreService) GetRecentClearEvents(ctx context.Context, limit int) ([]ClearEvent, error) {
+	query := datastore.NewQuery("ClearEvent").
+		Order("-clearDate").
+		Limit(limit)
+
+	var events []ClearEvent
+	if _, err := s.client.GetAll(ctx, query, &events); err != nil {
+		return nil, fmt.Errorf("failed to get clear events: %w", err)
+	}
+
+	return events, nil
+}
+
+// HasStageUser checks if a stage user relation exists
+func (s *DatastoreService) HasStageUser(ctx context.Context, stageKey *datastore.Key, userKey *datastore.Key) (bool, error) {
+	query := datastore.NewQuery("StageUser").
+		FilterField("stage", "=", stageKey).
+		FilterField("user", "=", userKey).
+		Limit(1)
+
 	var stageUsers []StageUser
+	_, err := s.client.GetAll(ctx, query, &stageUsers)
+	if err != nil {
+		return false, fmt.Errorf("failed to check StageUser existence: %w", err)
+	}
+
+	return len(stageUsers) > 0, nil
+}
+
+// GetStageUsersByStage gets the clear records of all users for a stage
+func (s *DatastoreService) GetStageUsersByStage(ctx context.Context, stageKey *datastore.Key) ([]StageUser, error) {
+	query := datastore.NewQuery("StageUser").FilterField("stage", "=", stageKey)
+
+	var stageUsers []StageUser
+	if _, err := s.client.GetAll(ctx, query, &stageUsers); err != nil {
+		return nil, fmt.Errorf("failed to get clears of stage: %w", err)
+	}
+
+	return stageUsers, nil
+}
+
+// GetRecentStageUsersByStage gets the clear records of the users who first cleared a stage most recently, newest first
+func (s *DatastoreService) GetRecentStageUsersByStage(ctx context.Context, stageKey *datastore.Key, limit int) ([]StageUser, error) {
 	query := datastore.NewQuery("StageUser").
+		FilterField("stage", "=", stageKey).
 		Order("-clearDate").
 		Limit(limit)
 
+	var stageUsers []StageUser
+	if _, err := s.client.GetAll(ctx, query, &stageUsers); err != nil {
+		return nil, fmt.Errorf("failed to get recent StageUsers: %w", err)
+	}
+
+	return stageUsers, nil
+}
+
+// GetStageUsersFirstClearedBetween gets the clear records of a stage whose first clear is within [start, end),
+// newest first, using the (stage, clearDate desc) index
+func (s *DatastoreService) GetStageUsersFirstClearedBetween(ctx context.Context, stageKey *datastore.Key, start, end time.Time) ([]StageUser, error) {
+	query := datastore.NewQuery("StageUser").
+		FilterField("stage", "=", stageKey).
+		FilterField("clearDate", ">=", start).
+		FilterField("clearDate", "<", end).
+		Order("-clearDate")
+
+	var stageUsers []StageUser
+	if _, err := s.client.GetAll(ctx, query, &stageUsers); err != nil {
+		return nil, fmt.Errorf("failed to get clears of stage: %w", err)
+	}
+
+	return stageUsers, nil
+}
+
+// GetClearedStagesByUser gets all cleared stages for a user
+func (s *DatastoreService) GetClearedStagesByUser(ctx context.Context, userKey *datastore.Key) ([]StageUser, error) {
+	query := datastore.NewQuery("StageUser").
+		FilterField("user", "=", userKey).
+		Order("clearDate")
+
+	var stageUsers []StageUser
 	_, err := s.client.GetAll(ctx, query, &stageUsers)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get recent activities: %w", err)
+		return nil, fmt.Errorf("failed to get cleared stages: %w", err)
 	}
 
 	return stageUsers, nil
 }
 
+func (s *DatastoreService) IncrementUserClearCount(ctx context.Context, userKey *datastore.Key) error {
+	_, err := s.client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		var user User
+		err := tx.Get(userKey, &user)
+		if err != nil {
+			return fmt.Errorf("failed to get user: %w", err)
+		}
+
+		user.ClearStageCount++
+		_, err = tx.Put(userKey, &user)
+		return err
+	})
+
+	return err
+}
+
+// DeleteUser deletes a user and all associated data from Datastore
+func (s *DatastoreService) DeleteUser(ctx context.Context, userID string) error {
+	userKey := datastore.NameKey("User", "KEY"+userID, nil)
+	var user User
+	err := s.client.Get(ctx, userKey, &user)
+	if err != nil {
+		if err == datastore.ErrNoSuchEntity {
+			return fmt.Errorf("user not found: %s", userID)
+		}
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	// TODO: Add audit log for user account deletion (required for compliance)
+
+	// The clear event log can exceed the mutations of a transaction, so it is deleted first in batches;
+	// if this fails the account is kept and the deletion can be retried
+	if err := s.deleteClearEvents(ctx, userKey); err != nil {
+		return err
+	}
+
+	var stageUsers []StageUser
+	_, err = s.client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		stageUsers = nil
+		query := datastore.NewQuery("StageUser").FilterField("user", "=", userKey)
+		keys, err := s.client.GetAll(ctx, query, &stageUsers)
+		if err != nil {
+			return fmt.Errorf("failed to get StageUser records: %w", err)
+		}
+
+		if len(keys) > 0 {
+			err = tx.DeleteMulti(keys)
+			if err != nil {
+				return fmt.Errorf("failed to delete StageUser records: %w", err)
+			}
+		}
+
+		achievementQuery := datastore.NewQuery("Achievement").FilterField("user", "=", userKey).KeysOnly()
+		achievementKeys, err := s.client.GetAll(ctx, achievementQuery, nil)
+		if err != nil {
+			return fmt.Errorf("failed to get Achievement records: %w", err)
+		}
+		if len(achievementKeys) > 0 {
+			if err := tx.DeleteMulti(achievementKeys); err != nil {
+				return fmt.Errorf("failed to delete Achievement records: %w", err)
+			}
+		}
+
+		// Anonymize creator field in KyouenPuzzle entities created by this user
+		stageQuery := datastore.NewQuery("KyouenPuzzle").FilterField("creator", "=", user.ScreenName)
+		var stages []KyouenPuzzle
+		stageKeys, err := s.client.GetAll(ctx, stageQuery, &stages)
+		if err != nil {
+			return fmt.Errorf("failed to get user's stages: %w", err)
+		}
+
+		for i, stage := range stages {
+			stage.Creator = "[deleted user]"
+			_, err = tx.Put(stageKeys[i], &stage)
+			if err != nil {
+				return fmt.Errorf("failed to anonymize stage creator: %w", err)
+			}
+		}
+
+		err = tx.Delete(userKey)
+		if err != nil {
+			return fmt.Errorf("failed to delete user: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// The deleted user is no longer shown as a first clearer (see GetStagePopularity), but their clears
+	// are no longer counted. Log error but don't fail the deletion.
+	if err := s.addStageClears(ctx, stageUsers, -1); err != nil {
+		fmt.Printf("Warning: failed to update stage clear counters: %v\n", err)
+	}
+	return nil
+}
+
+// deleteClearEvents deletes the clear event log of a user
+func (s *DatastoreService) deleteClearEvents(ctx context.Context, userKey *datastore.Key) error {
+	query := datastore.NewQuery("ClearEvent").FilterField("user", "=", userKey).KeysOnly()
+	keys, err := s.client.GetAll(ctx, query, nil)
+	if err != nil {
+		return fmt.Errorf("failed to get ClearEvent records: %w", err)
+	}
+	for start := 0; start < len(keys); start += maxPutBatchSize {
+		end := min(start+maxPutBatchSize, len(keys))
+		if err := s.client.DeleteMulti(ctx, keys[start:end]); err != nil {
+			return fmt.Errorf("failed to delete ClearEvent records: %w", err)
+		}
+	}
+	return nil
+}
+
+// ActivityFilter narrows a page of activities to a user and/or a stage (nil keys match all)
+type ActivityFilter struct {
+	UserKey  *datastore.Key
+	StageKey *datastore.Key
+}
+
+// GetActivityPage gets up to limit clears, newest first, starting at cursor (empty for the first page).
+// It returns the cursor of the next page, or an empty string when there are no more clears.
+func (s *DatastoreService) GetActivityPage(ctx context.Context, filter ActivityFilter, limit int, cursor string) ([]StageUser, string, error) {
+	query := datastore.NewQuery("StageUser").Order("-clearDate").Limit(limit)
+	if filter.UserKey != nil {
+		query = query.FilterField("user", "=", filter.UserKey)
+	}
+	if filter.StageKey != nil {
+		query = query.FilterField("stage", "=", filter.StageKey)
+	}
+	if cursor != "" {
+		start, err := datastore.DecodeCursor(cursor)
+		if err != nil {
+			return nil, "", ErrInvalidCursor
+		}
+		query = query.Start(start)
+	}
+
+	var stageUsers []StageUser
+	it := s.client.Run(ctx, query)
+	for {
+		var su StageUser
+		_, err := it.Next(&su)
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to get activities: %w", err)
+		}
+		stageUsers = append(stageUsers, su)
+	}
+	if len(stageUsers) < limit {
+		return stageUsers, "", nil
+	}
+
+	next, err := it.Cursor()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get activities cursor: %w", err)
+	}
+	return stageUsers, next.String(), nil
+}
+
 // GetUserByKey gets a user by datastore key
 func (s *DatastoreService) GetUserByKey(ctx context.Context, userKey *datastore.Key) (*User, error) {
 	var user User
@@ -536,19 +1359,23 @@ func (s *DatastoreService) GetStageByKey(ctx context.Context, stageKey *datastor
 // ErrNoSuchEntity entries are returned as zero-value KyouenPuzzle; other errors abort.
 func (s *DatastoreService) GetStagesByKeys(ctx context.Context, keys []*datastore.Key) ([]KyouenPuzzle, error) {
 	stages := make([]KyouenPuzzle, len(keys))
-	err := s.client.GetMulti(ctx, keys, stages)
-	if err == nil {
-		return stages, nil
-	}
-	if merr, ok := err.(datastore.MultiError); ok {
-		for _, e := range merr {
-			if e != nil && e != datastore.ErrNoSuchEntity {
-				return nil, fmt.Errorf("failed to get stages by keys: %w", err)
+	for start := 0; start < len(keys); start += maxGetBatchSize {
+		end := min(start+maxGetBatchSize, len(keys))
+		err := s.client.GetMulti(ctx, keys[start:end], stages[start:end])
+		if err == nil {
+			continue
+		}
+		if merr, ok := err.(datastore.MultiError); ok {
+			for _, e := range merr {
+				if e != nil && e != datastore.ErrNoSuchEntity {
+					return nil, fmt.Errorf("failed to get stages by keys: %w", err)
+				}
 			}
+			continue
 		}
-		return stages, nil
+		return nil, fmt.Errorf("failed to get stages by keys: %w", err)
 	}
-	return nil, fmt.Errorf("failed to get stages by keys: %w", err)
+	return stages, nil
 }
 
 // GetUsersByKeys gets multiple users by datastore keys.
@@ -625,6 +1452,301 @@ func (s *DatastoreService) MigrateFirebaseUID(ctx context.Context, oldUID, newUI
 	return &migratedUser, nil
 }
 
+// RefreshUserClearCount recomputes the user's clearStageCount from its StageUser records
+func (s *DatastoreService) RefreshUserClearCount(ctx context.Context, userKey *datastore.Key) (int64, error) {
+	count, err := s.CountStageUsersByUserKey(ctx, userKey)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = s.client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		var user User
+		if err := tx.Get(userKey, &user); err != nil {
+			return fmt.Errorf("failed to get user: %w", err)
+		}
+		if user.ClearStageCount == int64(count) {
+			return nil
+		}
+		user.ClearStageCount = int64(count)
+		_, err := tx.Put(userKey, &user)
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to refresh clear count: %w", err)
+	}
+
+	return int64(count), nil
+}
+
+// StageUserRekeyResult summarizes a run of RekeyStageUsers
+type StageUserRekeyResult struct {
+	Scanned      int // StageUser records read
+	Pairs        int // distinct (stage, user) pairs
+	Rekeyed      int // pairs written under their deterministic key
+	Duplicates   int // records deleted (duplicates and records moved to a new key)
+	Skipped      int // records without a stage or user reference
+	UsersUpdated int // users whose clearStageCount was corrected
+}
+
+// stageUserRekeyPlan is the set of writes that moves StageUser records to deterministic keys
+type stageUserRekeyPlan struct {
+	putKeys    []*datastore.Key
+	puts       []StageUser
+	deletes    []*datastore.Key
+	userKeys   []*datastore.Key
+	userCounts []int64
+	skipped    int
+}
+
+// planStageUserRekey groups StageUser records by (stage, user). Each pair keeps a single record under
+// its deterministic key with the combined clear history (earliest first clear, latest last clear,
+// total clear count); all other records of the pair are deleted.
+// It also counts the distinct stages of each user so that clearStageCount can be corrected.
+func planStageUserRekey(keys []*datastore.Key, records []StageUser) stageUserRekeyPlan {
+	type group struct {
+		key     *datastore.Key
+		record  StageUser
+		members int
+		inPlace bool // a record is already stored under the deterministic key
+		oldKeys []*datastore.Key
+	}
+
+	var plan stageUserRekeyPlan
+	groups := make(map[string]*group)
+	var order []string
+	for i, record := range records {
+		if record.StageKey == nil || record.UserKey == nil {
+			plan.skipped++
+			continue
+		}
+
+		key := StageUserKey(record.StageKey, record.UserKey)
+		g, ok := groups[key.Name]
+		if !ok {
+			g = &group{key: key, record: record}
+			groups[key.Name] = g
+			order = append(order, key.Name)
+		} else {
+			g.record.merge(record)
+		}
+		g.members++
+		if keys[i].Equal(key) {
+			g.inPlace = true
+		} else {
+			g.oldKeys = append(g.oldKeys, keys[i])
+		}
+	}
+
+	userCounts := make(map[string]int64)
+	userKeys := make(map[string]*datastore.Key)
+	var userOrder []string
+	for _, name := range order {
+		g := groups[name]
+		if !g.inPlace || g.members > 1 {
+			plan.putKeys = append(plan.putKeys, g.key)
+			plan.puts = append(plan.puts, g.record)
+		}
+		plan.deletes = append(plan.deletes, g.oldKeys...)
+
+		userName := g.record.UserKey.String()
+		if _, ok := userKeys[userName]; !ok {
+			userKeys[userName] = g.record.UserKey
+			userOrder = append(userOrder, userName)
+		}
+		userCounts[userName]++
+	}
+	for _, userName := range userOrder {
+		plan.userKeys = append(plan.userKeys, userKeys[userName])
+		plan.userCounts = append(plan.userCounts, userCounts[userName])
+	}
+
+	return plan
+}
+
+// RekeyStageUsers moves all StageUser records to deterministic keys (see StageUserKey),
+// removing duplicate clears of the same stage by the same user and correcting clearStageCount.
+// With dryRun, nothing is written and the result reports what would change.
+// The migration is idempotent and can be re-run after an interruption.
+func (s *DatastoreService) RekeyStageUsers(ctx context.Context, dryRun bool) (*StageUserRekeyResult, error) {
+	var records []StageUser
+	keys, err := s.client.GetAll(ctx, datastore.NewQuery("StageUser"), &records)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get StageUser records: %w", err)
+	}
+
+	plan := planStageUserRekey(keys, records)
+	result := &StageUserRekeyResult{
+		Scanned:    len(records),
+		Rekeyed:    len(plan.puts),
+		Duplicates: len(plan.deletes),
+		Skipped:    plan.skipped,
+	}
+	for _, count := range plan.userCounts {
+		result.Pairs += int(count)
+	}
+
+	if !dryRun {
+		// 新キーへの書き込みを先に行い、旧レコードの削除は後で行う（中断時にクリア記録を失わないため）
+		for start := 0; start < len(plan.puts); start += maxPutBatchSize {
+			end := min(start+maxPutBatchSize, len(plan.puts))
+			if _, err := s.client.PutMulti(ctx, plan.putKeys[start:end], plan.puts[start:end]); err != nil {
+				return result, fmt.Errorf("failed to write re-keyed StageUser records: %w", err)
+			}
+		}
+		for start := 0; start < len(plan.deletes); start += maxPutBatchSize {
+			end := min(start+maxPutBatchSize, len(plan.deletes))
+			if err := s.client.DeleteMulti(ctx, plan.deletes[start:end]); err != nil {
+				return result, fmt.Errorf("failed to delete old StageUser records: %w", err)
+			}
+		}
+	}
+
+	for start := 0; start < len(plan.userKeys); start += maxGetBatchSize {
+		end := min(start+maxGetBatchSize, len(plan.userKeys))
+		users, err := s.GetUsersByKeys(ctx, plan.userKeys[start:end])
+		if err != nil {
+			return result, err
+		}
+
+		var changedKeys []*datastore.Key
+		var changed []User
+		for i, user := range users {
+			// StageUser records of deleted users are kept, but there is no user to update
+			if user.UserID == "" || user.ClearStageCount == plan.userCounts[start+i] {
+				continue
+			}
+			user.ClearStageCount = plan.userCounts[start+i]
+			changedKeys = append(changedKeys, plan.userKeys[start+i])
+			changed = append(changed, user)
+		}
+		result.UsersUpdated += len(changed)
+
+		if dryRun {
+			continue
+		}
+		for from := 0; from < len(changed); from += maxPutBatchSize {
+			to := min(from+maxPutBatchSize, len(changed))
+			if _, err := s.client.PutMulti(ctx, changedKeys[from:to], changed[from:to]); err != nil {
+				return result, fmt.Errorf("failed to update clearStageCount: %w", err)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// StageClearBackfillResult summarizes a run of BackfillStageClears
+type StageClearBackfillResult struct {
+	Stages          int                  // stages read
+	Clears          int64                // StageUser records of existing stages
+	CountersSeeded  int                  // clear counters created (or that would be created) from the records
+	Mismatches      []StageClearMismatch // seeded counters that disagree with the records
+	FirstClearsSet  int                  // stages whose first clearer was set or moved to an earlier clear
+	FirstClearsFail int                  // stages whose first clearer could not be written
+}
+
+// StageClearMismatch is a stage whose clear counter differs from the number of its StageUser records
+type StageClearMismatch struct {
+	StageNo int64
+	Counter int64
+	Records int64
+}
+
+// stageClearTally is the clear count and earliest clear of each stage, by keyName of the stage key
+type stageClearTally struct {
+	counts   map[string]int64
+	earliest map[string]StageUser
+}
+
+func newStageClearTally() *stageClearTally {
+	return &stageClearTally{counts: make(map[string]int64), earliest: make(map[string]StageUser)}
+}
+
+func (t *stageClearTally) add(su StageUser) {
+	if su.StageKey == nil || su.UserKey == nil {
+		return
+	}
+	name := keyName(su.StageKey)
+	t.counts[name]++
+	if e, ok := t.earliest[name]; !ok || su.FirstClearDate().Before(e.ClearDate) {
+		t.earliest[name] = StageUser{StageKey: su.StageKey, UserKey: su.UserKey, ClearDate: su.FirstClearDate()}
+	}
+}
+
+// BackfillStageClears initializes the clear counters and first clearers of stages from their StageUser records,
+// for stages cleared before they were maintained on clear.
+// Counters that are not seeded yet get a base equal to the records not reflected in their shards;
+// seeded counters are only compared with the records and reported in Mismatches.
+// With dryRun, nothing is written and the result reports what would change. It is safe to re-run.
+func (s *DatastoreService) BackfillStageClears(ctx context.Context, dryRun bool, concurrency int) (*StageClearBackfillResult, error) {
+	stages, keys, err := s.GetAllStages(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tally := newStageClearTally()
+	if err := s.ScanStageUsers(ctx, tally.add); err != nil {
+		return nil, err
+	}
+
+	counters := make([]ShardedCounter, len(keys))
+	for i, key := range keys {
+		counters[i] = StageClearCounter(key)
+	}
+	// Clears made while the scan runs may be counted in the shards but missed by the scan.
+	// Run the backfill when traffic is low; a re-run reports such counters in Mismatches.
+	values, err := s.ReadCounters(ctx, counters)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &StageClearBackfillResult{Stages: len(stages)}
+	now := time.Now()
+	var unseeded []int
+	var firstClears []StageUser
+	for i, stage := range stages {
+		name := keyName(keys[i])
+		records := tally.counts[name]
+		result.Clears += records
+		if !values[i].Seeded {
+			unseeded = append(unseeded, i)
+		} else if values[i].Count != records {
+			result.Mismatches = append(result.Mismatches, StageClearMismatch{StageNo: stage.StageNo, Counter: values[i].Count, Records: records})
+		}
+		if su, ok := tally.earliest[name]; ok && precedesFirstClear(stage, su.ClearDate) {
+			firstClears = append(firstClears, su)
+		}
+	}
+	result.CountersSeeded = len(unseeded)
+	result.FirstClearsSet = len(firstClears)
+	if dryRun {
+		return result, nil
+	}
+
+	errs := make([]error, len(unseeded))
+	runBounded(len(unseeded), concurrency, func(j int) {
+		i := unseeded[j]
+		base := CounterValue{Count: tally.counts[keyName(keys[i])] - values[i].Count, UpdatedAt: now}
+		_, errs[j] = s.SeedCounter(ctx, counters[i], base)
+	})
+	if err := errors.Join(errs...); err != nil {
+		return result, err
+	}
+
+	// recordFirstClears re-checks each stage in a transaction, so first clears recorded meanwhile are kept if earlier
+	firstErrs := make([]error, len(firstClears))
+	runBounded(len(firstClears), concurrency, func(i int) {
+		firstErrs[i] = s.recordFirstClears(ctx, firstClears[i:i+1])
+	})
+	for _, err := range firstErrs {
+		if err != nil {
+			fmt.Printf("Warning: %v\n", err)
+			result.FirstClearsFail++
+		}
+	}
+	result.FirstClearsSet -= result.FirstClearsFail
+	return result, nil
+}
+
 // CountStageUsersByUserKey counts StageUser records that reference the given user key.
 func (s *DatastoreService) CountStageUsersByUserKey(ctx context.Context, userKey *datastore.Key) (int, error) {
 	query := datastore.NewQuery("StageUser").FilterField("user", "=", userKey).KeysOnly()
@@ -678,3 +1800,404 @@ func (s *DatastoreService) GetAndDeleteRegistModels(ctx context.Context) ([]*dat
 
 	return stageKeys, nil
 }
+
+// DailyChallenge operations
+
+func dailyChallengeKey(date string) *datastore.Key {
+	return datastore.NameKey("DailyChallenge", date, nil)
+}
+
+// GetDailyChallenge gets the stage of the day of a date; it returns nil if none has been selected yet
+func (s *DatastoreService) GetDailyChallenge(ctx context.Context, date string) (*DailyChallenge, error) {
+	var challenge DailyChallenge
+	err := s.client.Get(ctx, dailyChallengeKey(date), &challenge)
+	if err == datastore.ErrNoSuchEntity {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get daily challenge: %w", err)
+	}
+	return &challenge, nil
+}
+
+// GetDailyChallenges gets the stages of the day of several dates, skipping dates without one
+func (s *DatastoreService) GetDailyChallenges(ctx context.Context, dates []string) ([]DailyChallenge, error) {
+	keys := make([]*datastore.Key, len(dates))
+	for i, date := range dates {
+		keys[i] = dailyChallengeKey(date)
+	}
+	challenges := make([]DailyChallenge, len(keys))
+	err := s.client.GetMulti(ctx, keys, challenges)
+	if merr, ok := err.(datastore.MultiError); ok {
+		for _, e := range merr {
+			if e != nil && e != datastore.ErrNoSuchEntity {
+				return nil, fmt.Errorf("failed to get daily challenges: %w", err)
+			}
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get daily challenges: %w", err)
+	}
+
+	var found []DailyChallenge
+	for _, challenge := range challenges {
+		if challenge.Date != "" {
+			found = append(found, challenge)
+		}
+	}
+	return found, nil
+}
+
+// CreateDailyChallenge stores the stage of the day unless one was already selected for the date.
+// It returns the stored challenge and whether it was created by this call.
+func (s *DatastoreService) CreateDailyChallenge(ctx context.Context, challenge DailyChallenge) (*DailyChallenge, bool, error) {
+	key := dailyChallengeKey(challenge.Date)
+	created := false
+
+	_, err := s.client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		var existing DailyChallenge
+		err := tx.Get(key, &existing)
+		if err == nil {
+			challenge = existing
+			created = false
+			return nil
+		}
+		if err != datastore.ErrNoSuchEntity {
+			return fmt.Errorf("failed to check existing daily challenge: %w", err)
+		}
+		if _, err := tx.Put(key, &challenge); err != nil {
+			return fmt.Errorf("failed to save daily challenge: %w", err)
+		}
+		created = true
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	return &challenge, created, nil
+}
+
+// MarkDailyChallengeNotified records that the push notification of the stage of the day was sent
+func (s *DatastoreService) MarkDailyChallengeNotified(ctx context.Context, date string) error {
+	_, err := s.client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		var challenge DailyChallenge
+		if err := tx.Get(dailyChallengeKey(date), &challenge); err != nil {
+			return fmt.Errorf("failed to get daily challenge: %w", err)
+		}
+		challenge.Notified = true
+		if _, err := tx.Put(dailyChallengeKey(date), &challenge); err != nil {
+			return fmt.Errorf("failed to update daily challenge: %w", err)
+		}
+		return nil
+	})
+	return err
+}
+
+// GetAllStageKeys gets the keys of all stages with a keys-only query
+func (s *DatastoreService) GetAllStageKeys(ctx context.Context) ([]*datastore.Key, error) {
+	keys, err := s.client.GetAll(ctx, datastore.NewQuery("KyouenPuzzle").KeysOnly(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stage keys: %w", err)
+	}
+	return keys, nil
+}
+
+// CountClearsByStage counts the users who cleared each stage, keyed by the stage key's ID or name.
+// It reads only StageUser keys, which embed the stage (see StageUserKey); records not yet re-keyed are skipped.
+func (s *DatastoreService) CountClearsByStage(ctx context.Context) (map[string]int64, error) {
+	keys, err := s.client.GetAll(ctx, datastore.NewQuery("StageUser").KeysOnly(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get StageUser keys: %w", err)
+	}
+
+	counts := make(map[string]int64)
+	for _, key := range keys {
+		if stage, _, ok := strings.Cut(key.Name, "/"); ok {
+			counts[stage]++
+		}
+	}
+	return counts, nil
+}
+
+// Achievement operations
+
+// AchievementKey returns the deterministic key of a user's badge, so that unlocking it again overwrites the same entity
+func AchievementKey(userKey *datastore.Key, badge string) *datastore.Key {
+	return datastore.NameKey("Achievement", keyName(userKey)+"/"+badge, nil)
+}
+
+// GetAchievementsByUser gets the badges unlocked by a user, oldest first
+func (s *DatastoreService) GetAchievementsByUser(ctx context.Context, userKey *datastore.Key) ([]Achievement, error) {
+	query := datastore.NewQuery("Achievement").FilterField("user", "=", userKey)
+
+	var achievements []Achievement
+	if _, err := s.client.GetAll(ctx, query, &achievements); err != nil {
+		return nil, fmt.Errorf("failed to get achievements: %w", err)
+	}
+
+	sort.Slice(achievements, func(i, j int) bool {
+		return achievements[i].UnlockedAt.Before(achievements[j].UnlockedAt)
+	})
+	return achievements, nil
+}
+
+// PutAchievements stores unlocked badges under their deterministic keys
+func (s *DatastoreService) PutAchievements(ctx context.Context, achievements []Achievement) error {
+	for start := 0; start < len(achievements); start += maxPutBatchSize {
+		end := min(start+maxPutBatchSize, len(achievements))
+		keys := make([]*datastore.Key, end-start)
+		for i := range keys {
+			keys[i] = AchievementKey(achievements[start+i].UserKey, achievements[start+i].Badge)
+		}
+		if _, err := s.client.PutMulti(ctx, keys, achievements[start:end]); err != nil {
+			return fmt.Errorf("failed to save achievements: %w", err)
+		}
+	}
+	return nil
+}
+
+// CountStagesBySize counts the stages of each grid size with a projection query
+func (s *DatastoreService) CountStagesBySize(ctx context.Context) (map[int64]int64, error) {
+	var stages []KyouenPuzzle
+	if _, err := s.client.GetAll(ctx, datastore.NewQuery("KyouenPuzzle").Project("size"), &stages); err != nil {
+		return nil, fmt.Errorf("failed to count stages by size: %w", err)
+	}
+
+	counts := make(map[int64]int64)
+	for _, stage := range stages {
+		counts[stage.Size]++
+	}
+	return counts, nil
+}
+
+// GetAllUserKeys gets the keys of all users with a keys-only query
+func (s *DatastoreService) GetAllUserKeys(ctx context.Context) ([]*datastore.Key, error) {
+	keys, err := s.client.GetAll(ctx, datastore.NewQuery("User").KeysOnly(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user keys: %w", err)
+	}
+	return keys, nil
+}
+
+// Collection operations
+
+func collectionKey(id string) *datastore.Key {
+	return datastore.NameKey("Collection", id, nil)
+}
+
+// GetCollections gets all collections, oldest first
+func (s *DatastoreService) GetCollections(ctx context.Context) ([]Collection, error) {
+	var collections []Collection
+	if _, err := s.client.GetAll(ctx, datastore.NewQuery("Collection").Order("createdAt"), &collections); err != nil {
+		return nil, fmt.Errorf("failed to get collections: %w", err)
+	}
+	return collections, nil
+}
+
+// GetCollection gets a collection by ID, returning nil if it does not exist
+func (s *DatastoreService) GetCollection(ctx context.Context, id string) (*Collection, error) {
+	var collection Collection
+	err := s.client.Get(ctx, collectionKey(id), &collection)
+	if err == datastore.ErrNoSuchEntity {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get collection: %w", err)
+	}
+	return &collection, nil
+}
+
+// PutCollection creates or replaces a collection, keeping the creation time of an existing one.
+// It returns the stored collection and whether it was created.
+func (s *DatastoreService) PutCollection(ctx context.Context, collection Collection) (*Collection, bool, error) {
+	key := collectionKey(collection.ID)
+	created := false
+	now := time.Now()
+
+	_, err := s.client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		var existing Collection
+		err := tx.Get(key, &existing)
+		switch {
+		case err == nil:
+			collection.CreatedAt = existing.CreatedAt
+			created = false
+		case err == datastore.ErrNoSuchEntity:
+			collection.CreatedAt = now
+			created = true
+		default:
+			return fmt.Errorf("failed to check existing collection: %w", err)
+		}
+		collection.UpdatedAt = now
+		if _, err := tx.Put(key, &collection); err != nil {
+			return fmt.Errorf("failed to save collection: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	return &collection, created, nil
+}
+
+// DeleteCollection deletes a collection, returning false if it did not exist
+func (s *DatastoreService) DeleteCollection(ctx context.Context, id string) (bool, error) {
+	key := collectionKey(id)
+	deleted := false
+
+	_, err := s.client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		var existing Collection
+		err := tx.Get(key, &existing)
+		if err == datastore.ErrNoSuchEntity {
+			deleted = false
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to get collection: %w", err)
+		}
+		if err := tx.Delete(key); err != nil {
+			return fmt.Errorf("failed to delete collection: %w", err)
+		}
+		deleted = true
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return deleted, nil
+}
+
+// StageKeyName returns the ID or name of a stage key, as used in CountClearsByStage
+func StageKeyName(key *datastore.Key) string {
+	return keyName(key)
+}
+
+// equalStrings reports whether two string slices have the same elements in the same order
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// unionStrings returns the sorted union of two string slices without duplicates
+func unionStrings(a, b []string) []string {
+	seen := make(map[string]bool, len(a)+len(b))
+	var result []string
+	for _, v := range append(append([]string{}, a...), b...) {
+		if !seen[v] {
+			seen[v] = true
+			result = append(result, v)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// Statistics aggregation operations
+
+var statisticsSummaryKey = datastore.IDKey("StatisticsSummary", 1, nil)
+
+// GetAllStages gets all stages with their keys
+func (s *DatastoreService) GetAllStages(ctx context.Context) ([]KyouenPuzzle, []*datastore.Key, error) {
+	var stages []KyouenPuzzle
+	keys, err := s.client.GetAll(ctx, datastore.NewQuery("KyouenPuzzle"), &stages)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get stages: %w", err)
+	}
+	return stages, keys, nil
+}
+
+// ScanStageUsers calls fn for every StageUser record without loading them all at once
+func (s *DatastoreService) ScanStageUsers(ctx context.Context, fn func(StageUser)) error {
+	it := s.client.Run(ctx, datastore.NewQuery("StageUser"))
+	for {
+		var su StageUser
+		_, err := it.Next(&su)
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to scan StageUser records: %w", err)
+		}
+		fn(su)
+	}
+}
+
+// GetStatisticsSummary gets the aggregated statistics. It returns nil if they have not been aggregated yet.
+func (s *DatastoreService) GetStatisticsSummary(ctx context.Context) (*StatisticsSummary, error) {
+	var summary StatisticsSummary
+	err := s.client.Get(ctx, statisticsSummaryKey, &summary)
+	if err == datastore.ErrNoSuchEntity {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get statistics summary: %w", err)
+	}
+	return &summary, nil
+}
+
+// PutStatisticsSummary replaces the aggregated statistics
+func (s *DatastoreService) PutStatisticsSummary(ctx context.Context, summary StatisticsSummary) error {
+	if _, err := s.client.Put(ctx, statisticsSummaryKey, &summary); err != nil {
+		return fmt.Errorf("failed to save statistics summary: %w", err)
+	}
+	return nil
+}
+
+// GetDailyClearStats gets the daily clear counts from one date to another (inclusive), oldest first.
+// Dates without clears have no entity and are not returned.
+func (s *DatastoreService) GetDailyClearStats(ctx context.Context, from, to string) ([]DailyClearStats, error) {
+	query := datastore.NewQuery("DailyClearStats").
+		FilterField("date", ">=", from).
+		FilterField("date", "<=", to).
+		Order("date")
+
+	var stats []DailyClearStats
+	if _, err := s.client.GetAll(ctx, query, &stats); err != nil {
+		return nil, fmt.Errorf("failed to get daily clear stats: %w", err)
+	}
+	return stats, nil
+}
+
+// PutDailyClearStats stores daily clear counts under their dates
+func (s *DatastoreService) PutDailyClearStats(ctx context.Context, stats []DailyClearStats) error {
+	for start := 0; start < len(stats); start += maxPutBatchSize {
+		end := min(start+maxPutBatchSize, len(stats))
+		keys := make([]*datastore.Key, end-start)
+		for i := range keys {
+			keys[i] = datastore.NameKey("DailyClearStats", stats[start+i].Date, nil)
+		}
+		if _, err := s.client.PutMulti(ctx, keys, stats[start:end]); err != nil {
+			return fmt.Errorf("failed to save daily clear stats: %w", err)
+		}
+	}
+	return nil
+}
+
+// chunkCount returns the number of chunks of at most size items needed for n items
+func chunkCount(n, size int) int {
+	return (n + size - 1) / size
+}
+
+// runBounded calls fn for 0..n-1 with at most concurrency calls running at the same time
+func runBounded(n, concurrency int, fn func(i int)) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			fn(i)
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,333 @@
+package datastore
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"kyouen-server/internal/testutils"
+
+	"cloud.google.com/go/datastore"
+)
+
+func TestStageUserKey(t *testing.T) {
+	stageKey := datastore.IDKey("KyouenPuzzle", 42, nil)
+	userKey := datastore.NameKey("User", "KEYuid-1", nil)
+
+	key := StageUserKey(stageKey, userKey)
+	if key.Kind != "StageUser" || key.Name != "42/KEYuid-1" {
+		t.Errorf("Unexpected key: %v", key)
+	}
+	if !key.Equal(StageUserKey(stageKey, userKey)) {
+		t.Errorf("Expected the same key for the same stage and user")
+	}
+}
+
+func TestPlanStageUserRekey(t *testing.T) {
+	stage1 := datastore.IDKey("KyouenPuzzle", 1, nil)
+	stage2 := datastore.IDKey("KyouenPuzzle", 2, nil)
+	alice := datastore.NameKey("User", "KEYalice", nil)
+	bob := datastore.NameKey("User", "KEYbob", nil)
+
+	early := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	late := early.Add(time.Hour)
+
+	keys := []*datastore.Key{
+		datastore.IDKey("StageUser", 100, nil),
+		datastore.IDKey("StageUser", 101, nil),
+		datastore.IDKey("StageUser", 102, nil),
+		StageUserKey(stage1, bob),
+		datastore.IDKey("StageUser", 103, nil),
+	}
+	records := []StageUser{
+		{StageKey: stage1, UserKey: alice, ClearDate: late},
+		{StageKey: stage1, UserKey: alice, ClearDate: early}, // duplicate with an earlier date
+		{StageKey: stage2, UserKey: alice, ClearDate: late},
+		{StageKey: stage1, UserKey: bob, ClearDate: early}, // already re-keyed
+		{StageKey: nil, UserKey: bob, ClearDate: early},
+	}
+
+	plan := planStageUserRekey(keys, records)
+
+	if plan.skipped != 1 {
+		t.Errorf("Expected 1 skipped record, got %d", plan.skipped)
+	}
+	if len(plan.puts) != 2 {
+		t.Fatalf("Expected 2 puts, got %d", len(plan.puts))
+	}
+	if !plan.putKeys[0].Equal(StageUserKey(stage1, alice)) || !plan.puts[0].ClearDate.Equal(early) {
+		t.Errorf("Expected stage 1 of alice to keep the earliest clear date, got %v at %v", plan.putKeys[0], plan.puts[0].ClearDate)
+	}
+	if !plan.puts[0].LastClearDate.Equal(late) || plan.puts[0].ClearCount != 2 {
+		t.Errorf("Expected duplicates to be combined into 2 clears last at %v, got %d at %v", late, plan.puts[0].ClearCount, plan.puts[0].LastClearDate)
+	}
+	if !plan.putKeys[1].Equal(StageUserKey(stage2, alice)) {
+		t.Errorf("Expected stage 2 of alice to be re-keyed, got %v", plan.putKeys[1])
+	}
+	if len(plan.deletes) != 3 {
+		t.Errorf("Expected the 3 old alice records to be deleted, got %d", len(plan.deletes))
+	}
+	for _, key := range plan.deletes {
+		if key.Equal(StageUserKey(stage1, bob)) {
+			t.Errorf("Record already under its deterministic key must not be deleted")
+		}
+	}
+
+	if len(plan.userKeys) != 2 || plan.userCounts[0] != 2 || plan.userCounts[1] != 1 {
+		t.Errorf("Expected clear counts alice=2 and bob=1, got %v %v", plan.userKeys, plan.userCounts)
+	}
+}
+
+func TestStageUser_Merge(t *testing.T) {
+	first := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	second := first.Add(24 * time.Hour)
+	third := second.Add(24 * time.Hour)
+
+	su := StageUser{ClearDate: second, LastClearDate: third, ClearCount: 3}
+	su.merge(StageUser{ClearDate: first}) // legacy record without last clear date and count
+
+	if !su.FirstClearDate().Equal(first) {
+		t.Errorf("Expected first clear date %v, got %v", first, su.FirstClearDate())
+	}
+	if !su.LatestClearDate().Equal(third) {
+		t.Errorf("Expected last clear date %v, got %v", third, su.LatestClearDate())
+	}
+	if su.Clears() != 4 {
+		t.Errorf("Expected 4 clears, got %d", su.Clears())
+	}
+}
+
+func TestStageClearTally(t *testing.T) {
+	stage1 := datastore.IDKey("KyouenPuzzle", 1, nil)
+	stage2 := datastore.IDKey("KyouenPuzzle", 2, nil)
+	alice := datastore.NameKey("User", "KEYalice", nil)
+	bob := datastore.NameKey("User", "KEYbob", nil)
+
+	early := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	late := early.Add(time.Hour)
+
+	tally := newStageClearTally()
+	tally.add(StageUser{StageKey: stage1, UserKey: alice, ClearDate: late})
+	tally.add(StageUser{StageKey: stage1, UserKey: bob, ClearDate: early})
+	tally.add(StageUser{StageKey: stage2, UserKey: alice, ClearDate: late})
+	tally.add(StageUser{StageKey: stage2, UserKey: nil, ClearDate: early})
+
+	if tally.counts["1"] != 2 || tally.counts["2"] != 1 {
+		t.Errorf("Unexpected counts: %v", tally.counts)
+	}
+	if first := tally.earliest["1"]; !first.UserKey.Equal(bob) || !first.ClearDate.Equal(early) {
+		t.Errorf("Expected bob's earlier clear to be the first clear of stage 1, got %+v", first)
+	}
+	if first := tally.earliest["2"]; !first.UserKey.Equal(alice) {
+		t.Errorf("Expected records without a user to be ignored, got %+v", first)
+	}
+}
+
+func TestPrecedesFirstClear(t *testing.T) {
+	alice := datastore.NameKey("User", "KEYalice", nil)
+	early := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	late := early.Add(time.Hour)
+
+	tests := []struct {
+		name      string
+		stage     KyouenPuzzle
+		clearDate time.Time
+		want      bool
+	}{
+		{"never cleared", KyouenPuzzle{StageNo: 1}, late, true},
+		{"earlier clear", KyouenPuzzle{StageNo: 1, FirstClearedBy: alice, FirstClearedAt: late}, early, true},
+		{"later clear", KyouenPuzzle{StageNo: 1, FirstClearedBy: alice, FirstClearedAt: early}, late, false},
+		{"same time", KyouenPuzzle{StageNo: 1, FirstClearedBy: alice, FirstClearedAt: early}, early, false},
+		{"deleted stage", KyouenPuzzle{}, early, false},
+		{"before registration", KyouenPuzzle{StageNo: 1, RegistDate: late}, early, false},
+		{"at registration", KyouenPuzzle{StageNo: 1, RegistDate: early}, early, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := precedesFirstClear(tt.stage, tt.clearDate); got != tt.want {
+				t.Errorf("precedesFirstClear() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCountClearAttempt(t *testing.T) {
+	rate := ClearRateLimit{Limit: 2, Window: time.Minute}
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	user := &User{}
+
+	for i := 0; i < 2; i++ {
+		if err := countClearAttempt(user, rate, start.Add(time.Duration(i)*time.Second)); err != nil {
+			t.Fatalf("Clear %d within the limit rejected: %v", i+1, err)
+		}
+	}
+	err := countClearAttempt(user, rate, start.Add(10*time.Second))
+	exceeded, ok := err.(*ClearRateExceededError)
+	if !ok {
+		t.Fatalf("Expected ClearRateExceededError, got %v", err)
+	}
+	if !exceeded.WindowEnd.Equal(start.Add(time.Minute)) {
+		t.Errorf("Expected the window to end at %v, got %v", start.Add(time.Minute), exceeded.WindowEnd)
+	}
+
+	if err := countClearAttempt(user, rate, start.Add(time.Minute)); err != nil {
+		t.Errorf("Expected a new window to accept the clear, got %v", err)
+	}
+	if user.ClearWindowCount != 1 || !user.ClearWindowStart.Equal(start.Add(time.Minute)) {
+		t.Errorf("Expected a new window with one clear, got %d from %v", user.ClearWindowCount, user.ClearWindowStart)
+	}
+}
+
+func TestDeleteUser_DeletesClearHistory(t *testing.T) {
+	if os.Getenv("DATASTORE_EMULATOR_HOST") == "" {
+		t.Skip("DATASTORE_EMULATOR_HOST is not set")
+	}
+	client := testutils.SetupDatastoreTest()
+	defer client.Close()
+	defer testutils.CleanupDatastore(client)
+
+	ctx := context.Background()
+	s := &DatastoreService{client: client}
+	userKey := datastore.NameKey("User", "KEYdelete-me", nil)
+	otherKey := datastore.NameKey("User", "KEYkeep-me", nil)
+	stageKey := datastore.IDKey("KyouenPuzzle", 1, nil)
+	now := time.Now()
+
+	if _, err := client.Put(ctx, userKey, &User{UserID: "delete-me", ScreenName: "delete-me"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Put(ctx, StageUserKey(stageKey, userKey), &StageUser{StageKey: stageKey, UserKey: userKey, ClearDate: now}); err != nil {
+		t.Fatal(err)
+	}
+	events := []ClearEvent{
+		{StageKey: stageKey, UserKey: userKey, ClearDate: now, FirstClear: true, Source: ClearSourceClear},
+		{StageKey: stageKey, UserKey: userKey, ClearDate: now, Source: ClearSourceClear},
+		{StageKey: stageKey, UserKey: otherKey, ClearDate: now, FirstClear: true, Source: ClearSourceSync},
+	}
+	if err := s.appendClearEvents(ctx, events); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.DeleteUser(ctx, "delete-me"); err != nil {
+		t.Fatalf("DeleteUser failed: %v", err)
+	}
+
+	for _, kind := range []string{"StageUser", "ClearEvent"} {
+		keys, err := client.GetAll(ctx, datastore.NewQuery(kind).FilterField("user", "=", userKey).KeysOnly(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(keys) != 0 {
+			t.Errorf("Expected the user's %s records to be deleted, %d left", kind, len(keys))
+		}
+	}
+	keys, err := client.GetAll(ctx, datastore.NewQuery("ClearEvent").FilterField("user", "=", otherKey).KeysOnly(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 {
+		t.Errorf("Expected other users' ClearEvent records to be kept, got %d", len(keys))
+	}
+}
+
+func TestCreateStageUser_ReclearOfLegacyRecord(t *testing.T) {
+	if os.Getenv("DATASTORE_EMULATOR_HOST") == "" {
+		t.Skip("DATASTORE_EMULATOR_HOST is not set")
+	}
+	client := testutils.SetupDatastoreTest()
+	defer client.Close()
+	defer testutils.CleanupDatastore(client)
+
+	ctx := context.Background()
+	s := &DatastoreService{client: client}
+	userKey := datastore.NameKey("User", "KEYlegacy", nil)
+	stageKey := datastore.IDKey("KyouenPuzzle", 1, nil)
+	firstClear := time.Now().Add(-time.Hour).Truncate(time.Microsecond)
+
+	if _, err := client.Put(ctx, userKey, &User{UserID: "legacy", ScreenName: "legacy", ClearStageCount: 1}); err != nil {
+		t.Fatal(err)
+	}
+	legacy := &StageUser{StageKey: stageKey, UserKey: userKey, ClearDate: firstClear, LastClearDate: firstClear, ClearCount: 1}
+	if _, err := client.Put(ctx, datastore.IncompleteKey("StageUser", nil), legacy); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.CreateStageUser(ctx, stageKey, userKey, ClearDetails{}, ClearRateLimit{}); err != nil {
+		t.Fatalf("CreateStageUser failed: %v", err)
+	}
+
+	var records []StageUser
+	keys, err := client.GetAll(ctx, datastore.NewQuery("StageUser").FilterField("user", "=", userKey), &records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || !keys[0].Equal(StageUserKey(stageKey, userKey)) {
+		t.Fatalf("Expected the legacy record to be moved to its deterministic key, got %v", keys)
+	}
+	if records[0].ClearCount != 2 || !records[0].ClearDate.Equal(firstClear) {
+		t.Errorf("Expected a re-clear keeping the first clear date, got count %d, date %v", records[0].ClearCount, records[0].ClearDate)
+	}
+
+	var user User
+	if err := client.Get(ctx, userKey, &user); err != nil {
+		t.Fatal(err)
+	}
+	if user.ClearStageCount != 1 {
+		t.Errorf("Expected clearStageCount to stay 1, got %d", user.ClearStageCount)
+	}
+}
+
+func TestMergeUsers_MovesClearHistory(t *testing.T) {
+	if os.Getenv("DATASTORE_EMULATOR_HOST") == "" {
+		t.Skip("DATASTORE_EMULATOR_HOST is not set")
+	}
+	client := testutils.SetupDatastoreTest()
+	defer client.Close()
+	defer testutils.CleanupDatastore(client)
+
+	ctx := context.Background()
+	s := &DatastoreService{client: client}
+	sourceKey := datastore.NameKey("User", "KEYanonymous-source", nil)
+	targetKey := datastore.NameKey("User", "KEYlinked-target", nil)
+	stageKey := datastore.IDKey("KyouenPuzzle", 1, nil)
+	now := time.Now()
+
+	if _, err := client.Put(ctx, sourceKey, &User{UserID: "anonymous-source", ScreenName: "source", ClearStageCount: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Put(ctx, targetKey, &User{UserID: "linked-target", ScreenName: "target"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Put(ctx, StageUserKey(stageKey, sourceKey), &StageUser{StageKey: stageKey, UserKey: sourceKey, ClearDate: now}); err != nil {
+		t.Fatal(err)
+	}
+	events := []ClearEvent{
+		{StageKey: stageKey, UserKey: sourceKey, ClearDate: now, FirstClear: true, Source: ClearSourceClear},
+		{StageKey: stageKey, UserKey: sourceKey, ClearDate: now, Source: ClearSourceClear},
+	}
+	if err := s.appendClearEvents(ctx, events); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, migrated, err := s.MergeUsers(ctx, "anonymous-source", "linked-target"); err != nil || migrated != 1 {
+		t.Fatalf("MergeUsers = %d, %v; want 1 record moved", migrated, err)
+	}
+
+	for _, kind := range []string{"StageUser", "ClearEvent"} {
+		left, err := client.GetAll(ctx, datastore.NewQuery(kind).FilterField("user", "=", sourceKey).KeysOnly(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(left) != 0 {
+			t.Errorf("Expected no %s records of the source user, %d left", kind, len(left))
+		}
+	}
+	moved, err := client.GetAll(ctx, datastore.NewQuery("ClearEvent").FilterField("user", "=", targetKey).KeysOnly(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(moved) != len(events) {
+		t.Errorf("Expected %d ClearEvent records of the target user, got %d", len(events), len(moved))
+	}
+}
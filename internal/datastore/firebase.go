@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strconv"
 
 	firebase "firebase.google.com/go/v4"
 	"firebase.google.com/go/v4/auth"
@@ -92,6 +93,41 @@ func (fs *FirebaseService) SendNewStageNotification(ctx context.Context, stageNo
 	return nil
 }
 
+// DailyChallengeTopic is the FCM topic for the stage of the day.
+const DailyChallengeTopic = "daily_challenge"
+
+// SendDailyChallengeNotification sends a localized FCM push notification to the daily challenge topic.
+// The date (YYYY-MM-DD, JST) and stage number are included in the message data.
+func (fs *FirebaseService) SendDailyChallengeNotification(ctx context.Context, date string, stageNo int64) error {
+	message := &messaging.Message{
+		Topic: DailyChallengeTopic,
+		Android: &messaging.AndroidConfig{
+			Notification: &messaging.AndroidNotification{
+				TitleLocKey: "notification_daily_challenge_title",
+			},
+		},
+		APNS: &messaging.APNSConfig{
+			Payload: &messaging.APNSPayload{
+				Aps: &messaging.Aps{
+					Alert: &messaging.ApsAlert{
+						TitleLocKey: "notification_daily_challenge_title",
+					},
+				},
+			},
+		},
+		Data: map[string]string{
+			"date":     date,
+			"stage_no": strconv.FormatInt(stageNo, 10),
+		},
+	}
+
+	_, err := fs.messaging.Send(ctx, message)
+	if err != nil {
+		return fmt.Errorf("failed to send FCM notification to topic %s: %w", DailyChallengeTopic, err)
+	}
+	return nil
+}
+
 // VerifyIDToken verifies Firebase ID token and returns the token claims
 func (fs *FirebaseService) VerifyIDToken(ctx context.Context, idToken string) (*auth.Token, error) {
 	token, err := fs.auth.VerifyIDToken(ctx, idToken)
@@ -102,6 +138,17 @@ func (fs *FirebaseService) VerifyIDToken(ctx context.Context, idToken string) (*
 	return token, nil
 }
 
+// VerifyIDTokenAndCheckRevoked verifies Firebase ID token and also checks that it has not been revoked
+// and that the user has not been disabled
+func (fs *FirebaseService) VerifyIDTokenAndCheckRevoked(ctx context.Context, idToken string) (*auth.Token, error) {
+	token, err := fs.auth.VerifyIDTokenAndCheckRevoked(ctx, idToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify ID token: %w", err)
+	}
+
+	return token, nil
+}
+
 // GetUserByUID retrieves user information from Firebase Auth
 func (fs *FirebaseService) GetUserByUID(ctx context.Context, uid string) (*auth.UserRecord, error) {
 	user, err := fs.auth.GetUser(ctx, uid)
@@ -6,6 +6,8 @@ import (
 	"cloud.google.com/go/datastore"
 )
 
+// KyouenPuzzleSummary is the number of stages and when the last one was added (see GetSummary).
+// The entity of this kind (ID 1) is no longer written; it only seeds StageCounter.
 type KyouenPuzzleSummary struct {
 	Count    int64     `datastore:"count"`
 	LastDate time.Time `datastore:"lastDate"`
@@ -17,14 +19,27 @@ type KyouenPuzzle struct {
 	Stage      string    `datastore:"stage"`
 	Creator    string    `datastore:"creator"`
 	RegistDate time.Time `datastore:"registDate"`
+
+	// The user with the earliest first clear of the stage (nil until cleared). The number of users
+	// who cleared the stage is kept in StageClearCounter rather than on this frequently read entity.
+	FirstClearedBy *datastore.Key `datastore:"firstClearedBy,noindex"`
+	FirstClearedAt time.Time      `datastore:"firstClearedAt,noindex"`
 }
 
 type User struct {
-	UserID          string `datastore:"userId"`          // Firebase UID
-	ScreenName      string `datastore:"screenName"`      // Twitter screen name
-	Image           string `datastore:"image"`           // Twitter profile image
-	ClearStageCount int64  `datastore:"clearStageCount"` // Number of cleared stages
-	TwitterUID      string `datastore:"twitterUid"`      // Twitter User ID (for reference)
+	UserID          string   `datastore:"userId"`          // Firebase UID
+	ScreenName      string   `datastore:"screenName"`      // Twitter screen name
+	Image           string   `datastore:"image"`           // Twitter profile image
+	ClearStageCount int64    `datastore:"clearStageCount"` // Number of cleared stages
+	TwitterUID      string   `datastore:"twitterUid"`      // Twitter User ID (for reference)
+	Providers       []string `datastore:"providers"`       // Linked sign-in provider IDs (e.g. "twitter.com", "google.com")
+
+	// Anti-cheat state. Suspicious users are excluded from rankings and activities until reviewed.
+	Suspicious       bool      `datastore:"suspicious"`               // Flagged by a clear heuristic or an administrator
+	SuspiciousReason string    `datastore:"suspiciousReason,noindex"` // Why the user was flagged (see Suspicion* constants)
+	FlaggedAt        time.Time `datastore:"flaggedAt,noindex"`        // When the user was first flagged
+	ClearWindowStart time.Time `datastore:"clearWindowStart,noindex"` // Start of the current clear rate window
+	ClearWindowCount int64     `datastore:"clearWindowCount,noindex"` // Clears submitted in the current window
 
 	// TODO remove later (Legacy fields - not used in Firebase auth)
 	AccessToken  string `datastore:"accessToken"`
@@ -32,12 +47,121 @@ type User struct {
 	APIToken     string `datastore:"apiToken"`
 }
 
+// Reasons a user is flagged as suspicious
+const (
+	SuspicionSolveTime        = "solve_time"         // cleared a stage faster than plausible
+	SuspicionMissingSolveTime = "missing_solve_time" // cleared a stage without reporting the solve time
+	SuspicionClearRate        = "clear_rate"         // submitted clears faster than the rate limit
+	SuspicionManual           = "manual"             // flagged by an administrator
+)
+
 type StageUser struct {
-	StageKey  *datastore.Key `datastore:"stage"`
-	UserKey   *datastore.Key `datastore:"user"`
-	ClearDate time.Time      `datastore:"clearDate"`
+	StageKey      *datastore.Key `datastore:"stage"`
+	UserKey       *datastore.Key `datastore:"user"`
+	ClearDate     time.Time      `datastore:"clearDate"`     // First clear date (never overwritten by re-clears)
+	LastClearDate time.Time      `datastore:"lastClearDate"` // Latest clear date (zero for records created before it was tracked)
+	ClearCount    int64          `datastore:"clearCount"`    // Number of clears (zero for records created before it was tracked)
+
+	// Details of the first clear reported by the client (zero if not reported)
+	SolveTimeMs int64  `datastore:"solveTimeMs,noindex"` // Elapsed solve time in milliseconds
+	Attempts    int64  `datastore:"attempts,noindex"`    // Number of answers submitted, including the correct one
+	HintsUsed   int64  `datastore:"hintsUsed,noindex"`   // Number of hints used
+	Shape       string `datastore:"shape,noindex"`       // "line" or "circle", from the answer's kyouen
+	// BestSolveTimeMs is the fastest reported solve time over all clears
+	BestSolveTimeMs int64 `datastore:"bestSolveTimeMs,noindex"`
+}
+
+// Kyouen shapes of an answer
+const (
+	ShapeLine   = "line"
+	ShapeCircle = "circle"
+)
+
+// ClearDetails describes a single clear as reported by the client and checked by the server
+type ClearDetails struct {
+	SolveTimeMs int64
+	Attempts    int64
+	HintsUsed   int64
+	Shape       string
+}
+
+// applyFirstClear records the details of the first clear
+func (su *StageUser) applyFirstClear(details ClearDetails) {
+	su.SolveTimeMs = details.SolveTimeMs
+	su.Attempts = details.Attempts
+	su.HintsUsed = details.HintsUsed
+	su.Shape = details.Shape
+	su.BestSolveTimeMs = details.SolveTimeMs
+}
+
+// applyReclear updates the fastest solve time with a re-clear
+func (su *StageUser) applyReclear(details ClearDetails) {
+	if details.SolveTimeMs > 0 && (su.BestSolveTimeMs == 0 || details.SolveTimeMs < su.BestSolveTimeMs) {
+		su.BestSolveTimeMs = details.SolveTimeMs
+	}
+}
+
+// FirstClearDate returns when the user first cleared the stage
+func (su StageUser) FirstClearDate() time.Time {
+	return su.ClearDate
+}
+
+// LatestClearDate returns when the user last cleared the stage
+func (su StageUser) LatestClearDate() time.Time {
+	if su.LastClearDate.IsZero() {
+		return su.ClearDate
+	}
+	return su.LastClearDate
+}
+
+// Clears returns the number of times the user cleared the stage; legacy records count as one clear
+func (su StageUser) Clears() int64 {
+	if su.ClearCount == 0 {
+		return 1
+	}
+	return su.ClearCount
+}
+
+// merge combines the clear history of another record of the same stage into this one
+func (su *StageUser) merge(other StageUser) {
+	last := su.LatestClearDate()
+	if other.LatestClearDate().After(last) {
+		last = other.LatestClearDate()
+	}
+	if other.ClearDate.Before(su.ClearDate) {
+		// The other record holds the first clear
+		su.ClearDate = other.ClearDate
+		su.SolveTimeMs = other.SolveTimeMs
+		su.Attempts = other.Attempts
+		su.HintsUsed = other.HintsUsed
+		su.Shape = other.Shape
+	}
+	su.applyReclear(ClearDetails{SolveTimeMs: other.BestSolveTimeMs})
+	su.LastClearDate = last
+	su.ClearCount = su.Clears() + other.Clears()
 }
 
+// ClearEvent is an append-only record of a single clear, kept when the clear event log is enabled.
+// Unlike StageUser it is never updated, so it preserves the full clear history for activity feeds and analytics.
+type ClearEvent struct {
+	StageKey   *datastore.Key `datastore:"stage"`
+	UserKey    *datastore.Key `datastore:"user"`
+	ClearDate  time.Time      `datastore:"clearDate"`
+	FirstClear bool           `datastore:"firstClear"` // true if this was the user's first clear of the stage
+	Source     string         `datastore:"source"`     // "clear" (PUT /clear) or "sync" (POST /stages/sync)
+
+	SolveTimeMs int64  `datastore:"solveTimeMs,noindex"`
+	Attempts    int64  `datastore:"attempts,noindex"`
+	HintsUsed   int64  `datastore:"hintsUsed,noindex"`
+	Shape       string `datastore:"shape,noindex"`
+}
+
+// Clear event sources
+const (
+	ClearSourceClear = "clear"
+	ClearSourceSync  = "sync"
+)
+
 type RegistModel struct {
 	StageInfo  *datastore.Key `datastore:"stageInfo"`
 	RegistDate time.Time      `datastore:"registDate"`
@@ -50,3 +174,70 @@ type UserMigration struct {
 	FirebaseUID string    `datastore:"firebaseUid"` // Firebase UID
 	MigratedAt  time.Time `datastore:"migratedAt"`  // マイグレーション実行日時
 }
+
+// DailyChallenge is the stage of the day, keyed by its date (NameKey "2006-01-02", JST)
+type DailyChallenge struct {
+	Date       string         `datastore:"date"`
+	StageKey   *datastore.Key `datastore:"stage"`
+	StageNo    int64          `datastore:"stageNo"`
+	SelectedAt time.Time      `datastore:"selectedAt,noindex"`
+	Notified   bool           `datastore:"notified,noindex"` // whether the daily_challenge push was sent
+}
+
+// Achievement is a badge unlocked by a user, keyed by user and badge (see AchievementKey)
+type Achievement struct {
+	UserKey    *datastore.Key `datastore:"user"`
+	Badge      string         `datastore:"badge"`
+	UnlockedAt time.Time      `datastore:"unlockedAt"` // when the user first met the badge's condition
+}
+
+// Collection is a curated, ordered pack of stages (e.g. "7x7 beginner"), keyed by its ID
+type Collection struct {
+	ID          string           `datastore:"id"` // URL-safe slug, same as the key name
+	Title       string           `datastore:"title,noindex"`
+	Description string           `datastore:"description,noindex"`
+	Author      string           `datastore:"author,noindex"`
+	StageKeys   []*datastore.Key `datastore:"stages,noindex"`   // in play order
+	StageNos    []int64          `datastore:"stageNos,noindex"` // denormalized, same order as StageKeys
+	CreatedAt   time.Time        `datastore:"createdAt"`
+	UpdatedAt   time.Time        `datastore:"updatedAt,noindex"`
+}
+
+// StatisticsSummary is the game-wide statistics computed by the statistics aggregation job (cmd/aggregate_stats).
+// There is a single entity (IDKey 1), replaced on every run.
+type StatisticsSummary struct {
+	StageCount   int64             `datastore:"stageCount,noindex"`
+	StagesBySize []SizeCount       `datastore:"stagesBySize,noindex"` // ascending by size
+	TotalClears  int64             `datastore:"totalClears,noindex"`  // StageUser records, i.e. distinct (user, stage) clears
+	Players      int64             `datastore:"players,noindex"`      // distinct users with at least one clear
+	MostCleared  []StageClearCount `datastore:"mostCleared,noindex"`
+	LeastCleared []StageClearCount `datastore:"leastCleared,noindex"`
+	TopCreators  []CreatorCount    `datastore:"topCreators,noindex"`
+	AggregatedAt time.Time         `datastore:"aggregatedAt,noindex"`
+}
+
+// SizeCount is the number of stages of a grid size
+type SizeCount struct {
+	Size  int64 `datastore:"size"`
+	Count int64 `datastore:"count"`
+}
+
+// StageClearCount is the number of users who cleared a stage
+type StageClearCount struct {
+	StageNo int64 `datastore:"stageNo"`
+	Clears  int64 `datastore:"clears"`
+}
+
+// CreatorCount is the number of stages created by a creator
+type CreatorCount struct {
+	Creator string `datastore:"creator"`
+	Stages  int64  `datastore:"stages"`
+}
+
+// DailyClearStats is the number of first clears on a date, keyed by the date (NameKey "2006-01-02", JST).
+// Written by the statistics aggregation job.
+type DailyClearStats struct {
+	Date    string `datastore:"date"`
+	Clears  int64  `datastore:"clears,noindex"`
+	Players int64  `datastore:"players,noindex"` // distinct users with a first clear on the date
+}
@@ -0,0 +1,187 @@
+// Package events carries activity events (stage clears and new stages) from the services that produce them
+// to live subscribers such as the activity stream.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Event types
+const (
+	TypeClear = "clear"
+	TypeStage = "stage"
+)
+
+const (
+	// DefaultHistorySize is the number of recent events kept for subscribers reconnecting with a last event ID
+	DefaultHistorySize = 256
+	// subscriberBuffer is the number of events queued for a subscriber before it is dropped as too slow
+	subscriberBuffer = 64
+)
+
+// Event is an activity event. IDs are unique across instances and sort in publication order
+// (up to clock skew between instances), so they can be used as SSE event IDs.
+type Event struct {
+	ID   string
+	Type string
+	Data json.RawMessage
+	Time time.Time
+}
+
+var (
+	// instanceID distinguishes the events of this process from those of other instances
+	instanceID = rand.Uint32()
+	eventSeq   atomic.Uint64
+)
+
+// newEventID returns an ID made of the publication time in milliseconds, a sequence number
+// ordering the events of this process within a millisecond, and the instance ID
+func newEventID(t time.Time) string {
+	return fmt.Sprintf("%013d-%06d-%08x", t.UnixMilli(), eventSeq.Add(1)%1000000, instanceID)
+}
+
+// Broker fans events out to every instance of the server. Publish sends an event to all instances,
+// and Run delivers the events published by any instance, including this one, until ctx is done.
+// Brokers may deliver an event more than once; the bus drops duplicates.
+type Broker interface {
+	Publish(ctx context.Context, event Event) error
+	Run(ctx context.Context, deliver func(Event)) error
+}
+
+// Subscription receives the events published after it was created.
+// C is closed when the subscriber falls too far behind; it should reconnect with the last event ID it received.
+type Subscription struct {
+	C  <-chan Event
+	ch chan Event
+}
+
+// Bus is an in-process event bus. Without a broker, events reach the subscribers of this instance only.
+type Bus struct {
+	broker Broker
+
+	mu          sync.Mutex
+	history     []Event // most recent events, oldest first
+	historySize int
+	known       map[string]bool // IDs of the events in history
+	subscribers map[*Subscription]struct{}
+}
+
+// NewBus creates an event bus. Pass a nil broker for a single instance.
+func NewBus(broker Broker, historySize int) *Bus {
+	return &Bus{
+		broker:      broker,
+		historySize: historySize,
+		known:       make(map[string]bool),
+		subscribers: make(map[*Subscription]struct{}),
+	}
+}
+
+// Start delivers the events received from the broker until ctx is done. It does nothing without a broker.
+func (b *Bus) Start(ctx context.Context) {
+	if b.broker == nil {
+		return
+	}
+	go func() {
+		for ctx.Err() == nil {
+			if err := b.broker.Run(ctx, b.deliver); err != nil && ctx.Err() == nil {
+				fmt.Printf("Warning: event broker stopped, restarting: %v\n", err)
+				time.Sleep(time.Second)
+			}
+		}
+	}()
+}
+
+// Publish sends an event with the JSON encoding of data to all subscribers
+func (b *Bus) Publish(ctx context.Context, eventType string, data interface{}) error {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", eventType, err)
+	}
+	now := time.Now()
+	event := Event{ID: newEventID(now), Type: eventType, Data: encoded, Time: now}
+
+	if b.broker == nil {
+		b.deliver(event)
+		return nil
+	}
+	if err := b.broker.Publish(ctx, event); err != nil {
+		return fmt.Errorf("failed to publish %s event: %w", eventType, err)
+	}
+	return nil
+}
+
+// deliver records an event and passes it to the subscribers, dropping duplicates
+func (b *Bus) deliver(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.known[event.ID] {
+		return
+	}
+	b.known[event.ID] = true
+	b.history = append(b.history, event)
+	if len(b.history) > b.historySize {
+		delete(b.known, b.history[0].ID)
+		b.history = b.history[1:]
+	}
+
+	for sub := range b.subscribers {
+		select {
+		case sub.ch <- event:
+		default:
+			// Drop a subscriber that does not keep up rather than blocking the publisher
+			delete(b.subscribers, sub)
+			close(sub.ch)
+		}
+	}
+}
+
+// Subscribe registers a subscriber. With a last event ID, the recent events published after it are returned
+// as a backlog to send before the events received on the subscription.
+func (b *Bus) Subscribe(lastEventID string) (*Subscription, []Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var backlog []Event
+	if lastEventID != "" {
+		// Replay what follows the last event if it is still in history, otherwise what was published later
+		start := -1
+		for i, event := range b.history {
+			if event.ID == lastEventID {
+				start = i + 1
+				break
+			}
+		}
+		if start >= 0 {
+			backlog = append(backlog, b.history[start:]...)
+		} else {
+			for _, event := range b.history {
+				if event.ID > lastEventID {
+					backlog = append(backlog, event)
+				}
+			}
+		}
+	}
+
+	ch := make(chan Event, subscriberBuffer)
+	sub := &Subscription{C: ch, ch: ch}
+	b.subscribers[sub] = struct{}{}
+	return sub, backlog
+}
+
+// Unsubscribe removes a subscriber
+func (b *Bus) Unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subscribers[sub]; ok {
+		delete(b.subscribers, sub)
+		close(sub.ch)
+	}
+}
@@ -0,0 +1,79 @@
+package events
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBus_PublishAndReplay(t *testing.T) {
+	bus := NewBus(nil, 2)
+	ctx := context.Background()
+
+	sub, backlog := bus.Subscribe("")
+	if len(backlog) != 0 {
+		t.Fatalf("Expected no backlog without a last event ID, got %d events", len(backlog))
+	}
+
+	for i := 1; i <= 3; i++ {
+		if err := bus.Publish(ctx, TypeClear, map[string]int{"stage_no": i}); err != nil {
+			t.Fatalf("Publish failed: %v", err)
+		}
+	}
+	var received []Event
+	for i := 0; i < 3; i++ {
+		received = append(received, <-sub.C)
+	}
+	if string(received[2].Data) != `{"stage_no":3}` {
+		t.Errorf("Expected the third event, got %s", received[2].Data)
+	}
+	if !(received[0].ID < received[1].ID && received[1].ID < received[2].ID) {
+		t.Errorf("Expected increasing event IDs, got %s, %s, %s", received[0].ID, received[1].ID, received[2].ID)
+	}
+
+	// Reconnecting after the first event replays the rest of the history
+	_, backlog = bus.Subscribe(received[0].ID)
+	if len(backlog) != 2 || backlog[0].ID != received[1].ID {
+		t.Errorf("Expected the 2 events after the last event ID, got %v", backlog)
+	}
+
+	// Duplicates delivered by a broker are dropped
+	bus.deliver(received[2])
+	select {
+	case e := <-sub.C:
+		t.Errorf("Expected a duplicate event to be dropped, got %s", e.ID)
+	default:
+	}
+}
+
+func TestBus_DropsSlowSubscriber(t *testing.T) {
+	bus := NewBus(nil, DefaultHistorySize)
+	sub, _ := bus.Subscribe("")
+
+	for i := 0; i <= subscriberBuffer; i++ {
+		bus.Publish(context.Background(), TypeStage, i)
+	}
+
+	count := 0
+	for range sub.C {
+		count++
+	}
+	if count != subscriberBuffer {
+		t.Errorf("Expected the channel to be closed after %d buffered events, got %d", subscriberBuffer, count)
+	}
+	bus.Unsubscribe(sub) // must not panic on a dropped subscriber
+}
+
+func TestWriteSSE(t *testing.T) {
+	var b strings.Builder
+	event := Event{ID: "1700000000000-000001-0000abcd", Type: TypeClear, Data: []byte(`{"stage_no":1}`), Time: time.Now()}
+	if err := WriteSSE(&b, event); err != nil {
+		t.Fatalf("WriteSSE failed: %v", err)
+	}
+
+	expected := "id: 1700000000000-000001-0000abcd\nevent: clear\ndata: {\"stage_no\":1}\n\n"
+	if b.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, b.String())
+	}
+}
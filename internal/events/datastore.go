@@ -0,0 +1,76 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/datastore"
+)
+
+const (
+	// datastoreBrokerLookback re-reads recent events on every poll so that events committed late,
+	// or stamped by an instance whose clock is behind, are not missed (the bus drops the duplicates)
+	datastoreBrokerLookback = 10 * time.Second
+	// datastoreBrokerRetention is how long events are kept; configure a TTL policy on expireAt to delete them
+	datastoreBrokerRetention = time.Hour
+)
+
+// activityEventEntity is the Datastore entity of an event (kind ActivityEvent, keyed by the event ID)
+type activityEventEntity struct {
+	Type     string    `datastore:"type,noindex"`
+	Data     []byte    `datastore:"data,noindex"`
+	Time     time.Time `datastore:"time"`
+	ExpireAt time.Time `datastore:"expireAt"`
+}
+
+// DatastoreBroker shares events between instances through Datastore: Publish stores the event,
+// and every instance polls for new events. Events reach other instances within about one poll interval.
+type DatastoreBroker struct {
+	client   *datastore.Client
+	interval time.Duration
+}
+
+func NewDatastoreBroker(client *datastore.Client, interval time.Duration) *DatastoreBroker {
+	return &DatastoreBroker{client: client, interval: interval}
+}
+
+func (b *DatastoreBroker) Publish(ctx context.Context, event Event) error {
+	entity := &activityEventEntity{
+		Type:     event.Type,
+		Data:     event.Data,
+		Time:     event.Time,
+		ExpireAt: event.Time.Add(datastoreBrokerRetention),
+	}
+	if _, err := b.client.Put(ctx, datastore.NameKey("ActivityEvent", event.ID, nil), entity); err != nil {
+		return fmt.Errorf("failed to save activity event: %w", err)
+	}
+	return nil
+}
+
+func (b *DatastoreBroker) Run(ctx context.Context, deliver func(Event)) error {
+	since := time.Now().Add(-datastoreBrokerLookback)
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		polledAt := time.Now()
+		query := datastore.NewQuery("ActivityEvent").FilterField("time", ">", since).Order("time")
+		var entities []activityEventEntity
+		keys, err := b.client.GetAll(ctx, query, &entities)
+		if err != nil {
+			return fmt.Errorf("failed to poll activity events: %w", err)
+		}
+		for i, e := range entities {
+			deliver(Event{ID: keys[i].Name, Type: e.Type, Data: json.RawMessage(e.Data), Time: e.Time})
+		}
+		since = polledAt.Add(-datastoreBrokerLookback)
+	}
+}
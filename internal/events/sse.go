@@ -0,0 +1,33 @@
+package events
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// WriteSSE writes an event in the Server-Sent Events format
+func WriteSSE(w io.Writer, event Event) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "id: %s\nevent: %s\n", event.ID, event.Type)
+	// JSON has no raw newlines, but split anyway so that a multi-line payload stays a single event
+	for _, line := range strings.Split(string(event.Data), "\n") {
+		fmt.Fprintf(&b, "data: %s\n", line)
+	}
+	b.WriteString("\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteSSERetry tells the client how long to wait before reconnecting
+func WriteSSERetry(w io.Writer, retry time.Duration) error {
+	_, err := fmt.Fprintf(w, "retry: %d\n\n", retry.Milliseconds())
+	return err
+}
+
+// WriteSSEHeartbeat writes a comment line that keeps idle connections (and proxies) open
+func WriteSSEHeartbeat(w io.Writer) error {
+	_, err := io.WriteString(w, ": heartbeat\n\n")
+	return err
+}
@@ -11,30 +11,46 @@
 package openapi
 
 
+import (
+	"errors"
+)
+
 
 
 // ClearStage - ユーザーの解答を示すステージクリアデータ
 type ClearStage struct {
 
 	// ユーザーの完成ステージ設定。 有効な共円（ちょうど4つの石で形成される円/直線）を形成する必要があります。 形式: \"0\"=空, \"1\"=黒石(元から), \"2\"=白石(ユーザー配置) 
-	Stage string `json:"stage" validate:"regexp=^[012]+$"`
+	Stage string `json:"stage,omitempty" validate:"regexp=^[012]+$"`
+
+	// stage のコンパクト表現（バージョン付きビットセットの base64url）。stage の代わりに指定できる
+	StageCompact string `json:"stage_compact,omitempty" validate:"regexp=^[A-Za-z0-9_-]+$"`
+
+	// クリアまでの経過時間（ミリ秒）。省略可
+	SolveTimeMs int64 `json:"solve_time_ms,omitempty"`
+
+	// 正解までに送信した解答の回数（正解を含む）。省略可
+	Attempts int64 `json:"attempts,omitempty"`
+
+	// 使用したヒントの数。省略可
+	HintsUsed int64 `json:"hints_used,omitempty"`
 }
 
 // AssertClearStageRequired checks if the required fields are not zero-ed
 func AssertClearStageRequired(obj ClearStage) error {
-	elements := map[string]interface{}{
-		"stage": obj.Stage,
-	}
-	for name, el := range elements {
-		if isZero := IsZeroValue(el); isZero {
-			return &RequiredError{Field: name}
-		}
-	}
-
 	return nil
 }
 
 // AssertClearStageConstraints checks if the values respects the defined constraints
 func AssertClearStageConstraints(obj ClearStage) error {
+	if obj.SolveTimeMs < 0 {
+		return &ParsingError{Param: "SolveTimeMs", Err: errors.New(errMsgMinValueConstraint)}
+	}
+	if obj.Attempts < 0 {
+		return &ParsingError{Param: "Attempts", Err: errors.New(errMsgMinValueConstraint)}
+	}
+	if obj.HintsUsed < 0 {
+		return &ParsingError{Param: "HintsUsed", Err: errors.New(errMsgMinValueConstraint)}
+	}
 	return nil
 }
@@ -18,6 +18,12 @@ type LoginParam struct {
 
 	// Firebase IDトークン（Twitter認証プロバイダー経由で取得）
 	Token string `json:"token"`
+
+	// 未ログイン時に使用していたデバイスID。指定すると匿名ユーザーのクリア履歴をログインユーザーに統合する
+	DeviceId string `json:"device_id,omitempty"`
+
+	// デバイスID発行時に返されたデバイストークン。device_id を指定する場合は必須
+	DeviceToken string `json:"device_token,omitempty"`
 }
 
 // AssertLoginParamRequired checks if the required fields are not zero-ed
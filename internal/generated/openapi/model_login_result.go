@@ -18,6 +18,9 @@ type LoginResult struct {
 
 	// 認証されたユーザーのTwitterスクリーン名（@なし）
 	ScreenName string `json:"screen_name"`
+
+	// アカウントに紐づくサインインプロバイダーID（例: twitter.com, google.com, apple.com, github.com, password）
+	Providers []string `json:"providers,omitempty"`
 }
 
 // AssertLoginResultRequired checks if the required fields are not zero-ed
@@ -20,11 +20,14 @@ import (
 // NewStage - 新しい共円パズルステージ作成用データ
 type NewStage struct {
 
-	// 新しいステージのグリッドサイズ（size x sizeグリッドを作成）
-	Size int64 `json:"size"`
+	// 新しいステージのグリッドサイズ（size x sizeグリッドを作成）。stage_compact を指定する場合は省略可
+	Size int64 `json:"size,omitempty"`
 
 	// 解答付きステージ設定文字列。 合計5個以上の石を含み、有効な共円を形成する必要があります。 形式: size²文字 (\"0\"=空, \"1\"=黒石, \"2\"=白石) 
-	Stage string `json:"stage" validate:"regexp=^[012]+$"`
+	Stage string `json:"stage,omitempty" validate:"regexp=^[012]+$"`
+
+	// stage のコンパクト表現（バージョン付きビットセットの base64url）。stage の代わりに指定できる
+	StageCompact string `json:"stage_compact,omitempty" validate:"regexp=^[A-Za-z0-9_-]+$"`
 
 	// ステージ作成者のユーザー名
 	Creator string `json:"creator"`
@@ -33,8 +36,6 @@ type NewStage struct {
 // AssertNewStageRequired checks if the required fields are not zero-ed
 func AssertNewStageRequired(obj NewStage) error {
 	elements := map[string]interface{}{
-		"size": obj.Size,
-		"stage": obj.Stage,
 		"creator": obj.Creator,
 	}
 	for name, el := range elements {
@@ -30,6 +30,9 @@ type Stage struct {
 	// 文字列表現でのステージ設定。 形式: size²文字で以下を表す: - \"0\" = 空のセル - \"1\" = 黒石（パズル要素） - \"2\" = 白石（ユーザー配置）
 	Stage string `json:"stage" validate:"regexp=^[012]+$"`
 
+	// stage のコンパクト表現（バージョン付きビットセットの base64url）
+	StageCompact string `json:"stage_compact,omitempty" validate:"regexp=^[A-Za-z0-9_-]+$"`
+
 	// ステージ作成者のユーザー名
 	Creator string `json:"creator"`
 
@@ -38,6 +41,15 @@ type Stage struct {
 
 	// ログインユーザーがこのステージをクリアした日時（ログイン時のみ返却。非nullの場合クリア済み）
 	ClearDate *time.Time `json:"clear_date,omitempty"`
+
+	// このステージをクリアしたユーザー数
+	ClearCount int64 `json:"clear_count"`
+
+	// このステージを最初にクリアしたユーザーのスクリーンネーム（未クリア、または退会・不正判定されたユーザーの場合は省略）
+	FirstClearedBy string `json:"first_cleared_by,omitempty"`
+
+	// このステージが最初にクリアされた日時 (UTC)
+	FirstClearedAt *time.Time `json:"first_cleared_at,omitempty"`
 }
 
 // AssertStageRequired checks if the required fields are not zero-ed
@@ -48,6 +60,7 @@ func AssertStageRequired(obj Stage) error {
 		"stage": obj.Stage,
 		"creator": obj.Creator,
 		"regist_date": obj.RegistDate,
+		"clear_count": obj.ClearCount,
 	}
 	for name, el := range elements {
 		if isZero := IsZeroValue(el); isZero {
@@ -69,5 +82,8 @@ func AssertStageConstraints(obj Stage) error {
 	if obj.Size > 20 {
 		return &ParsingError{Param: "Size", Err: errors.New(errMsgMaxValueConstraint)}
 	}
+	if obj.ClearCount < 0 {
+		return &ParsingError{Param: "ClearCount", Err: errors.New(errMsgMinValueConstraint)}
+	}
 	return nil
 }
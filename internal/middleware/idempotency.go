@@ -0,0 +1,205 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"kyouen-server/internal/auth"
+	"kyouen-server/internal/problem"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// IdempotencyKeyHeader is the request header carrying the client-generated idempotency key
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader is set on responses replayed from a stored result
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+
+	// maxIdempotencyKeyLength bounds the key size (a UUID is 36 characters)
+	maxIdempotencyKeyLength = 255
+	// idempotencyLockTTL is how long a key stays reserved by a request that never completes (e.g. a crashed instance)
+	idempotencyLockTTL = time.Minute
+)
+
+var (
+	problemInvalidIdempotencyKey    = problem.Type{Status: http.StatusBadRequest, Code: "INVALID_IDEMPOTENCY_KEY", Title: "Invalid Idempotency-Key"}
+	problemIdempotencyKeyReused     = problem.Type{Status: http.StatusUnprocessableEntity, Code: "IDEMPOTENCY_KEY_REUSED", Title: "Idempotency-Key was already used for a different request"}
+	problemIdempotencyKeyInProgress = problem.Type{Status: http.StatusConflict, Code: "IDEMPOTENCY_KEY_IN_PROGRESS", Title: "A request with this Idempotency-Key is still in progress"}
+)
+
+// IdempotencyRecord is the stored result of a request made with an idempotency key
+type IdempotencyRecord struct {
+	Fingerprint string // hash of the method, path and body of the original request
+	Completed   bool   // false while the original request is being processed
+	Status      int
+	ContentType string
+	Body        []byte
+	ExpiresAt   time.Time
+}
+
+// IdempotencyStore keeps idempotency records. Reserve stores the record unless an unexpired record
+// already exists for the key, in which case that record is returned instead.
+// Implementations must be safe for concurrent use; use a shared store (DatastoreIdempotencyStore)
+// when several instances serve the API, since retries may reach any of them.
+type IdempotencyStore interface {
+	Reserve(ctx context.Context, key string, record IdempotencyRecord, now time.Time) (*IdempotencyRecord, error)
+	Save(ctx context.Context, key string, record IdempotencyRecord) error
+	Delete(ctx context.Context, key string) error
+}
+
+// Idempotency makes a route safe to retry with an Idempotency-Key header. The first request with a key
+// runs normally and its response is stored for ttl; a retry with the same key and request replays the stored
+// response, a reuse of the key for a different request gets 422, and a retry while the first request is still
+// running gets 409. Keys are scoped to the route and the signed-in user. Requests without the header,
+// and responses with 5xx or 429 status, are not stored so that the client can retry them.
+// Register it after the route's auth middleware and before rate limiting, so that replays are not throttled.
+func Idempotency(name string, ttl time.Duration, store IdempotencyStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			problem.Write(c, problemInvalidIdempotencyKey, fmt.Sprintf("%s must be at most %d characters", IdempotencyKeyHeader, maxIdempotencyKeyLength))
+			c.Abort()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			problem.Write(c, problem.InvalidRequest, "failed to read request body")
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		uid, _ := auth.GetAuthenticatedUID(c)
+		scopedKey := name + ":" + uid + ":" + key
+		fingerprint := requestFingerprint(c.Request.Method, c.Request.URL.Path, body)
+		ctx := c.Request.Context()
+		now := time.Now()
+
+		existing, err := store.Reserve(ctx, scopedKey, IdempotencyRecord{Fingerprint: fingerprint, ExpiresAt: now.Add(idempotencyLockTTL)}, now)
+		if err != nil {
+			// Process the request anyway; a failing store must not make the endpoint unavailable
+			fmt.Printf("Warning: idempotency store failed for %s: %v\n", scopedKey, err)
+			c.Next()
+			return
+		}
+		if existing != nil {
+			switch {
+			case existing.Fingerprint != fingerprint:
+				problem.Write(c, problemIdempotencyKeyReused, "")
+				c.Abort()
+			case !existing.Completed:
+				problem.Write(c, problemIdempotencyKeyInProgress, "")
+				c.Abort()
+			default:
+				c.Header(IdempotentReplayedHeader, "true")
+				c.Data(existing.Status, existing.ContentType, existing.Body)
+				c.Abort()
+			}
+			return
+		}
+
+		writer := &bufferingWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+
+		// Use a fresh context: the response is complete even if the client has gone away
+		storeCtx := context.WithoutCancel(ctx)
+		status := writer.Status()
+		if status >= http.StatusInternalServerError || status == http.StatusTooManyRequests {
+			if err := store.Delete(storeCtx, scopedKey); err != nil {
+				fmt.Printf("Warning: failed to release idempotency key %s: %v\n", scopedKey, err)
+			}
+			return
+		}
+		record := IdempotencyRecord{
+			Fingerprint: fingerprint,
+			Completed:   true,
+			Status:      status,
+			ContentType: writer.Header().Get("Content-Type"),
+			Body:        writer.body.Bytes(),
+			ExpiresAt:   time.Now().Add(ttl),
+		}
+		if err := store.Save(storeCtx, scopedKey, record); err != nil {
+			fmt.Printf("Warning: failed to save idempotency record %s: %v\n", scopedKey, err)
+		}
+	}
+}
+
+// requestFingerprint identifies a request so that a key reused for a different request can be detected
+func requestFingerprint(method, path string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method + " " + path + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// bufferingWriter copies the response body so that it can be stored
+type bufferingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *bufferingWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *bufferingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// MemoryIdempotencyStore keeps idempotency records in process memory
+type MemoryIdempotencyStore struct {
+	mu      sync.Mutex
+	records map[string]IdempotencyRecord
+}
+
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{records: make(map[string]IdempotencyRecord)}
+}
+
+func (s *MemoryIdempotencyStore) Reserve(ctx context.Context, key string, record IdempotencyRecord, now time.Time) (*IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, ok := s.records[key]; ok && now.Before(existing.ExpiresAt) {
+		return &existing, nil
+	}
+	if len(s.records) >= memorySweepThreshold {
+		for k, r := range s.records {
+			if !now.Before(r.ExpiresAt) {
+				delete(s.records, k)
+			}
+		}
+	}
+	s.records[key] = record
+	return nil, nil
+}
+
+func (s *MemoryIdempotencyStore) Save(ctx context.Context, key string, record IdempotencyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[key] = record
+	return nil
+}
+
+func (s *MemoryIdempotencyStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, key)
+	return nil
+}
@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/datastore"
+)
+
+// idempotencyEntity is the Datastore entity of an idempotency record (kind IdempotencyRecord, keyed by the scoped key)
+type idempotencyEntity struct {
+	Fingerprint string    `datastore:"fingerprint,noindex"`
+	Completed   bool      `datastore:"completed,noindex"`
+	Status      int64     `datastore:"status,noindex"`
+	ContentType string    `datastore:"contentType,noindex"`
+	Body        []byte    `datastore:"body,noindex"`
+	ExpiresAt   time.Time `datastore:"expiresAt"`
+}
+
+func newIdempotencyEntity(record IdempotencyRecord) *idempotencyEntity {
+	return &idempotencyEntity{
+		Fingerprint: record.Fingerprint,
+		Completed:   record.Completed,
+		Status:      int64(record.Status),
+		ContentType: record.ContentType,
+		Body:        record.Body,
+		ExpiresAt:   record.ExpiresAt,
+	}
+}
+
+func (e *idempotencyEntity) record() IdempotencyRecord {
+	return IdempotencyRecord{
+		Fingerprint: e.Fingerprint,
+		Completed:   e.Completed,
+		Status:      int(e.Status),
+		ContentType: e.ContentType,
+		Body:        e.Body,
+		ExpiresAt:   e.ExpiresAt,
+	}
+}
+
+// DatastoreIdempotencyStore keeps idempotency records in Datastore so that retries reaching
+// another instance are recognized. Expired records are overwritten on reuse and can be deleted at any time.
+type DatastoreIdempotencyStore struct {
+	client *datastore.Client
+}
+
+func NewDatastoreIdempotencyStore(client *datastore.Client) *DatastoreIdempotencyStore {
+	return &DatastoreIdempotencyStore{client: client}
+}
+
+func idempotencyKey(key string) *datastore.Key {
+	return datastore.NameKey("IdempotencyRecord", key, nil)
+}
+
+func (s *DatastoreIdempotencyStore) Reserve(ctx context.Context, key string, record IdempotencyRecord, now time.Time) (*IdempotencyRecord, error) {
+	var existing *IdempotencyRecord
+
+	_, err := s.client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		existing = nil
+		var entity idempotencyEntity
+		err := tx.Get(idempotencyKey(key), &entity)
+		if err != nil && err != datastore.ErrNoSuchEntity {
+			return fmt.Errorf("failed to get idempotency record: %w", err)
+		}
+		if err == nil && now.Before(entity.ExpiresAt) {
+			r := entity.record()
+			existing = &r
+			return nil
+		}
+		if _, err := tx.Put(idempotencyKey(key), newIdempotencyEntity(record)); err != nil {
+			return fmt.Errorf("failed to reserve idempotency key: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return existing, nil
+}
+
+func (s *DatastoreIdempotencyStore) Save(ctx context.Context, key string, record IdempotencyRecord) error {
+	if _, err := s.client.Put(ctx, idempotencyKey(key), newIdempotencyEntity(record)); err != nil {
+		return fmt.Errorf("failed to save idempotency record: %w", err)
+	}
+	return nil
+}
+
+func (s *DatastoreIdempotencyStore) Delete(ctx context.Context, key string) error {
+	if err := s.client.Delete(ctx, idempotencyKey(key)); err != nil {
+		return fmt.Errorf("failed to delete idempotency record: %w", err)
+	}
+	return nil
+}
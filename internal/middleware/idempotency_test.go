@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestIdempotency(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	calls := 0
+	router := gin.New()
+	router.POST("/stages", Idempotency("test", time.Hour, NewMemoryIdempotencyStore()), func(c *gin.Context) {
+		calls++
+		if calls == 2 {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "temporary failure"})
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"stageNo": calls})
+	})
+
+	request := func(key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/stages", strings.NewReader(body))
+		if key != "" {
+			req.Header.Set(IdempotencyKeyHeader, key)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	first := request("key-1", `{"stage":"a"}`)
+	if first.Code != http.StatusCreated {
+		t.Fatalf("first request must succeed, got %d", first.Code)
+	}
+
+	replay := request("key-1", `{"stage":"a"}`)
+	if replay.Code != http.StatusCreated || replay.Body.String() != first.Body.String() {
+		t.Errorf("replay must return the original response, got %d %s", replay.Code, replay.Body.String())
+	}
+	if replay.Header().Get(IdempotentReplayedHeader) != "true" {
+		t.Errorf("replay must be marked with %s", IdempotentReplayedHeader)
+	}
+	if calls != 1 {
+		t.Errorf("replay must not run the handler again, calls = %d", calls)
+	}
+
+	if w := request("key-1", `{"stage":"b"}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("reusing a key for a different request must return 422, got %d", w.Code)
+	}
+
+	// Server errors are not stored, so the request can be retried with the same key
+	if w := request("key-2", `{"stage":"c"}`); w.Code != http.StatusInternalServerError {
+		t.Fatalf("expected the handler's 500, got %d", w.Code)
+	}
+	if w := request("key-2", `{"stage":"c"}`); w.Code != http.StatusCreated || w.Header().Get(IdempotentReplayedHeader) != "" {
+		t.Errorf("retry after a server error must run the handler, got %d", w.Code)
+	}
+}
@@ -0,0 +1,158 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"kyouen-server/internal/auth"
+	"kyouen-server/internal/problem"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Limit is a token bucket budget: up to Requests requests at once, refilled at Requests per Per.
+// A zero Limit disables rate limiting.
+type Limit struct {
+	Requests int
+	Per      time.Duration
+}
+
+// Enabled reports whether the limit restricts anything
+func (l Limit) Enabled() bool {
+	return l.Requests > 0 && l.Per > 0
+}
+
+// rate returns the number of tokens refilled per second
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Per.Seconds()
+}
+
+// RateLimitStore holds the token buckets of rate-limited clients.
+// Take consumes a token from the bucket identified by key and reports whether the request is allowed;
+// if not, retryAfter is how long until a token becomes available.
+// Implementations must be safe for concurrent use. MemoryStore limits a single instance;
+// a shared store such as DatastoreStore enforces the budget across all Cloud Run instances.
+type RateLimitStore interface {
+	Take(ctx context.Context, key string, limit Limit, now time.Time) (allowed bool, retryAfter time.Duration, err error)
+}
+
+// TokenBucket is the persisted state of a bucket
+type TokenBucket struct {
+	Tokens    float64
+	UpdatedAt time.Time
+}
+
+// take refills the bucket for the time elapsed since its last update and consumes one token if available
+func (b *TokenBucket) take(limit Limit, now time.Time) (bool, time.Duration) {
+	if b.UpdatedAt.IsZero() {
+		b.Tokens = float64(limit.Requests)
+	} else if elapsed := now.Sub(b.UpdatedAt); elapsed > 0 {
+		b.Tokens = math.Min(float64(limit.Requests), b.Tokens+elapsed.Seconds()*limit.rate())
+	}
+	b.UpdatedAt = now
+
+	if b.Tokens >= 1 {
+		b.Tokens--
+		return true, 0
+	}
+	wait := (1 - b.Tokens) / limit.rate()
+	return false, time.Duration(math.Ceil(wait * float64(time.Second)))
+}
+
+// full reports whether the bucket has refilled completely, i.e. it no longer carries any state
+func (b *TokenBucket) full(limit Limit, now time.Time) bool {
+	return b.Tokens+now.Sub(b.UpdatedAt).Seconds()*limit.rate() >= float64(limit.Requests)
+}
+
+// memorySweepThreshold is the number of buckets above which MemoryStore drops full buckets
+const memorySweepThreshold = 10000
+
+// problemRateLimitExceeded is sent with Retry-After when a client has no tokens left
+var problemRateLimitExceeded = problem.Type{Status: http.StatusTooManyRequests, Code: "RATE_LIMIT_EXCEEDED", Title: "Rate limit exceeded, try again later"}
+
+type memoryBucket struct {
+	bucket TokenBucket
+	limit  Limit
+}
+
+// MemoryStore keeps token buckets in process memory. It is the default store;
+// with several instances each one enforces the budget separately.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*memoryBucket
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]*memoryBucket)}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, limit Limit, now time.Time) (bool, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.buckets[key]
+	if !ok {
+		if len(s.buckets) >= memorySweepThreshold {
+			s.sweep(now)
+		}
+		b = &memoryBucket{}
+		s.buckets[key] = b
+	}
+	b.limit = limit
+	allowed, retryAfter := b.bucket.take(limit, now)
+	return allowed, retryAfter, nil
+}
+
+// sweep drops buckets that have refilled completely, since a new bucket starts full
+func (s *MemoryStore) sweep(now time.Time) {
+	for key, b := range s.buckets {
+		if b.bucket.full(b.limit, now) {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+// DefaultTrustedProxies are the addresses Cloud Run requests arrive from: the serverless infrastructure
+// (link-local) and Google Front Ends of external load balancers. Their X-Forwarded-For entries are trusted,
+// so that gin's ClientIP returns the address appended by Google instead of a value set by the client.
+var DefaultTrustedProxies = []string{"169.254.0.0/16", "35.191.0.0/16", "130.211.0.0/22"}
+
+// RateLimit throttles a route with the given budget. Clients are identified by their UID when signed in,
+// or by their IP address otherwise; guests and anonymous device users share the budget of their IP,
+// since device IDs can be issued freely. The engine must trust only the actual proxies (see DefaultTrustedProxies),
+// or a forged X-Forwarded-For gets a fresh budget. Register it after the route's auth middleware, if any.
+// Rejected requests get 429 with a Retry-After header. If the store fails, the request is allowed.
+func RateLimit(name string, limit Limit, store RateLimitStore) gin.HandlerFunc {
+	if !limit.Enabled() {
+		return func(c *gin.Context) {
+			c.Next()
+		}
+	}
+
+	return func(c *gin.Context) {
+		key := name + ":ip:" + c.ClientIP()
+		if uid, ok := auth.GetAuthenticatedUID(c); ok && !auth.IsGuestUser(uid) && !auth.IsAnonymousUser(uid) {
+			key = name + ":uid:" + uid
+		}
+
+		allowed, retryAfter, err := store.Take(c.Request.Context(), key, limit, time.Now())
+		if err != nil {
+			fmt.Printf("Warning: rate limit store failed for %s: %v\n", key, err)
+			c.Next()
+			return
+		}
+		if !allowed {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			problem.Write(c, problemRateLimitExceeded, "")
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/datastore"
+)
+
+// rateLimitBucket is the Datastore entity of a token bucket (kind RateLimitBucket, keyed by the limiter key)
+type rateLimitBucket struct {
+	Tokens    float64   `datastore:"tokens,noindex"`
+	UpdatedAt time.Time `datastore:"updatedAt,noindex"`
+}
+
+// DatastoreStore keeps token buckets in Datastore so that all instances share the budget.
+// Every request costs a transaction, so use it only for low-traffic write endpoints.
+type DatastoreStore struct {
+	client *datastore.Client
+}
+
+func NewDatastoreStore(client *datastore.Client) *DatastoreStore {
+	return &DatastoreStore{client: client}
+}
+
+func (s *DatastoreStore) Take(ctx context.Context, key string, limit Limit, now time.Time) (bool, time.Duration, error) {
+	var allowed bool
+	var retryAfter time.Duration
+
+	entityKey := datastore.NameKey("RateLimitBucket", key, nil)
+	_, err := s.client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		var entity rateLimitBucket
+		if err := tx.Get(entityKey, &entity); err != nil && err != datastore.ErrNoSuchEntity {
+			return fmt.Errorf("failed to get rate limit bucket: %w", err)
+		}
+
+		bucket := TokenBucket{Tokens: entity.Tokens, UpdatedAt: entity.UpdatedAt}
+		allowed, retryAfter = bucket.take(limit, now)
+
+		entity = rateLimitBucket{Tokens: bucket.Tokens, UpdatedAt: bucket.UpdatedAt}
+		if _, err := tx.Put(entityKey, &entity); err != nil {
+			return fmt.Errorf("failed to save rate limit bucket: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return false, 0, err
+	}
+
+	return allowed, retryAfter, nil
+}
@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"kyouen-server/internal/auth"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMemoryStore_Take(t *testing.T) {
+	store := NewMemoryStore()
+	limit := Limit{Requests: 2, Per: time.Minute}
+	now := time.Now()
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if allowed, _, _ := store.Take(ctx, "k", limit, now); !allowed {
+			t.Fatalf("request %d within the burst must be allowed", i+1)
+		}
+	}
+
+	allowed, retryAfter, _ := store.Take(ctx, "k", limit, now)
+	if allowed {
+		t.Fatalf("request beyond the burst must be rejected")
+	}
+	if retryAfter != 30*time.Second {
+		t.Errorf("Expected retry after 30s (one token per 30s), got %v", retryAfter)
+	}
+
+	if allowed, _, _ := store.Take(ctx, "other", limit, now); !allowed {
+		t.Errorf("buckets of other keys must be independent")
+	}
+	if allowed, _, _ := store.Take(ctx, "k", limit, now.Add(30*time.Second)); !allowed {
+		t.Errorf("request must be allowed after a token is refilled")
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		if uid := c.GetHeader("X-Test-UID"); uid != "" {
+			c.Set(auth.AuthUIDKey, uid)
+		}
+		c.Next()
+	})
+	router.POST("/limited", RateLimit("test", Limit{Requests: 1, Per: time.Hour}, NewMemoryStore()), func(c *gin.Context) {
+		c.Status(http.StatusCreated)
+	})
+
+	request := func(uid string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/limited", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		if uid != "" {
+			req.Header.Set("X-Test-UID", uid)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := request(""); w.Code != http.StatusCreated {
+		t.Fatalf("first request must pass, got %d", w.Code)
+	}
+	w := request(auth.GuestUID)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("guest on the same IP must share the budget, got %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") != "3600" {
+		t.Errorf("Expected Retry-After 3600, got %q", w.Header().Get("Retry-After"))
+	}
+	if w := request("user-1"); w.Code != http.StatusCreated {
+		t.Errorf("signed-in user must have their own budget, got %d", w.Code)
+	}
+}
+
+func TestRateLimit_ForgedForwardedFor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	if err := router.SetTrustedProxies(DefaultTrustedProxies); err != nil {
+		t.Fatal(err)
+	}
+	router.POST("/limited", RateLimit("test", Limit{Requests: 1, Per: time.Hour}, NewMemoryStore()), func(c *gin.Context) {
+		c.Status(http.StatusCreated)
+	})
+
+	// Cloud Run appends the real client address to whatever X-Forwarded-For the client sent
+	request := func(forwardedFor string) int {
+		req := httptest.NewRequest(http.MethodPost, "/limited", nil)
+		req.RemoteAddr = "169.254.1.1:1234"
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := request("203.0.113.5"); code != http.StatusCreated {
+		t.Fatalf("first request must pass, got %d", code)
+	}
+	if code := request("198.51.100.1, 203.0.113.5"); code != http.StatusTooManyRequests {
+		t.Errorf("forged X-Forwarded-For must not get a fresh budget, got %d", code)
+	}
+	if code := request("203.0.113.6"); code != http.StatusCreated {
+		t.Errorf("another client must have its own budget, got %d", code)
+	}
+}
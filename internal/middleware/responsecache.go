@@ -0,0 +1,325 @@
+package middleware
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"kyouen-server/internal/auth"
+	"kyouen-server/internal/events"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CachedResponse is a response stored by ResponseCache
+type CachedResponse struct {
+	Status       int
+	Header       http.Header // headers set by the handler (e.g. Cache-Control, X-Next-Cursor)
+	Body         []byte
+	ETag         string
+	LastModified time.Time
+}
+
+// ResponseCacheStore keeps cached responses. Entries are grouped by cache name, and each group has a generation:
+// Bump starts a new generation, so that the entries stored under the previous one are no longer read
+// and expire on their own. Get returns nil for a missing or expired entry.
+// Implementations must be safe for concurrent use. MemoryResponseCacheStore caches per instance;
+// a shared store such as RedisResponseCacheStore makes an invalidation visible to all instances at once.
+type ResponseCacheStore interface {
+	Get(ctx context.Context, key string) (*CachedResponse, error)
+	Set(ctx context.Context, key string, response CachedResponse, ttl time.Duration) error
+	Generation(ctx context.Context, name string) (int64, error)
+	Bump(ctx context.Context, name string) error
+}
+
+// ResponseCache serves successful GET responses of a route from store for up to ttl, and answers conditional
+// requests: every response carries an ETag (hash of the body) and Last-Modified (when the response was
+// generated), and a request whose If-None-Match or If-Modified-Since matches gets 304 without a body.
+// Responses are cached per signed-in user, so that personalized fields are never served to someone else,
+// and per path and query. Only 200 responses are stored. A failing store does not fail the request.
+// Register it after the route's auth middleware.
+func ResponseCache(name string, ttl time.Duration, store ResponseCacheStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+			c.Next()
+			return
+		}
+
+		ctx := c.Request.Context()
+		generation, err := store.Generation(ctx, name)
+		if err != nil {
+			fmt.Printf("Warning: response cache store failed for %s: %v\n", name, err)
+			c.Next()
+			return
+		}
+		uid, _ := auth.GetAuthenticatedUID(c)
+		key := fmt.Sprintf("%s:%d:%s:%s?%s", name, generation, uid, c.Request.URL.Path, c.Request.URL.Query().Encode())
+
+		cached, err := store.Get(ctx, key)
+		if err != nil {
+			fmt.Printf("Warning: response cache store failed for %s: %v\n", key, err)
+		}
+		if cached != nil {
+			for header, values := range cached.Header {
+				c.Writer.Header()[header] = values
+			}
+			writeCachedResponse(c, cached)
+			c.Abort()
+			return
+		}
+
+		// Only the headers set by the handler are stored; those of earlier middleware are set on every request
+		before := c.Writer.Header().Clone()
+		writer := &capturingWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+		c.Writer = writer.ResponseWriter
+
+		if writer.Status() != http.StatusOK {
+			c.Writer.WriteHeaderNow()
+			c.Writer.Write(writer.body.Bytes())
+			return
+		}
+		// Let clients and proxies keep the response but revalidate it with the validators before reuse.
+		// Responses with the fields of a signed-in user must not be stored by shared caches.
+		if c.Writer.Header().Get("Cache-Control") == "" {
+			if uid != "" && !auth.IsGuestUser(uid) {
+				c.Header("Cache-Control", "private, no-cache")
+			} else {
+				c.Header("Cache-Control", "no-cache")
+			}
+		}
+		response := CachedResponse{
+			Status:       http.StatusOK,
+			Header:       handlerHeaders(before, c.Writer.Header()),
+			Body:         writer.body.Bytes(),
+			ETag:         bodyETag(writer.body.Bytes()),
+			LastModified: time.Now().UTC().Truncate(time.Second),
+		}
+		// Use a fresh context: the response is complete even if the client has gone away
+		if err := store.Set(context.WithoutCancel(ctx), key, response, ttl); err != nil {
+			fmt.Printf("Warning: failed to cache response %s: %v\n", key, err)
+		}
+		writeCachedResponse(c, &response)
+	}
+}
+
+// handlerHeaders returns the headers of after that are not in before or have changed
+func handlerHeaders(before, after http.Header) http.Header {
+	headers := make(http.Header)
+	for name, values := range after {
+		if !slices.Equal(before[name], values) {
+			headers[name] = slices.Clone(values)
+		}
+	}
+	return headers
+}
+
+// writeCachedResponse writes a response with its validators, or 304 if the client already has it
+func writeCachedResponse(c *gin.Context, response *CachedResponse) {
+	c.Header("ETag", response.ETag)
+	c.Header("Last-Modified", response.LastModified.Format(http.TimeFormat))
+	if notModified(c.Request, response) {
+		c.Writer.Header().Del("Content-Type")
+		c.Writer.Header().Del("Content-Length")
+		c.Writer.WriteHeader(http.StatusNotModified)
+		c.Writer.WriteHeaderNow()
+		return
+	}
+	c.Writer.WriteHeader(response.Status)
+	c.Writer.WriteHeaderNow()
+	if c.Request.Method != http.MethodHead {
+		c.Writer.Write(response.Body)
+	}
+}
+
+// notModified evaluates If-None-Match, or If-Modified-Since when If-None-Match is absent (RFC 9110 13.2.2)
+func notModified(r *http.Request, response *CachedResponse) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, tag := range strings.Split(inm, ",") {
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+			if tag == "*" || tag == response.ETag {
+				return true
+			}
+		}
+		return false
+	}
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" {
+		if t, err := http.ParseTime(ims); err == nil {
+			return !response.LastModified.After(t)
+		}
+	}
+	return false
+}
+
+// bodyETag returns a strong entity tag for a response body
+func bodyETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// capturingWriter holds the response back so that validators can be added and a 304 sent instead of the body
+type capturingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *capturingWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *capturingWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+// WriteHeaderNow is deferred to the middleware, which sends the headers once the handler has finished
+func (w *capturingWriter) WriteHeaderNow() {}
+
+func (w *capturingWriter) Written() bool {
+	return w.body.Len() > 0
+}
+
+// InvalidatesResponseCaches invalidates the named caches after a successful response of the route,
+// so that the instance serving a write never serves stale responses afterwards.
+// Other instances are invalidated through the events of the write (see WatchResponseCacheInvalidation)
+// or, with a shared store, by this invalidation directly.
+func InvalidatesResponseCaches(store ResponseCacheStore, names ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		if c.Writer.Status() < http.StatusBadRequest {
+			InvalidateResponseCaches(context.WithoutCancel(c.Request.Context()), store, names...)
+		}
+	}
+}
+
+// InvalidateResponseCaches starts a new generation of the named caches. Errors are logged.
+func InvalidateResponseCaches(ctx context.Context, store ResponseCacheStore, names ...string) {
+	for _, name := range names {
+		if err := store.Bump(ctx, name); err != nil {
+			fmt.Printf("Warning: failed to invalidate response cache %s: %v\n", name, err)
+		}
+	}
+}
+
+// WatchResponseCacheInvalidation invalidates caches when events are published on the bus, until ctx is done.
+// rules maps an event type to the caches it makes stale. With a broker, events published by other instances
+// invalidate the caches of this instance too. If the subscription is dropped, events may have been missed,
+// so every cache in rules is invalidated before subscribing again.
+func WatchResponseCacheInvalidation(ctx context.Context, bus *events.Bus, store ResponseCacheStore, rules map[string][]string) {
+	var all []string
+	for _, names := range rules {
+		all = append(all, names...)
+	}
+
+	go func() {
+		for ctx.Err() == nil {
+			sub, _ := bus.Subscribe("")
+			for open := true; open; {
+				select {
+				case <-ctx.Done():
+					bus.Unsubscribe(sub)
+					return
+				case event, ok := <-sub.C:
+					if !ok {
+						open = false
+						break
+					}
+					InvalidateResponseCaches(ctx, store, rules[event.Type]...)
+				}
+			}
+			InvalidateResponseCaches(ctx, store, all...)
+		}
+	}()
+}
+
+// memoryCacheEntry is an element of the LRU list of MemoryResponseCacheStore
+type memoryCacheEntry struct {
+	key       string
+	response  CachedResponse
+	expiresAt time.Time
+}
+
+// MemoryResponseCacheStore keeps responses in process memory, evicting the least recently used entry
+// beyond maxEntries. It is the default store; each instance caches and invalidates separately.
+type MemoryResponseCacheStore struct {
+	mu          sync.Mutex
+	maxEntries  int
+	lru         *list.List // most recently used first
+	entries     map[string]*list.Element
+	generations map[string]int64
+}
+
+func NewMemoryResponseCacheStore(maxEntries int) *MemoryResponseCacheStore {
+	return &MemoryResponseCacheStore{
+		maxEntries:  maxEntries,
+		lru:         list.New(),
+		entries:     make(map[string]*list.Element),
+		generations: make(map[string]int64),
+	}
+}
+
+func (s *MemoryResponseCacheStore) Get(ctx context.Context, key string) (*CachedResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	element, ok := s.entries[key]
+	if !ok {
+		return nil, nil
+	}
+	entry := element.Value.(*memoryCacheEntry)
+	if !time.Now().Before(entry.expiresAt) {
+		s.lru.Remove(element)
+		delete(s.entries, key)
+		return nil, nil
+	}
+	s.lru.MoveToFront(element)
+	response := entry.response
+	return &response, nil
+}
+
+func (s *MemoryResponseCacheStore) Set(ctx context.Context, key string, response CachedResponse, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry := &memoryCacheEntry{key: key, response: response, expiresAt: time.Now().Add(ttl)}
+	if element, ok := s.entries[key]; ok {
+		element.Value = entry
+		s.lru.MoveToFront(element)
+		return nil
+	}
+	s.entries[key] = s.lru.PushFront(entry)
+	for s.lru.Len() > s.maxEntries {
+		oldest := s.lru.Back()
+		s.lru.Remove(oldest)
+		delete(s.entries, oldest.Value.(*memoryCacheEntry).key)
+	}
+	return nil
+}
+
+func (s *MemoryResponseCacheStore) Generation(ctx context.Context, name string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.generations[name], nil
+}
+
+func (s *MemoryResponseCacheStore) Bump(ctx context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.generations[name]++
+	return nil
+}
+
+// Len returns the number of entries, including expired ones not evicted yet
+func (s *MemoryResponseCacheStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lru.Len()
+}
@@ -0,0 +1,201 @@
+package middleware
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// redisKeyPrefix keeps the cache keys apart from other data in a shared server
+	redisKeyPrefix = "kyouen:cache:"
+	// redisMaxIdleConns is the number of connections kept open between requests
+	redisMaxIdleConns = 8
+	// redisTimeout bounds a command so that a slow server only makes the cache miss
+	redisTimeout = 500 * time.Millisecond
+)
+
+// errRedisNil is the null bulk reply of a missing key
+var errRedisNil = errors.New("redis: nil")
+
+// RedisResponseCacheStore keeps responses in a server speaking the Redis protocol (Redis, Valkey, Memorystore),
+// shared by all instances. Generations are counters incremented with INCR, so an invalidation on any
+// instance is seen by the next request on every instance. Entries expire with PX.
+type RedisResponseCacheStore struct {
+	addr     string
+	password string
+	idle     chan net.Conn
+}
+
+// NewRedisResponseCacheStore connects lazily to the server at addr (host:port); password may be empty
+func NewRedisResponseCacheStore(addr, password string) *RedisResponseCacheStore {
+	return &RedisResponseCacheStore{addr: addr, password: password, idle: make(chan net.Conn, redisMaxIdleConns)}
+}
+
+func (s *RedisResponseCacheStore) Get(ctx context.Context, key string) (*CachedResponse, error) {
+	reply, err := s.do(ctx, "GET", redisKeyPrefix+"entry:"+key)
+	if err == errRedisNil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var response CachedResponse
+	if err := json.Unmarshal([]byte(reply), &response); err != nil {
+		return nil, fmt.Errorf("failed to decode cached response: %w", err)
+	}
+	return &response, nil
+}
+
+func (s *RedisResponseCacheStore) Set(ctx context.Context, key string, response CachedResponse, ttl time.Duration) error {
+	encoded, err := json.Marshal(response)
+	if err != nil {
+		return fmt.Errorf("failed to encode cached response: %w", err)
+	}
+	_, err = s.do(ctx, "SET", redisKeyPrefix+"entry:"+key, string(encoded), "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	return err
+}
+
+func (s *RedisResponseCacheStore) Generation(ctx context.Context, name string) (int64, error) {
+	reply, err := s.do(ctx, "GET", redisKeyPrefix+"generation:"+name)
+	if err == errRedisNil {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(reply, 10, 64)
+}
+
+func (s *RedisResponseCacheStore) Bump(ctx context.Context, name string) error {
+	_, err := s.do(ctx, "INCR", redisKeyPrefix+"generation:"+name)
+	return err
+}
+
+// do sends a command and returns its reply as a string. Connections are reused unless the command fails,
+// since a failed connection may be left in the middle of a reply.
+func (s *RedisResponseCacheStore) do(ctx context.Context, args ...string) (string, error) {
+	conn, err := s.conn(ctx)
+	if err != nil {
+		return "", err
+	}
+	deadline := time.Now().Add(redisTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+
+	reply, err := roundTrip(conn, args)
+	var replyErr redisError
+	if err != nil && err != errRedisNil && !errors.As(err, &replyErr) {
+		conn.Close()
+		return "", fmt.Errorf("redis %s failed: %w", args[0], err)
+	}
+	select {
+	case s.idle <- conn:
+	default:
+		conn.Close()
+	}
+	return reply, err
+}
+
+// conn returns an idle connection or opens a new one, authenticating if a password is set
+func (s *RedisResponseCacheStore) conn(ctx context.Context) (net.Conn, error) {
+	select {
+	case conn := <-s.idle:
+		return conn, nil
+	default:
+	}
+
+	dialer := net.Dialer{Timeout: redisTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to redis: %w", err)
+	}
+	if s.password != "" {
+		conn.SetDeadline(time.Now().Add(redisTimeout))
+		if _, err := roundTrip(conn, []string{"AUTH", s.password}); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to authenticate to redis: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+// Close closes the idle connections
+func (s *RedisResponseCacheStore) Close() error {
+	for {
+		select {
+		case conn := <-s.idle:
+			conn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// redisError is an error reply of the server
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// roundTrip writes a command as a RESP array of bulk strings and reads one reply
+func roundTrip(conn io.ReadWriter, args []string) (string, error) {
+	if _, err := conn.Write(encodeRESPCommand(args)); err != nil {
+		return "", err
+	}
+	return readRESPReply(bufio.NewReader(conn))
+}
+
+func encodeRESPCommand(args []string) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	return []byte(b.String())
+}
+
+// readRESPReply reads a simple string, error, integer or bulk string reply.
+// A null bulk string is returned as errRedisNil.
+func readRESPReply(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return "", fmt.Errorf("empty reply")
+	}
+
+	switch line[0] {
+	case '+', ':':
+		return line[1:], nil
+	case '-':
+		return "", redisError(line[1:])
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return "", fmt.Errorf("invalid bulk length: %q", line)
+		}
+		if n < 0 {
+			return "", errRedisNil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return "", err
+		}
+		return string(buf[:n]), nil
+	default:
+		return "", fmt.Errorf("unsupported reply: %q", line)
+	}
+}
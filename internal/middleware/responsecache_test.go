@@ -0,0 +1,145 @@
+package middleware
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestResponseCache(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	store := NewMemoryResponseCacheStore(100)
+	calls := 0
+	router := gin.New()
+	router.GET("/stages", ResponseCache("stages", time.Minute, store), func(c *gin.Context) {
+		calls++
+		if c.Query("fail") != "" {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "temporary failure"})
+			return
+		}
+		c.Header("X-Next-Cursor", "next")
+		c.JSON(http.StatusOK, gin.H{"calls": calls})
+	})
+
+	request := func(target string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	first := request("/stages?limit=10&start_stage_no=1", nil)
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" || first.Header().Get("Last-Modified") == "" {
+		t.Fatalf("first request must succeed with validators, got %d %v", first.Code, first.Header())
+	}
+	if first.Header().Get("Cache-Control") != "no-cache" {
+		t.Errorf("Expected Cache-Control: no-cache, got %q", first.Header().Get("Cache-Control"))
+	}
+
+	// The same query in another order is served from the cache with the handler's headers
+	hit := request("/stages?start_stage_no=1&limit=10", nil)
+	if hit.Code != http.StatusOK || hit.Body.String() != first.Body.String() || calls != 1 {
+		t.Errorf("Expected a cached response, got %d %s (calls = %d)", hit.Code, hit.Body.String(), calls)
+	}
+	if hit.Header().Get("ETag") != etag || hit.Header().Get("X-Next-Cursor") != "next" {
+		t.Errorf("Cached response must keep its headers, got %v", hit.Header())
+	}
+
+	notModified := request("/stages?limit=10&start_stage_no=1", http.Header{"If-None-Match": {`"other", ` + etag}})
+	if notModified.Code != http.StatusNotModified || notModified.Body.Len() != 0 {
+		t.Errorf("Expected 304 for a matching ETag, got %d %q", notModified.Code, notModified.Body.String())
+	}
+	if w := request("/stages?limit=10&start_stage_no=1", http.Header{"If-None-Match": {`"other"`}}); w.Code != http.StatusOK {
+		t.Errorf("Expected 200 for a different ETag, got %d", w.Code)
+	}
+	if w := request("/stages?limit=10&start_stage_no=1", http.Header{"If-Modified-Since": {first.Header().Get("Last-Modified")}}); w.Code != http.StatusNotModified {
+		t.Errorf("Expected 304 when not modified since Last-Modified, got %d", w.Code)
+	}
+
+	// Errors are passed through and not cached
+	for range 2 {
+		if w := request("/stages?fail=1", nil); w.Code != http.StatusInternalServerError {
+			t.Errorf("Expected the handler's 500, got %d", w.Code)
+		}
+	}
+	if calls != 3 {
+		t.Errorf("Errors must not be cached, calls = %d", calls)
+	}
+
+	InvalidateResponseCaches(context.Background(), store, "stages")
+	fresh := request("/stages?limit=10&start_stage_no=1", http.Header{"If-None-Match": {etag}})
+	if fresh.Code != http.StatusOK || fresh.Header().Get("ETag") == etag || calls != 4 {
+		t.Errorf("Expected a new response after invalidation, got %d %s (calls = %d)", fresh.Code, fresh.Body.String(), calls)
+	}
+}
+
+func TestMemoryResponseCacheStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryResponseCacheStore(2)
+
+	store.Set(ctx, "a", CachedResponse{Body: []byte("a")}, time.Minute)
+	store.Set(ctx, "b", CachedResponse{Body: []byte("b")}, time.Minute)
+	// Reading a makes b the least recently used entry
+	if r, _ := store.Get(ctx, "a"); r == nil || string(r.Body) != "a" {
+		t.Fatalf("Expected entry a, got %v", r)
+	}
+	store.Set(ctx, "c", CachedResponse{Body: []byte("c")}, time.Minute)
+	if r, _ := store.Get(ctx, "b"); r != nil {
+		t.Errorf("Expected b to be evicted, got %v", r)
+	}
+	if store.Len() != 2 {
+		t.Errorf("Expected 2 entries, got %d", store.Len())
+	}
+
+	store.Set(ctx, "expired", CachedResponse{}, -time.Second)
+	if r, _ := store.Get(ctx, "expired"); r != nil {
+		t.Errorf("Expected expired entry to be missing, got %v", r)
+	}
+
+	if g, _ := store.Generation(ctx, "stages"); g != 0 {
+		t.Errorf("Expected generation 0, got %d", g)
+	}
+	store.Bump(ctx, "stages")
+	if g, _ := store.Generation(ctx, "stages"); g != 1 {
+		t.Errorf("Expected generation 1 after bump, got %d", g)
+	}
+}
+
+func TestRESP(t *testing.T) {
+	if got := string(encodeRESPCommand([]string{"SET", "k", "v1", "PX", "60000"})); got != "*5\r\n$3\r\nSET\r\n$1\r\nk\r\n$2\r\nv1\r\n$2\r\nPX\r\n$5\r\n60000\r\n" {
+		t.Errorf("Unexpected command encoding: %q", got)
+	}
+
+	tests := []struct {
+		reply   string
+		want    string
+		wantErr bool
+	}{
+		{"+OK\r\n", "OK", false},
+		{":42\r\n", "42", false},
+		{"$5\r\nhe\r\nl\r\n", "he\r\nl", false},
+		{"$0\r\n\r\n", "", false},
+		{"-ERR wrong type\r\n", "", true},
+		{"$-1\r\n", "", true},
+	}
+	for _, tt := range tests {
+		got, err := readRESPReply(bufio.NewReader(strings.NewReader(tt.reply)))
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("readRESPReply(%q) = %q, %v", tt.reply, got, err)
+		}
+	}
+	if _, err := readRESPReply(bufio.NewReader(strings.NewReader("$-1\r\n"))); err != errRedisNil {
+		t.Errorf("Expected errRedisNil for a null bulk string, got %v", err)
+	}
+}
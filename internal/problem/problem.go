@@ -0,0 +1,65 @@
+// Package problem writes error responses as RFC 7807 problem details (application/problem+json).
+// Every problem has a stable machine-readable code; clients should branch on the code, not on the title or detail.
+package problem
+
+import (
+	"fmt"
+	"net/http"
+
+	"kyouen-server/internal/generated/openapi"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ContentType is the media type of problem details
+const ContentType = "application/problem+json"
+
+// typePrefix makes the problem type URI of a code
+const typePrefix = "urn:kyouen:problem:"
+
+// Codes shared by all handlers. Errors of a domain (e.g. STAGE_NOT_FOUND) are defined with it.
+const (
+	CodeInvalidRequest         = "INVALID_REQUEST"
+	CodeAuthenticationRequired = "AUTHENTICATION_REQUIRED"
+	CodeInternal               = "INTERNAL_ERROR"
+)
+
+// Type is a kind of problem: its HTTP status, stable code and fixed title
+type Type struct {
+	Status int
+	Code   string
+	Title  string
+}
+
+var (
+	InvalidRequest         = Type{http.StatusBadRequest, CodeInvalidRequest, "Invalid request"}
+	AuthenticationRequired = Type{http.StatusUnauthorized, CodeAuthenticationRequired, "Authentication required"}
+	Internal               = Type{http.StatusInternalServerError, CodeInternal, "Internal server error"}
+)
+
+// Write sends a problem of type t. detail explains this occurrence and is sent to the client as is,
+// so it must not contain internal errors; it may be empty.
+func Write(c *gin.Context, t Type, detail string) {
+	WriteReason(c, t, detail, "")
+}
+
+// WriteReason sends a problem of type t with the reason extension member, which refines the code
+// for clients that branch on it (e.g. the reason of an authentication failure). An empty reason is omitted.
+func WriteReason(c *gin.Context, t Type, detail, reason string) {
+	c.Header("Content-Type", ContentType)
+	c.JSON(t.Status, openapi.Problem{
+		Type:     typePrefix + t.Code,
+		Title:    t.Title,
+		Status:   int64(t.Status),
+		Detail:   detail,
+		Instance: c.Request.URL.Path,
+		Code:     t.Code,
+		Reason:   reason,
+	})
+}
+
+// WriteInternal logs err and sends an internal error without its details
+func WriteInternal(c *gin.Context, err error) {
+	fmt.Printf("Error: %s %s: %v\n", c.Request.Method, c.Request.URL.Path, err)
+	Write(c, Internal, "")
+}
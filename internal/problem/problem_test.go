@@ -0,0 +1,56 @@
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"kyouen-server/internal/generated/openapi"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestWrite(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.GET("/v2/stages/:stageNo/stats", func(c *gin.Context) {
+		Write(c, Type{http.StatusNotFound, "STAGE_NOT_FOUND", "Stage not found"}, "stage 9 not found")
+	})
+	router.GET("/v2/statics", func(c *gin.Context) {
+		WriteInternal(c, errors.New("rpc error: code = Unavailable desc = datastore.googleapis.com"))
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v2/stages/9/stats", nil))
+	if w.Code != http.StatusNotFound || w.Header().Get("Content-Type") != ContentType {
+		t.Fatalf("Expected 404 %s, got %d %s", ContentType, w.Code, w.Header().Get("Content-Type"))
+	}
+	var got openapi.Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := openapi.Problem{
+		Type:     "urn:kyouen:problem:STAGE_NOT_FOUND",
+		Title:    "Stage not found",
+		Status:   http.StatusNotFound,
+		Detail:   "stage 9 not found",
+		Instance: "/v2/stages/9/stats",
+		Code:     "STAGE_NOT_FOUND",
+	}
+	if got != want {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v2/statics", nil))
+	if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), `"code":"INTERNAL_ERROR"`) {
+		t.Errorf("Expected an internal error, got %d %s", w.Code, w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), "datastore") || strings.Contains(w.Body.String(), "detail") {
+		t.Errorf("Internal errors must not be sent to the client, got %s", w.Body.String())
+	}
+}
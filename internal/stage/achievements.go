@@ -0,0 +1,338 @@
+package stage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/datastore"
+	datastoreservice "kyouen-server/internal/datastore"
+)
+
+// Badge IDs. Badges for clearing every stage of a size are "size_<n>_complete" (see sizeCompleteBadge).
+const (
+	BadgeFirstClear = "first_clear"
+	BadgeClears10   = "clears_10"
+	BadgeClears100  = "clears_100"
+	BadgeClears1000 = "clears_1000"
+	BadgeStreak7    = "streak_7"
+	BadgeStreak30   = "streak_30"
+	// BadgeEarlyBird is unlocked by clearing someone else's stage within an hour of its creation
+	BadgeEarlyBird = "early_bird"
+)
+
+const (
+	earlyBirdWindow = time.Hour
+	// stageSizeCountsTTL is how long the number of stages per size is cached
+	stageSizeCountsTTL = time.Hour
+)
+
+// clearCountBadges maps clear count thresholds to their badges
+var clearCountBadges = []struct {
+	count int
+	badge string
+}{
+	{1, BadgeFirstClear},
+	{10, BadgeClears10},
+	{100, BadgeClears100},
+	{1000, BadgeClears1000},
+}
+
+// streakBadges maps daily streak lengths to their badges
+var streakBadges = []struct {
+	days  int64
+	badge string
+}{
+	{7, BadgeStreak7},
+	{30, BadgeStreak30},
+}
+
+func sizeCompleteBadge(size int64) string {
+	return fmt.Sprintf("size_%d_complete", size)
+}
+
+// achievementClear is a cleared stage as seen by the achievement rules
+type achievementClear struct {
+	StageSize       int64
+	StageCreator    string
+	StageRegistDate time.Time
+	FirstClear      time.Time
+	LastClear       time.Time
+}
+
+// unlockedBadge is a badge whose condition is met, with the time it was first met
+type unlockedBadge struct {
+	Badge      string
+	UnlockedAt time.Time
+}
+
+// Streak is a run of consecutive days (JST) with at least one clear
+type Streak struct {
+	Current int64 // run ending today or yesterday (0 if the user did not clear on either day)
+	Longest int64
+}
+
+// evaluateAchievements returns every badge the clear history qualifies for.
+// Unlock times are derived from the history, so re-evaluating gives the same result.
+// Days with clears are only known from each stage's first and last clear date,
+// so streaks built from repeated clears of the same stage may be missed.
+func evaluateAchievements(clears []achievementClear, stagesBySize map[int64]int64, screenName string) []unlockedBadge {
+	var badges []unlockedBadge
+
+	firstClears := make([]time.Time, len(clears))
+	for i, c := range clears {
+		firstClears[i] = c.FirstClear
+	}
+	sort.Slice(firstClears, func(i, j int) bool { return firstClears[i].Before(firstClears[j]) })
+	for _, b := range clearCountBadges {
+		if len(firstClears) >= b.count {
+			badges = append(badges, unlockedBadge{Badge: b.badge, UnlockedAt: firstClears[b.count-1]})
+		}
+	}
+
+	clearedBySize := make(map[int64]int64)
+	lastBySize := make(map[int64]time.Time)
+	for _, c := range clears {
+		clearedBySize[c.StageSize]++
+		if c.FirstClear.After(lastBySize[c.StageSize]) {
+			lastBySize[c.StageSize] = c.FirstClear
+		}
+	}
+	var sizes []int64
+	for size := range stagesBySize {
+		sizes = append(sizes, size)
+	}
+	sort.Slice(sizes, func(i, j int) bool { return sizes[i] < sizes[j] })
+	for _, size := range sizes {
+		if total := stagesBySize[size]; total > 0 && clearedBySize[size] >= total {
+			badges = append(badges, unlockedBadge{Badge: sizeCompleteBadge(size), UnlockedAt: lastBySize[size]})
+		}
+	}
+
+	days := clearDays(clears)
+	for _, b := range streakBadges {
+		if at, ok := streakReachedAt(days, b.days); ok {
+			badges = append(badges, unlockedBadge{Badge: b.badge, UnlockedAt: at})
+		}
+	}
+
+	var earlyBird time.Time
+	for _, c := range clears {
+		if c.StageCreator == screenName || c.StageRegistDate.IsZero() {
+			continue
+		}
+		if c.FirstClear.Sub(c.StageRegistDate) <= earlyBirdWindow && (earlyBird.IsZero() || c.FirstClear.Before(earlyBird)) {
+			earlyBird = c.FirstClear
+		}
+	}
+	if !earlyBird.IsZero() {
+		badges = append(badges, unlockedBadge{Badge: BadgeEarlyBird, UnlockedAt: earlyBird})
+	}
+
+	return badges
+}
+
+// clearDay is a day (JST) with clears and the earliest clear time of that day
+type clearDay struct {
+	Day   time.Time // midnight JST
+	First time.Time
+}
+
+// clearDays returns the days with at least one known clear, in order
+func clearDays(clears []achievementClear) []clearDay {
+	byDay := make(map[time.Time]time.Time)
+	add := func(t time.Time) {
+		if t.IsZero() {
+			return
+		}
+		local := t.In(dailyChallengeZone)
+		day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, dailyChallengeZone)
+		if first, ok := byDay[day]; !ok || t.Before(first) {
+			byDay[day] = t
+		}
+	}
+	for _, c := range clears {
+		add(c.FirstClear)
+		add(c.LastClear)
+	}
+
+	days := make([]clearDay, 0, len(byDay))
+	for day, first := range byDay {
+		days = append(days, clearDay{Day: day, First: first})
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Day.Before(days[j].Day) })
+	return days
+}
+
+// streakReachedAt returns when the user first cleared on n consecutive days
+func streakReachedAt(days []clearDay, n int64) (time.Time, bool) {
+	var run int64
+	for i, d := range days {
+		if i > 0 && d.Day.Equal(days[i-1].Day.AddDate(0, 0, 1)) {
+			run++
+		} else {
+			run = 1
+		}
+		if run == n {
+			return d.First, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// computeStreak returns the current and longest streaks as of now
+func computeStreak(days []clearDay, now time.Time) Streak {
+	var streak Streak
+	var run int64
+	for i, d := range days {
+		if i > 0 && d.Day.Equal(days[i-1].Day.AddDate(0, 0, 1)) {
+			run++
+		} else {
+			run = 1
+		}
+		streak.Longest = max(streak.Longest, run)
+	}
+
+	if len(days) > 0 {
+		local := now.In(dailyChallengeZone)
+		today := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, dailyChallengeZone)
+		last := days[len(days)-1].Day
+		if last.Equal(today) || last.Equal(today.AddDate(0, 0, -1)) {
+			streak.Current = run
+		}
+	}
+	return streak
+}
+
+// stageSizeCounts caches the number of stages of each size
+type stageSizeCounts struct {
+	mu        sync.Mutex
+	counts    map[int64]int64
+	expiresAt time.Time
+}
+
+func (s *Service) getStageSizeCounts(ctx context.Context) (map[int64]int64, error) {
+	s.stageSizes.mu.Lock()
+	defer s.stageSizes.mu.Unlock()
+
+	now := time.Now()
+	if s.stageSizes.counts != nil && now.Before(s.stageSizes.expiresAt) {
+		return s.stageSizes.counts, nil
+	}
+	counts, err := s.datastoreService.CountStagesBySize(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.stageSizes.counts = counts
+	s.stageSizes.expiresAt = now.Add(stageSizeCountsTTL)
+	return counts, nil
+}
+
+// AchievementResult is the outcome of evaluating a user's achievements
+type AchievementResult struct {
+	Achievements []datastoreservice.Achievement // all unlocked badges, oldest first
+	Unlocked     []datastoreservice.Achievement // badges unlocked by this evaluation
+	Streak       Streak
+}
+
+// RefreshAchievements evaluates the user's clear history and stores newly unlocked badges.
+// Badges are never revoked, e.g. when stages of a completed size are added later.
+// With dryRun the new badges are returned but not stored.
+func (s *Service) RefreshAchievements(ctx context.Context, user *datastoreservice.User, userKey *datastore.Key, dryRun bool) (*AchievementResult, error) {
+	stageUsers, err := s.datastoreService.GetClearedStagesByUser(ctx, userKey)
+	if err != nil {
+		return nil, err
+	}
+	stageKeys := make([]*datastore.Key, len(stageUsers))
+	for i, su := range stageUsers {
+		stageKeys[i] = su.StageKey
+	}
+	stages, err := s.datastoreService.GetStagesByKeys(ctx, stageKeys)
+	if err != nil {
+		return nil, err
+	}
+	stagesBySize, err := s.getStageSizeCounts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := s.datastoreService.GetAchievementsByUser(ctx, userKey)
+	if err != nil {
+		return nil, err
+	}
+
+	clears := make([]achievementClear, 0, len(stageUsers))
+	for i, su := range stageUsers {
+		// Skip clears of deleted stages
+		if stages[i].StageNo == 0 {
+			continue
+		}
+		clears = append(clears, achievementClear{
+			StageSize:       stages[i].Size,
+			StageCreator:    stages[i].Creator,
+			StageRegistDate: stages[i].RegistDate,
+			FirstClear:      su.FirstClearDate(),
+			LastClear:       su.LatestClearDate(),
+		})
+	}
+
+	result := &AchievementResult{
+		Achievements: existing,
+		Streak:       computeStreak(clearDays(clears), time.Now()),
+	}
+	unlocked := make(map[string]bool, len(existing))
+	for _, a := range existing {
+		unlocked[a.Badge] = true
+	}
+	for _, b := range evaluateAchievements(clears, stagesBySize, user.ScreenName) {
+		if unlocked[b.Badge] {
+			continue
+		}
+		result.Unlocked = append(result.Unlocked, datastoreservice.Achievement{
+			UserKey:    userKey,
+			Badge:      b.Badge,
+			UnlockedAt: b.UnlockedAt,
+		})
+	}
+	if len(result.Unlocked) == 0 {
+		return result, nil
+	}
+
+	if !dryRun {
+		if err := s.datastoreService.PutAchievements(ctx, result.Unlocked); err != nil {
+			return nil, err
+		}
+	}
+	result.Achievements = append(result.Achievements, result.Unlocked...)
+	sort.SliceStable(result.Achievements, func(i, j int) bool {
+		return result.Achievements[i].UnlockedAt.Before(result.Achievements[j].UnlockedAt)
+	})
+	return result, nil
+}
+
+// Profile is a user's public profile with progress and achievements
+type Profile struct {
+	User         datastoreservice.User
+	Achievements []datastoreservice.Achievement
+	Streak       Streak
+}
+
+// GetProfile returns the profile of a signed-in or anonymous user, unlocking badges earned since the last visit
+func (s *Service) GetProfile(ctx context.Context, userUID string) (*Profile, error) {
+	user, userKey, err := s.datastoreService.GetUserByID(ctx, userUID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	result, err := s.RefreshAchievements(ctx, user, userKey, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Profile{
+		User:         *user,
+		Achievements: result.Achievements,
+		Streak:       result.Streak,
+	}, nil
+}
@@ -0,0 +1,188 @@
+package stage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/datastore"
+	datastoreservice "kyouen-server/internal/datastore"
+)
+
+// ErrClearRateExceeded is returned (wrapped in a ClearRateError) when a user submits clears faster than allowed
+var ErrClearRateExceeded = errors.New("too many clears")
+
+// ClearRateError reports a clear rejected by the per-user rate limit
+type ClearRateError struct {
+	RetryAfter time.Duration
+}
+
+func (e *ClearRateError) Error() string {
+	return fmt.Sprintf("%v: retry after %v", ErrClearRateExceeded, e.RetryAfter)
+}
+
+func (e *ClearRateError) Unwrap() error {
+	return ErrClearRateExceeded
+}
+
+// AntiCheatPolicy configures the heuristics applied to clear submissions.
+// Clears faster than the plausible minimum or without a solve time are recorded but flag the user as suspicious;
+// clears beyond the rate limit are rejected and flag the user as well.
+// The shared guest account is exempt, since its clears come from many players.
+type AntiCheatPolicy struct {
+	// MinSolveTimeMs is the absolute floor of a plausible solve time (0 disables the solve time check)
+	MinSolveTimeMs int64
+	// SolveTimeSamples is the number of reported solve times a stage needs before its history raises the floor
+	SolveTimeSamples int64
+	// SolveTimeSampleLimit caps the clear records (latest first clears) read to compute the median of a stage
+	SolveTimeSampleLimit int
+	// MedianDivisor derives the floor of a stage from its median solve time (median / MedianDivisor)
+	MedianDivisor int64
+	// SolveTimeFloorTTL is how long the floor of a stage is cached
+	SolveTimeFloorTTL time.Duration
+	// ClearRateLimit is the maximum number of clears per ClearRateWindow (0 disables the rate limit)
+	ClearRateLimit  int64
+	ClearRateWindow time.Duration
+}
+
+// DefaultAntiCheatPolicy returns the policy used unless the server configures one
+func DefaultAntiCheatPolicy() AntiCheatPolicy {
+	return AntiCheatPolicy{
+		MinSolveTimeMs:       1000,
+		SolveTimeSamples:     20,
+		SolveTimeSampleLimit: 1000,
+		MedianDivisor:        10,
+		SolveTimeFloorTTL:    time.Hour,
+		ClearRateLimit:       60,
+		ClearRateWindow:      10 * time.Minute,
+	}
+}
+
+// minPlausibleSolveTimeMs returns the fastest solve time considered humanly possible for a stage.
+// Stages with enough history use a fraction of their median solve time, but never less than the absolute floor.
+func minPlausibleSolveTimeMs(stats *StageStats, policy AntiCheatPolicy) int64 {
+	floor := policy.MinSolveTimeMs
+	if stats.SolveTimeSamples < policy.SolveTimeSamples || policy.MedianDivisor <= 0 {
+		return floor
+	}
+	return max(floor, stats.MedianSolveTimeMs/policy.MedianDivisor)
+}
+
+type solveTimeFloor struct {
+	floorMs   int64
+	expiresAt time.Time
+}
+
+// solveTimeFloorCache caches the plausible minimum solve time of each stage
+type solveTimeFloorCache struct {
+	mu      sync.Mutex
+	entries map[int64]solveTimeFloor
+}
+
+func newSolveTimeFloorCache() *solveTimeFloorCache {
+	return &solveTimeFloorCache{entries: make(map[int64]solveTimeFloor)}
+}
+
+func (c *solveTimeFloorCache) get(stageNo int64, now time.Time) (int64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[stageNo]
+	if !ok || !now.Before(entry.expiresAt) {
+		return 0, false
+	}
+	return entry.floorMs, true
+}
+
+func (c *solveTimeFloorCache) set(stageNo int64, floorMs int64, expiresAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[stageNo] = solveTimeFloor{floorMs: floorMs, expiresAt: expiresAt}
+}
+
+// SetAntiCheatPolicy replaces the anti-cheat policy and drops cached solve time floors
+func (s *Service) SetAntiCheatPolicy(policy AntiCheatPolicy) {
+	s.antiCheat = policy
+	s.solveTimeFloors = newSolveTimeFloorCache()
+}
+
+// clearRateLimit returns the rate limit CreateStageUser applies to the clears of a user
+func (s *Service) clearRateLimit() datastoreservice.ClearRateLimit {
+	if s.antiCheat.ClearRateLimit <= 0 {
+		return datastoreservice.ClearRateLimit{}
+	}
+	return datastoreservice.ClearRateLimit{Limit: s.antiCheat.ClearRateLimit, Window: s.antiCheat.ClearRateWindow}
+}
+
+// clearRateError flags the user if err reports a clear beyond the rate limit and returns it as a ClearRateError;
+// other errors are returned as they are
+func (s *Service) clearRateError(ctx context.Context, user *datastoreservice.User, userKey *datastore.Key, err error) error {
+	var exceeded *datastoreservice.ClearRateExceededError
+	if !errors.As(err, &exceeded) {
+		return err
+	}
+
+	s.flagUser(ctx, user, userKey, datastoreservice.SuspicionClearRate)
+	return &ClearRateError{RetryAfter: time.Until(exceeded.WindowEnd)}
+}
+
+// checkSolveTime flags the user if the reported solve time is missing or faster than plausible for the stage
+func (s *Service) checkSolveTime(ctx context.Context, user *datastoreservice.User, userKey, stageKey *datastore.Key, stageNo int64, solveTimeMs int64) {
+	if s.antiCheat.MinSolveTimeMs <= 0 {
+		return
+	}
+	if solveTimeMs <= 0 {
+		fmt.Printf("Warning: user %s cleared stage %d without a solve time\n", user.UserID, stageNo)
+		s.flagUser(ctx, user, userKey, datastoreservice.SuspicionMissingSolveTime)
+		return
+	}
+
+	floorMs, err := s.solveTimeFloor(ctx, stageKey, stageNo)
+	if err != nil {
+		fmt.Printf("Warning: failed to get solve time floor of stage %d: %v\n", stageNo, err)
+		floorMs = s.antiCheat.MinSolveTimeMs
+	}
+	if solveTimeMs >= floorMs {
+		return
+	}
+
+	fmt.Printf("Warning: user %s cleared stage %d in %dms (plausible minimum %dms)\n", user.UserID, stageNo, solveTimeMs, floorMs)
+	s.flagUser(ctx, user, userKey, datastoreservice.SuspicionSolveTime)
+}
+
+// solveTimeFloor returns the cached plausible minimum solve time of a stage,
+// computing it from the latest SolveTimeSampleLimit first clears
+func (s *Service) solveTimeFloor(ctx context.Context, stageKey *datastore.Key, stageNo int64) (int64, error) {
+	now := time.Now()
+	if floorMs, ok := s.solveTimeFloors.get(stageNo, now); ok {
+		return floorMs, nil
+	}
+
+	stageUsers, err := s.datastoreService.GetRecentStageUsersByStage(ctx, stageKey, s.antiCheat.SolveTimeSampleLimit)
+	if err != nil {
+		return 0, err
+	}
+	stats, _ := computeStageStats(stageUsers, 0)
+	floorMs := minPlausibleSolveTimeMs(stats, s.antiCheat)
+
+	s.solveTimeFloors.set(stageNo, floorMs, now.Add(s.antiCheat.SolveTimeFloorTTL))
+	return floorMs, nil
+}
+
+// flagUser marks the user as suspicious unless already flagged
+func (s *Service) flagUser(ctx context.Context, user *datastoreservice.User, userKey *datastore.Key, reason string) {
+	if user.Suspicious {
+		return
+	}
+	flagged, err := s.datastoreService.FlagUser(ctx, userKey, reason)
+	if err != nil {
+		fmt.Printf("Warning: failed to flag user %s as suspicious (%s): %v\n", user.UserID, reason, err)
+		return
+	}
+	if flagged {
+		fmt.Printf("Warning: user %s flagged as suspicious (%s)\n", user.UserID, reason)
+	}
+	user.Suspicious = true
+}
@@ -0,0 +1,244 @@
+package stage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"kyouen-server/internal/auth"
+	datastoreservice "kyouen-server/internal/datastore"
+)
+
+var (
+	ErrCollectionNotFound = errors.New("collection not found")
+	ErrInvalidCollection  = errors.New("invalid collection")
+)
+
+const (
+	// maxCollectionStages bounds the number of stages in a collection (kept well below the entity size limit)
+	maxCollectionStages = 500
+	// maxCollectionTitleLength and maxCollectionDescriptionLength are in characters
+	maxCollectionTitleLength       = 100
+	maxCollectionDescriptionLength = 1000
+)
+
+// collectionIDPattern restricts collection IDs to URL-safe slugs such as "7x7-beginner"
+var collectionIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,63}$`)
+
+// CollectionParam is the content of a collection as edited by an administrator
+type CollectionParam struct {
+	Title       string
+	Description string
+	Author      string
+	StageNos    []int64 // in play order
+}
+
+// CollectionProgress is how many stages of a collection a user has cleared
+type CollectionProgress struct {
+	Cleared int64
+	Total   int64
+}
+
+// Completed reports whether every stage of the collection is cleared
+func (p CollectionProgress) Completed() bool {
+	return p.Total > 0 && p.Cleared == p.Total
+}
+
+// CollectionSummary is a collection with the requesting user's progress (nil for guests)
+type CollectionSummary struct {
+	Collection datastoreservice.Collection
+	Progress   *CollectionProgress
+}
+
+// CollectionStage is a stage of a collection with the requesting user's clear date (nil if not cleared)
+type CollectionStage struct {
+	Stage      datastoreservice.KyouenPuzzle
+	Popularity StagePopularity
+	ClearDate  *time.Time
+}
+
+// CollectionDetail is a collection with its stages and the requesting user's progress (nil for guests)
+type CollectionDetail struct {
+	Collection datastoreservice.Collection
+	Stages     []CollectionStage
+	Progress   *CollectionProgress
+}
+
+// validateCollection checks the ID and content of a collection before it is stored
+func validateCollection(id string, param CollectionParam) error {
+	if !collectionIDPattern.MatchString(id) {
+		return fmt.Errorf("%w: id must be 1-64 lowercase letters, digits or hyphens", ErrInvalidCollection)
+	}
+	if title := strings.TrimSpace(param.Title); title == "" || utf8.RuneCountInString(title) > maxCollectionTitleLength {
+		return fmt.Errorf("%w: title must be 1-%d characters", ErrInvalidCollection, maxCollectionTitleLength)
+	}
+	if utf8.RuneCountInString(param.Description) > maxCollectionDescriptionLength {
+		return fmt.Errorf("%w: description must be at most %d characters", ErrInvalidCollection, maxCollectionDescriptionLength)
+	}
+	if len(param.StageNos) == 0 || len(param.StageNos) > maxCollectionStages {
+		return fmt.Errorf("%w: stage_nos must have 1-%d stages", ErrInvalidCollection, maxCollectionStages)
+	}
+	seen := make(map[int64]bool, len(param.StageNos))
+	for _, no := range param.StageNos {
+		if no <= 0 {
+			return fmt.Errorf("%w: invalid stage number %d", ErrInvalidCollection, no)
+		}
+		if seen[no] {
+			return fmt.Errorf("%w: stage %d is listed more than once", ErrInvalidCollection, no)
+		}
+		seen[no] = true
+	}
+	return nil
+}
+
+// collectionProgress counts the stages of a collection found in the user's clears (keyed by StageKeyName)
+func collectionProgress(collection datastoreservice.Collection, clears map[string]time.Time) CollectionProgress {
+	progress := CollectionProgress{Total: int64(len(collection.StageKeys))}
+	for _, key := range collection.StageKeys {
+		if _, ok := clears[datastoreservice.StageKeyName(key)]; ok {
+			progress.Cleared++
+		}
+	}
+	return progress
+}
+
+// userClearDates returns the first clear date of every stage the user cleared, keyed by StageKeyName.
+// It returns nil for guests and users without a record, whose progress is not reported.
+func (s *Service) userClearDates(ctx context.Context, authUID string) (map[string]time.Time, error) {
+	if authUID == "" || auth.IsGuestUser(authUID) {
+		return nil, nil
+	}
+	_, userKey, err := s.datastoreService.GetUserByID(ctx, authUID)
+	if errors.Is(err, datastoreservice.ErrUserNotFound) {
+		// Anonymous users are created on their first clear
+		if auth.IsAnonymousUser(authUID) {
+			return map[string]time.Time{}, nil
+		}
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	stageUsers, err := s.datastoreService.GetClearedStagesByUser(ctx, userKey)
+	if err != nil {
+		return nil, err
+	}
+	clears := make(map[string]time.Time, len(stageUsers))
+	for _, su := range stageUsers {
+		clears[datastoreservice.StageKeyName(su.StageKey)] = su.FirstClearDate()
+	}
+	return clears, nil
+}
+
+// GetCollections returns all collections with the user's progress in each
+func (s *Service) GetCollections(ctx context.Context, authUID string) ([]CollectionSummary, error) {
+	collections, err := s.datastoreService.GetCollections(ctx)
+	if err != nil {
+		return nil, err
+	}
+	clears, err := s.userClearDates(ctx, authUID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]CollectionSummary, len(collections))
+	for i, c := range collections {
+		result[i] = CollectionSummary{Collection: c}
+		if clears != nil {
+			progress := collectionProgress(c, clears)
+			result[i].Progress = &progress
+		}
+	}
+	return result, nil
+}
+
+// GetCollection returns a collection with its stages in order and the user's progress.
+// Stages deleted since the collection was edited are left out.
+func (s *Service) GetCollection(ctx context.Context, id, authUID string) (*CollectionDetail, error) {
+	collection, err := s.datastoreService.GetCollection(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if collection == nil {
+		return nil, ErrCollectionNotFound
+	}
+
+	stages, err := s.datastoreService.GetStagesByKeys(ctx, collection.StageKeys)
+	if err != nil {
+		return nil, err
+	}
+	clears, err := s.userClearDates(ctx, authUID)
+	if err != nil {
+		return nil, err
+	}
+	popularity, err := s.GetStagePopularity(ctx, stages, collection.StageKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	detail := &CollectionDetail{Collection: *collection, Stages: []CollectionStage{}}
+	for i, stage := range stages {
+		if stage.StageNo == 0 {
+			continue
+		}
+		cs := CollectionStage{Stage: stage, Popularity: popularity[i]}
+		if clearDate, ok := clears[datastoreservice.StageKeyName(collection.StageKeys[i])]; ok {
+			cs.ClearDate = &clearDate
+		}
+		detail.Stages = append(detail.Stages, cs)
+	}
+	if clears != nil {
+		progress := collectionProgress(*collection, clears)
+		detail.Progress = &progress
+	}
+	return detail, nil
+}
+
+// PutCollection creates or replaces a collection. It returns the stored collection and whether it was created.
+func (s *Service) PutCollection(ctx context.Context, id string, param CollectionParam) (*datastoreservice.Collection, bool, error) {
+	if err := validateCollection(id, param); err != nil {
+		return nil, false, err
+	}
+
+	stageKeys, err := s.datastoreService.GetStageKeysByNos(ctx, param.StageNos, syncConcurrency)
+	if err != nil {
+		return nil, false, err
+	}
+	collection := datastoreservice.Collection{
+		ID:          id,
+		Title:       strings.TrimSpace(param.Title),
+		Description: param.Description,
+		Author:      param.Author,
+		StageNos:    param.StageNos,
+	}
+	var missing []int64
+	for _, no := range param.StageNos {
+		key, ok := stageKeys[no]
+		if !ok {
+			missing = append(missing, no)
+			continue
+		}
+		collection.StageKeys = append(collection.StageKeys, key)
+	}
+	if len(missing) > 0 {
+		return nil, false, fmt.Errorf("%w: stages not found: %v", ErrInvalidCollection, missing)
+	}
+
+	return s.datastoreService.PutCollection(ctx, collection)
+}
+
+// DeleteCollection deletes a collection. Stages and clear records are not affected.
+func (s *Service) DeleteCollection(ctx context.Context, id string) error {
+	deleted, err := s.datastoreService.DeleteCollection(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrCollectionNotFound
+	}
+	return nil
+}
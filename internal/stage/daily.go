@@ -0,0 +1,261 @@
+package stage
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"math/rand/v2"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/datastore"
+	datastoreservice "kyouen-server/internal/datastore"
+)
+
+var (
+	ErrInvalidDate            = errors.New("date must be YYYY-MM-DD and not in the future")
+	ErrDailyChallengeNotFound = errors.New("no daily challenge for the date")
+	ErrNoStages               = errors.New("no stages to choose from")
+)
+
+const (
+	// DailyChallengeDateLayout is the format of daily challenge dates
+	DailyChallengeDateLayout = "2006-01-02"
+	// dailyRepeatWindowDays is the number of past days whose stages are not picked again
+	dailyRepeatWindowDays = 30
+	// dailyLeaderboardLimit is the number of entries of the daily leaderboard
+	dailyLeaderboardLimit = 10
+	// dailySelectionMargin lets a selection job scheduled at midnight JST pick the new day even if it starts early
+	dailySelectionMargin = 15 * time.Minute
+)
+
+// dailyChallengeZone is the time zone in which a daily challenge day starts (JST; a fixed zone,
+// since the runtime image has no tzdata)
+var dailyChallengeZone = time.FixedZone("JST", 9*60*60)
+
+// DailyChallengeDate returns the daily challenge date of a point in time
+func DailyChallengeDate(t time.Time) string {
+	return t.In(dailyChallengeZone).Format(DailyChallengeDateLayout)
+}
+
+// DailySelectionDate returns the date whose stage a selection job running at a point in time picks:
+// the day starting at the next midnight JST if it is within dailySelectionMargin, otherwise the current day
+func DailySelectionDate(t time.Time) string {
+	return DailyChallengeDate(t.Add(dailySelectionMargin))
+}
+
+// DailyChallenge is the stage of the day with the players who first cleared it that day
+type DailyChallenge struct {
+	Date        string
+	Stage       datastoreservice.KyouenPuzzle
+	Popularity  StagePopularity
+	Leaderboard []DailyLeaderboardEntry
+}
+
+// DailyLeaderboardEntry is a player who first cleared the stage of the day on that day
+type DailyLeaderboardEntry struct {
+	Rank        int64
+	ScreenName  string
+	Image       string
+	SolveTimeMs int64 // best reported solve time (0 if not reported)
+	ClearDate   time.Time
+}
+
+// dailyCandidate is a stage that can be picked as the stage of the day
+type dailyCandidate struct {
+	key    string
+	clears int64
+}
+
+// selectDailyStage picks the stage of a date from the candidates, deterministically for the same inputs.
+// There are no stage ratings, so the weight favours stages few players have cleared (1 / (1 + clears)).
+// Stages picked recently are skipped unless no other stage is left.
+func selectDailyStage(date string, candidates []dailyCandidate, recent map[string]bool) (string, bool) {
+	var pool []dailyCandidate
+	for _, c := range candidates {
+		if !recent[c.key] {
+			pool = append(pool, c)
+		}
+	}
+	if len(pool) == 0 {
+		pool = candidates
+	}
+	if len(pool) == 0 {
+		return "", false
+	}
+	pool = append([]dailyCandidate(nil), pool...)
+	sort.Slice(pool, func(i, j int) bool { return pool[i].key < pool[j].key })
+
+	weights := make([]float64, len(pool))
+	var total float64
+	for i, c := range pool {
+		weights[i] = 1 / float64(1+c.clears)
+		total += weights[i]
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(date))
+	seed := h.Sum64()
+	r := rand.New(rand.NewPCG(seed, seed))
+
+	target := r.Float64() * total
+	for i, w := range weights {
+		target -= w
+		if target < 0 {
+			return pool[i].key, true
+		}
+	}
+	return pool[len(pool)-1].key, true
+}
+
+// SelectDailyChallenge picks and stores the stage of the day of a date, unless one was already selected.
+// It returns the stored challenge and whether this call selected it.
+// It reads every stage and StageUser key, so only the scheduled job (cmd/daily) calls it.
+func (s *Service) SelectDailyChallenge(ctx context.Context, date string) (*datastoreservice.DailyChallenge, bool, error) {
+	day, err := time.ParseInLocation(DailyChallengeDateLayout, date, dailyChallengeZone)
+	if err != nil {
+		return nil, false, ErrInvalidDate
+	}
+	if existing, err := s.datastoreService.GetDailyChallenge(ctx, date); err != nil || existing != nil {
+		return existing, false, err
+	}
+
+	stageKeys, err := s.datastoreService.GetAllStageKeys(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	clears, err := s.datastoreService.CountClearsByStage(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	byName := make(map[string]*datastore.Key, len(stageKeys))
+	candidates := make([]dailyCandidate, len(stageKeys))
+	for i, key := range stageKeys {
+		name := datastoreservice.StageKeyName(key)
+		byName[name] = key
+		candidates[i] = dailyCandidate{key: name, clears: clears[name]}
+	}
+
+	dates := make([]string, dailyRepeatWindowDays)
+	for i := range dates {
+		dates[i] = day.AddDate(0, 0, -(i + 1)).Format(DailyChallengeDateLayout)
+	}
+	previous, err := s.datastoreService.GetDailyChallenges(ctx, dates)
+	if err != nil {
+		return nil, false, err
+	}
+	recent := make(map[string]bool, len(previous))
+	for _, p := range previous {
+		recent[datastoreservice.StageKeyName(p.StageKey)] = true
+	}
+
+	selected, ok := selectDailyStage(date, candidates, recent)
+	if !ok {
+		return nil, false, ErrNoStages
+	}
+	stageKey := byName[selected]
+	stage, err := s.datastoreService.GetStageByKey(ctx, stageKey)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return s.datastoreService.CreateDailyChallenge(ctx, datastoreservice.DailyChallenge{
+		Date:       date,
+		StageKey:   stageKey,
+		StageNo:    stage.StageNo,
+		SelectedAt: time.Now(),
+	})
+}
+
+// GetDailyChallenge returns the stage of the day of a date with that day's leaderboard.
+// It only reads the stage selected by the scheduled job (ErrDailyChallengeNotFound before the job has run),
+// and future dates are rejected so that upcoming stages are not revealed.
+func (s *Service) GetDailyChallenge(ctx context.Context, date string) (*DailyChallenge, error) {
+	today := DailyChallengeDate(time.Now())
+	day, err := time.ParseInLocation(DailyChallengeDateLayout, date, dailyChallengeZone)
+	if err != nil || date > today {
+		return nil, ErrInvalidDate
+	}
+
+	challenge, err := s.datastoreService.GetDailyChallenge(ctx, date)
+	if err != nil {
+		return nil, err
+	}
+	if challenge == nil {
+		return nil, ErrDailyChallengeNotFound
+	}
+
+	stage, err := s.datastoreService.GetStageByKey(ctx, challenge.StageKey)
+	if err != nil {
+		return nil, err
+	}
+
+	start, end := day, day.AddDate(0, 0, 1)
+	stageUsers, err := s.datastoreService.GetStageUsersFirstClearedBetween(ctx, challenge.StageKey, start, end)
+	if err != nil {
+		return nil, err
+	}
+	ranked := rankDailyClears(stageUsers, start, end)
+	// Look up a few more users than needed to fill the leaderboard after skipping deleted and suspicious users
+	if len(ranked) > dailyLeaderboardLimit*4 {
+		ranked = ranked[:dailyLeaderboardLimit*4]
+	}
+
+	userKeys := make([]*datastore.Key, len(ranked))
+	for i, su := range ranked {
+		userKeys[i] = su.UserKey
+	}
+	users, err := s.datastoreService.GetUsersByKeys(ctx, userKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	popularity, err := s.GetStagePopularity(ctx, []datastoreservice.KyouenPuzzle{*stage}, []*datastore.Key{challenge.StageKey})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &DailyChallenge{Date: challenge.Date, Stage: *stage, Popularity: popularity[0], Leaderboard: []DailyLeaderboardEntry{}}
+	for i, u := range users {
+		if len(result.Leaderboard) == dailyLeaderboardLimit {
+			break
+		}
+		// Skip users deleted after clearing and users flagged by anti-cheat
+		if u.UserID == "" || u.Suspicious {
+			continue
+		}
+		result.Leaderboard = append(result.Leaderboard, DailyLeaderboardEntry{
+			Rank:        int64(len(result.Leaderboard) + 1),
+			ScreenName:  u.ScreenName,
+			Image:       u.Image,
+			SolveTimeMs: ranked[i].BestSolveTimeMs,
+			ClearDate:   ranked[i].FirstClearDate(),
+		})
+	}
+
+	return result, nil
+}
+
+// rankDailyClears returns the records of users who first cleared the stage within [start, end),
+// fastest reported solve time first, then earliest clear; clears without a solve time come last.
+func rankDailyClears(stageUsers []datastoreservice.StageUser, start, end time.Time) []datastoreservice.StageUser {
+	var ranked []datastoreservice.StageUser
+	for _, su := range stageUsers {
+		clearDate := su.FirstClearDate()
+		if !clearDate.Before(start) && clearDate.Before(end) {
+			ranked = append(ranked, su)
+		}
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		a, b := ranked[i], ranked[j]
+		if (a.BestSolveTimeMs > 0) != (b.BestSolveTimeMs > 0) {
+			return a.BestSolveTimeMs > 0
+		}
+		if a.BestSolveTimeMs != b.BestSolveTimeMs {
+			return a.BestSolveTimeMs < b.BestSolveTimeMs
+		}
+		return a.FirstClearDate().Before(b.FirstClearDate())
+	})
+	return ranked
+}
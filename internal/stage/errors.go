@@ -0,0 +1,112 @@
+package stage
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"kyouen-server/internal/problem"
+	"kyouen-server/pkg/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Problem types of the stage API. The codes are part of the API and must not change.
+var (
+	problemStageNotFound             = problem.Type{Status: http.StatusNotFound, Code: "STAGE_NOT_FOUND", Title: "Stage not found"}
+	problemStageExists               = problem.Type{Status: http.StatusConflict, Code: "STAGE_EXISTS", Title: "Stage already exists"}
+	problemInsufficientStones        = problem.Type{Status: http.StatusBadRequest, Code: "INSUFFICIENT_STONES", Title: "Stage must have 5 stones"}
+	problemNoKyouen                  = problem.Type{Status: http.StatusBadRequest, Code: "NO_KYOUEN", Title: "Stage has no kyouen"}
+	problemInvalidKyouen             = problem.Type{Status: http.StatusBadRequest, Code: "INVALID_KYOUEN", Title: "Answer is not a kyouen"}
+	problemStageMismatch             = problem.Type{Status: http.StatusBadRequest, Code: "STAGE_MISMATCH", Title: "Answer does not match the stage"}
+	problemInvalidStageLength        = problem.Type{Status: http.StatusBadRequest, Code: "INVALID_STAGE_LENGTH", Title: "Stage length must be size * size"}
+	problemInvalidStageSize          = problem.Type{Status: http.StatusBadRequest, Code: "INVALID_STAGE_SIZE", Title: "Stage size is out of range"}
+	problemInvalidStageCharacter     = problem.Type{Status: http.StatusBadRequest, Code: "INVALID_STAGE_CHARACTER", Title: "Stage has an invalid character"}
+	problemTooManyStones             = problem.Type{Status: http.StatusBadRequest, Code: "TOO_MANY_STONES", Title: "Stage has too many stones"}
+	problemInvalidCompactStage       = problem.Type{Status: http.StatusBadRequest, Code: "INVALID_COMPACT_STAGE", Title: "Invalid stage_compact"}
+	problemClearRateExceeded         = problem.Type{Status: http.StatusTooManyRequests, Code: "CLEAR_RATE_EXCEEDED", Title: "Too many clears"}
+	problemUserNotFound              = problem.Type{Status: http.StatusNotFound, Code: "USER_NOT_FOUND", Title: "User not found"}
+	problemInvalidLinkToken          = problem.Type{Status: http.StatusUnauthorized, Code: "INVALID_LINK_TOKEN", Title: "Invalid ID token of the account to link"}
+	problemSameAccount               = problem.Type{Status: http.StatusBadRequest, Code: "SAME_ACCOUNT", Title: "Cannot link an account to itself"}
+	problemInvalidDeviceToken        = problem.Type{Status: http.StatusBadRequest, Code: "INVALID_DEVICE_TOKEN", Title: "Device token does not match the device ID"}
+	problemInvalidCursor             = problem.Type{Status: http.StatusBadRequest, Code: "INVALID_CURSOR", Title: "Invalid cursor"}
+	problemInvalidExportFormat       = problem.Type{Status: http.StatusBadRequest, Code: "INVALID_EXPORT_FORMAT", Title: "Format must be ndjson or binary"}
+	problemInvalidDate               = problem.Type{Status: http.StatusBadRequest, Code: "INVALID_DATE", Title: "Date must be YYYY-MM-DD and not in the future"}
+	problemDailyChallengeNotFound    = problem.Type{Status: http.StatusNotFound, Code: "DAILY_CHALLENGE_NOT_FOUND", Title: "No daily challenge for the date"}
+	problemCollectionNotFound        = problem.Type{Status: http.StatusNotFound, Code: "COLLECTION_NOT_FOUND", Title: "Collection not found"}
+	problemInvalidCollection         = problem.Type{Status: http.StatusBadRequest, Code: "INVALID_COLLECTION", Title: "Invalid collection"}
+	problemActivityStreamUnavailable = problem.Type{Status: http.StatusServiceUnavailable, Code: "ACTIVITY_STREAM_UNAVAILABLE", Title: "Activity stream is not available"}
+)
+
+// problemOf returns the problem type of an error returned by the service.
+// Errors are matched with errors.Is and errors.As, so wrapped errors keep their type.
+// It returns false for internal errors, whose details must not be sent to clients.
+func problemOf(err error) (problem.Type, bool) {
+	var (
+		lengthErr    *models.StageLengthError
+		sizeErr      *models.StageSizeError
+		characterErr *models.StageCharacterError
+		stonesErr    *models.StageStonesError
+	)
+	switch {
+	case errors.Is(err, ErrStageNotFound):
+		return problemStageNotFound, true
+	case errors.Is(err, ErrStageExists):
+		return problemStageExists, true
+	case errors.Is(err, ErrInsufficientStones):
+		return problemInsufficientStones, true
+	case errors.Is(err, ErrNoKyouen):
+		return problemNoKyouen, true
+	case errors.Is(err, ErrInvalidKyouen):
+		return problemInvalidKyouen, true
+	case errors.Is(err, ErrStageMismatch):
+		return problemStageMismatch, true
+	case errors.Is(err, ErrInvalidStageLength), errors.As(err, &lengthErr):
+		return problemInvalidStageLength, true
+	case errors.As(err, &sizeErr):
+		return problemInvalidStageSize, true
+	case errors.As(err, &characterErr):
+		return problemInvalidStageCharacter, true
+	case errors.As(err, &stonesErr):
+		return problemTooManyStones, true
+	case errors.Is(err, ErrInvalidCompactStage):
+		return problemInvalidCompactStage, true
+	case errors.Is(err, ErrClearRateExceeded):
+		return problemClearRateExceeded, true
+	case errors.Is(err, ErrUserNotFound):
+		return problemUserNotFound, true
+	case errors.Is(err, ErrInvalidLinkToken):
+		return problemInvalidLinkToken, true
+	case errors.Is(err, ErrSameAccount):
+		return problemSameAccount, true
+	case errors.Is(err, ErrInvalidCursor):
+		return problemInvalidCursor, true
+	case errors.Is(err, ErrInvalidExportFormat):
+		return problemInvalidExportFormat, true
+	case errors.Is(err, ErrInvalidDate):
+		return problemInvalidDate, true
+	case errors.Is(err, ErrDailyChallengeNotFound):
+		return problemDailyChallengeNotFound, true
+	case errors.Is(err, ErrCollectionNotFound):
+		return problemCollectionNotFound, true
+	case errors.Is(err, ErrInvalidCollection):
+		return problemInvalidCollection, true
+	}
+	return problem.Internal, false
+}
+
+// writeError sends the problem of an error returned by the service. The message of a known error
+// is sent as the detail; other errors are logged and sent as an internal error without details.
+func writeError(c *gin.Context, err error) {
+	t, ok := problemOf(err)
+	if !ok {
+		problem.WriteInternal(c, err)
+		return
+	}
+	var rateErr *ClearRateError
+	if errors.As(err, &rateErr) {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(rateErr.RetryAfter.Seconds()))))
+	}
+	problem.Write(c, t, err.Error())
+}
@@ -0,0 +1,200 @@
+package stage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+
+	datastoreservice "kyouen-server/internal/datastore"
+	"kyouen-server/internal/generated/openapi"
+)
+
+// Stage export formats
+const (
+	ExportFormatNDJSON = "ndjson"
+	ExportFormatBinary = "binary"
+)
+
+const (
+	// exportBatchSize is the number of stages read from Datastore per query while exporting
+	exportBatchSize = 1000
+
+	// binaryExportMagic starts a binary export, followed by binaryExportVersion
+	binaryExportMagic   = "KYST"
+	binaryExportVersion = 1
+	// Record tags of the binary export
+	binaryExportTagStage = 1
+	binaryExportTagEnd   = 0
+)
+
+// ExportStages writes every stage with a stage number greater than sinceStageNo to w, in stage number order,
+// reading them in batches so that the whole catalog is never held in memory.
+// The export ends with a trailer holding the number of stages, the last stage number and the SHA-256
+// of everything written before it, so that clients can detect a truncated or corrupted download.
+// It returns the hex SHA-256. If it fails midway, the trailer is not written.
+func (s *Service) ExportStages(ctx context.Context, sinceStageNo int64, format string, w io.Writer) (string, error) {
+	var exporter stageExporter
+	switch format {
+	case ExportFormatNDJSON:
+		exporter = newNDJSONExporter(w)
+	case ExportFormatBinary:
+		exporter = newBinaryExporter(w)
+	default:
+		return "", ErrInvalidExportFormat
+	}
+
+	if err := exporter.begin(); err != nil {
+		return "", err
+	}
+	count := int64(0)
+	lastStageNo := sinceStageNo
+	for {
+		stages, _, err := s.datastoreService.GetStages(ctx, int(lastStageNo+1), exportBatchSize)
+		if err != nil {
+			return "", err
+		}
+		for _, stage := range stages {
+			lastStageNo = stage.StageNo
+			// Leave out malformed stages (see ADR 004) so that both formats export the same stages
+			if _, err := packStageCells(stage.Stage, stage.Size); err != nil {
+				fmt.Printf("Warning: stage %d is not exported: %v\n", stage.StageNo, err)
+				continue
+			}
+			if err := exporter.write(stage); err != nil {
+				return "", err
+			}
+			count++
+		}
+		if len(stages) < exportBatchSize {
+			break
+		}
+	}
+	return exporter.end(count, lastStageNo)
+}
+
+// stageExporter encodes the stages of an export. Implementations hash everything they write before the trailer.
+type stageExporter interface {
+	begin() error
+	write(stage datastoreservice.KyouenPuzzle) error
+	end(count, lastStageNo int64) (string, error)
+}
+
+// hashingWriter writes to w and adds the written bytes to a SHA-256
+type hashingWriter struct {
+	w    io.Writer
+	hash hash.Hash
+}
+
+func newHashingWriter(w io.Writer) *hashingWriter {
+	return &hashingWriter{w: w, hash: sha256.New()}
+}
+
+func (h *hashingWriter) Write(p []byte) (int, error) {
+	h.hash.Write(p)
+	return h.w.Write(p)
+}
+
+func (h *hashingWriter) sum() string {
+	return hex.EncodeToString(h.hash.Sum(nil))
+}
+
+// ndjsonExporter writes one openapi.StageExportRecord per line and an openapi.StageExportTrailer as the last line
+type ndjsonExporter struct {
+	out     io.Writer
+	hashed  *hashingWriter
+	encoder *json.Encoder
+}
+
+func newNDJSONExporter(w io.Writer) *ndjsonExporter {
+	hashed := newHashingWriter(w)
+	return &ndjsonExporter{out: w, hashed: hashed, encoder: json.NewEncoder(hashed)}
+}
+
+func (e *ndjsonExporter) begin() error {
+	return nil
+}
+
+func (e *ndjsonExporter) write(stage datastoreservice.KyouenPuzzle) error {
+	return e.encoder.Encode(openapi.StageExportRecord{
+		StageNo:    stage.StageNo,
+		Size:       stage.Size,
+		Stage:      stage.Stage,
+		Creator:    stage.Creator,
+		RegistDate: stage.RegistDate.UTC(),
+	})
+}
+
+func (e *ndjsonExporter) end(count, lastStageNo int64) (string, error) {
+	sum := e.hashed.sum()
+	err := json.NewEncoder(e.out).Encode(openapi.StageExportTrailer{Count: count, LastStageNo: lastStageNo, Sha256: sum})
+	return sum, err
+}
+
+// binaryExporter writes the packed binary format:
+//
+//	header:  "KYST" version(1 byte)
+//	stage:   tag=1, stageNo(uvarint), size(1 byte), cells(2 bits per cell, row-major, first cell in the high bits,
+//	         ceil(size²/4) bytes), creator length(uvarint) and UTF-8 bytes, registDate(varint, Unix seconds)
+//	trailer: tag=0, count(uvarint), lastStageNo(uvarint), SHA-256 of everything before the trailer (32 bytes)
+type binaryExporter struct {
+	out    io.Writer
+	hashed *hashingWriter
+	buf    []byte
+}
+
+func newBinaryExporter(w io.Writer) *binaryExporter {
+	return &binaryExporter{out: w, hashed: newHashingWriter(w)}
+}
+
+func (e *binaryExporter) begin() error {
+	_, err := e.hashed.Write(append([]byte(binaryExportMagic), binaryExportVersion))
+	return err
+}
+
+func (e *binaryExporter) write(stage datastoreservice.KyouenPuzzle) error {
+	cells, err := packStageCells(stage.Stage, stage.Size)
+	if err != nil {
+		return fmt.Errorf("failed to export stage %d: %w", stage.StageNo, err)
+	}
+	b := append(e.buf[:0], binaryExportTagStage)
+	b = binary.AppendUvarint(b, uint64(stage.StageNo))
+	b = append(b, byte(stage.Size))
+	b = append(b, cells...)
+	b = binary.AppendUvarint(b, uint64(len(stage.Creator)))
+	b = append(b, stage.Creator...)
+	b = binary.AppendVarint(b, stage.RegistDate.Unix())
+	e.buf = b
+	_, err = e.hashed.Write(b)
+	return err
+}
+
+func (e *binaryExporter) end(count, lastStageNo int64) (string, error) {
+	sum := e.hashed.hash.Sum(nil)
+	b := []byte{binaryExportTagEnd}
+	b = binary.AppendUvarint(b, uint64(count))
+	b = binary.AppendUvarint(b, uint64(lastStageNo))
+	b = append(b, sum...)
+	_, err := e.out.Write(b)
+	return hex.EncodeToString(sum), err
+}
+
+// packStageCells packs a stage string into 2 bits per cell ('0' = 0, '1' = 1, '2' = 2)
+func packStageCells(stage string, size int64) ([]byte, error) {
+	if size <= 0 || size > 255 || int64(len(stage)) != size*size {
+		return nil, fmt.Errorf("stage length %d does not match size %d", len(stage), size)
+	}
+	packed := make([]byte, (len(stage)+3)/4)
+	for i := 0; i < len(stage); i++ {
+		c := stage[i]
+		if c < '0' || c > '2' {
+			return nil, fmt.Errorf("invalid cell %q at %d", c, i)
+		}
+		packed[i/4] |= (c - '0') << (6 - 2*(i%4))
+	}
+	return packed, nil
+}
@@ -1,14 +1,19 @@
 package stage
 
 import (
+	"compress/gzip"
+	"fmt"
+	"io"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"kyouen-server/internal/auth"
 	"kyouen-server/internal/datastore"
+	"kyouen-server/internal/events"
 	"kyouen-server/internal/generated/openapi"
-	"kyouen-server/pkg/models"
+	"kyouen-server/internal/problem"
 
 	"github.com/gin-gonic/gin"
 )
@@ -16,17 +21,44 @@ import (
 type Handler struct {
 	stageService     *Service
 	datastoreService *datastore.DatastoreService
-	firebaseService  *datastore.FirebaseService
+	tokenVerifier    auth.TokenVerifier
+	deviceTokens     *auth.DeviceTokens
+	events           *events.Bus
+	streamHeartbeat  time.Duration
 }
 
-func NewHandler(datastoreService *datastore.DatastoreService, firebaseService *datastore.FirebaseService) *Handler {
+func NewHandler(datastoreService *datastore.DatastoreService, tokenVerifier auth.TokenVerifier) *Handler {
+	// Device tokens are only valid in this process until SetDeviceTokenSecret is called
+	deviceTokens, err := auth.NewRandomDeviceTokens()
+	if err != nil {
+		panic(fmt.Sprintf("failed to generate device token secret: %v", err))
+	}
 	return &Handler{
-		stageService:     NewService(datastoreService, firebaseService),
+		stageService:     NewService(datastoreService, tokenVerifier),
 		datastoreService: datastoreService,
-		firebaseService:  firebaseService,
+		tokenVerifier:    tokenVerifier,
+		deviceTokens:     deviceTokens,
 	}
 }
 
+// SetDeviceTokenSecret sets the secret of device tokens, which must be shared by all instances
+func (h *Handler) SetDeviceTokenSecret(secret string) {
+	h.deviceTokens = auth.NewDeviceTokens([]byte(secret))
+}
+
+// SetActivityStream sets the bus that feeds the activity stream, which new clears and stages are published to,
+// and the interval of heartbeats sent on idle streams
+func (h *Handler) SetActivityStream(bus *events.Bus, heartbeat time.Duration) {
+	h.events = bus
+	h.streamHeartbeat = heartbeat
+	h.stageService.SetEventBus(bus)
+}
+
+// SetAntiCheatPolicy configures the heuristics applied to clear submissions
+func (h *Handler) SetAntiCheatPolicy(policy AntiCheatPolicy) {
+	h.stageService.SetAntiCheatPolicy(policy)
+}
+
 func (h *Handler) GetStages(c *gin.Context) {
 	startStageNo, err := strconv.Atoi(c.DefaultQuery("start_stage_no", "0"))
 	if err != nil {
@@ -44,19 +76,19 @@ func (h *Handler) GetStages(c *gin.Context) {
 	authUID, _ := auth.GetAuthenticatedUID(c)
 	stages, stageKeys, clearedKeyIDs, err := h.stageService.GetStages(ctx, startStageNo, limit, authUID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(c, err)
+		return
+	}
+
+	popularity, err := h.stageService.GetStagePopularity(ctx, stages, stageKeys)
+	if err != nil {
+		writeError(c, err)
 		return
 	}
 
 	stageList := []openapi.Stage{}
 	for i, stage := range stages {
-		s := openapi.Stage{
-			StageNo:    stage.StageNo,
-			Size:       stage.Size,
-			Stage:      stage.Stage,
-			Creator:    stage.Creator,
-			RegistDate: stage.RegistDate,
-		}
+		s := stageResponse(stage, popularity[i])
 		if clearedKeyIDs != nil {
 			if clearDate, ok := clearedKeyIDs[stageKeys[i].ID]; ok {
 				s.ClearDate = &clearDate
@@ -71,33 +103,23 @@ func (h *Handler) GetStages(c *gin.Context) {
 func (h *Handler) CreateStage(c *gin.Context) {
 	var param openapi.NewStage
 	if err := c.ShouldBindJSON(&param); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		problem.Write(c, problem.InvalidRequest, err.Error())
 		return
 	}
 
 	savedStage, err := h.stageService.CreateStage(c.Request.Context(), param, param.Creator)
 	if err != nil {
-		switch err {
-		case ErrInvalidStageLength:
-			c.JSON(http.StatusBadRequest, gin.H{"error": "stage length must be size * size."})
-		case ErrInsufficientStones:
-			c.JSON(http.StatusBadRequest, gin.H{"error": "stage must have 5 stones."})
-		case ErrNoKyouen:
-			c.JSON(http.StatusBadRequest, gin.H{"error": "sent stage don't have kyouen."})
-		case ErrStageExists:
-			c.JSON(http.StatusConflict, gin.H{"error": "sent stage is already exists."})
-		default:
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		}
+		writeError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusCreated, openapi.Stage{
-		StageNo:    savedStage.StageNo,
-		Size:       savedStage.Size,
-		Stage:      savedStage.Stage,
-		Creator:    savedStage.Creator,
-		RegistDate: savedStage.RegistDate,
+		StageNo:      savedStage.StageNo,
+		Size:         savedStage.Size,
+		Stage:        savedStage.Stage,
+		StageCompact: compactStage(savedStage.Size, savedStage.Stage),
+		Creator:      savedStage.Creator,
+		RegistDate:   savedStage.RegistDate,
 	})
 }
 
@@ -110,28 +132,24 @@ func (h *Handler) ClearStage(c *gin.Context) {
 
 	stageNo, err := strconv.Atoi(c.Param("stageNo"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid stage number"})
+		problem.Write(c, problem.InvalidRequest, "invalid stage number")
 		return
 	}
 
 	var param openapi.ClearStage
 	if err := c.ShouldBindJSON(&param); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		problem.Write(c, problem.InvalidRequest, err.Error())
+		return
+	}
+
+	if param.SolveTimeMs < 0 || param.Attempts < 0 || param.HintsUsed < 0 {
+		problem.Write(c, problem.InvalidRequest, "solve_time_ms, attempts and hints_used must not be negative")
 		return
 	}
 
-	user, err := h.stageService.ClearStage(c.Request.Context(), stageNo, param.Stage, authUID)
+	user, err := h.stageService.ClearStage(c.Request.Context(), stageNo, param, authUID)
 	if err != nil {
-		switch err {
-		case ErrInvalidKyouen:
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid kyouen"})
-		case ErrStageNotFound:
-			c.JSON(http.StatusBadRequest, gin.H{"error": "stage not found"})
-		case ErrStageMismatch:
-			c.JSON(http.StatusBadRequest, gin.H{"error": "stage mismatch"})
-		default:
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		}
+		writeError(c, err)
 		return
 	}
 
@@ -143,105 +161,359 @@ func (h *Handler) ClearStage(c *gin.Context) {
 	})
 }
 
-func (h *Handler) Login(c *gin.Context) {
-	var param openapi.LoginParam
-	if err := c.ShouldBindJSON(&param); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+// GetStageStats returns the clear statistics of a stage
+func (h *Handler) GetStageStats(c *gin.Context) {
+	stageNo, err := strconv.Atoi(c.Param("stageNo"))
+	if err != nil {
+		problem.Write(c, problem.InvalidRequest, "invalid stage number")
 		return
 	}
 
-	ctx := c.Request.Context()
-	token, err := h.firebaseService.VerifyIDToken(ctx, param.Token)
+	stats, err := h.stageService.GetStageStats(c.Request.Context(), stageNo)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"error": "Invalid Firebase ID token",
+		writeError(c, err)
+		return
+	}
+
+	resp := openapi.StageStats{
+		StageNo:           stats.StageNo,
+		ClearCount:        stats.ClearCount,
+		SolveTimeSamples:  stats.SolveTimeSamples,
+		MedianSolveTimeMs: stats.MedianSolveTimeMs,
+		AverageAttempts:   stats.AverageAttempts,
+		HintUsageRate:     stats.HintUsageRate,
+		LineClears:        stats.LineClears,
+		CircleClears:      stats.CircleClears,
+		FastestSolvers:    []openapi.FastestSolver{},
+		FirstClearedBy:    stats.FirstClearedBy,
+		FirstClearedAt:    stats.FirstClearedAt,
+	}
+	for _, solver := range stats.FastestSolvers {
+		resp.FastestSolvers = append(resp.FastestSolvers, openapi.FastestSolver{
+			ScreenName:  solver.ScreenName,
+			Image:       solver.Image,
+			SolveTimeMs: solver.SolveTimeMs,
 		})
+	}
+
+	c.Header("Cache-Control", "public, max-age=60")
+	c.JSON(http.StatusOK, resp)
+}
+
+// exportContentTypes maps an export format to its Content-Type
+var exportContentTypes = map[string]string{
+	ExportFormatNDJSON: "application/x-ndjson",
+	ExportFormatBinary: "application/octet-stream",
+}
+
+// ExportStages streams every stage after since_stage_no in one response, gzip-compressed when the client
+// accepts it. The SHA-256 of the export is in its trailer and in the X-Content-SHA256 HTTP trailer.
+func (h *Handler) ExportStages(c *gin.Context) {
+	sinceStageNo, err := strconv.ParseInt(c.DefaultQuery("since_stage_no", "0"), 10, 64)
+	if err != nil || sinceStageNo < 0 {
+		problem.Write(c, problem.InvalidRequest, "since_stage_no must be a non-negative integer")
 		return
 	}
+	format := c.DefaultQuery("format", ExportFormatNDJSON)
+	contentType, ok := exportContentTypes[format]
+	if !ok {
+		writeError(c, ErrInvalidExportFormat)
+		return
+	}
+
+	c.Header("Content-Type", contentType)
+	c.Header("Cache-Control", "public, max-age=60")
+	c.Header("Vary", "Accept-Encoding")
+	c.Header("Trailer", "X-Content-SHA256")
+	var w io.Writer = c.Writer
+	var gz *gzip.Writer
+	if strings.Contains(c.GetHeader("Accept-Encoding"), "gzip") {
+		c.Header("Content-Encoding", "gzip")
+		gz = gzip.NewWriter(c.Writer)
+		w = gz
+	}
+	c.Status(http.StatusOK)
 
-	userRecord, err := h.firebaseService.GetUserByUID(ctx, token.UID)
+	// Once streaming has started the status cannot change; a failed export ends without its trailer
+	sum, err := h.stageService.ExportStages(c.Request.Context(), sinceStageNo, format, w)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to get user information",
+		fmt.Printf("Warning: stage export since %d failed: %v\n", sinceStageNo, err)
+	}
+	if gz != nil {
+		gz.Close()
+	}
+	if err == nil {
+		c.Writer.Header().Set("X-Content-SHA256", sum)
+	}
+}
+
+// GetDailyChallenge returns the stage of the day (today, or the date query parameter) with its leaderboard
+func (h *Handler) GetDailyChallenge(c *gin.Context) {
+	date := c.DefaultQuery("date", DailyChallengeDate(time.Now()))
+
+	challenge, err := h.stageService.GetDailyChallenge(c.Request.Context(), date)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	resp := openapi.DailyChallenge{
+		Date:        challenge.Date,
+		Stage:       stageResponse(challenge.Stage, challenge.Popularity),
+		Leaderboard: []openapi.DailyLeaderboardEntry{},
+	}
+	for _, entry := range challenge.Leaderboard {
+		resp.Leaderboard = append(resp.Leaderboard, openapi.DailyLeaderboardEntry{
+			Rank:        entry.Rank,
+			ScreenName:  entry.ScreenName,
+			Image:       entry.Image,
+			SolveTimeMs: entry.SolveTimeMs,
+			ClearDate:   entry.ClearDate,
 		})
+	}
+
+	c.Header("Cache-Control", "public, max-age=60")
+	c.JSON(http.StatusOK, resp)
+}
+
+func collectionProgressResponse(progress *CollectionProgress) *openapi.CollectionProgress {
+	if progress == nil {
+		return nil
+	}
+	return &openapi.CollectionProgress{
+		Cleared:   progress.Cleared,
+		Total:     progress.Total,
+		Completed: progress.Completed(),
+	}
+}
+
+func collectionResponse(collection datastore.Collection, progress *CollectionProgress) openapi.Collection {
+	return openapi.Collection{
+		Id:          collection.ID,
+		Title:       collection.Title,
+		Description: collection.Description,
+		Author:      collection.Author,
+		StageNos:    collection.StageNos,
+		CreatedAt:   collection.CreatedAt,
+		UpdatedAt:   collection.UpdatedAt,
+		Progress:    collectionProgressResponse(progress),
+	}
+}
+
+func (h *Handler) GetCollections(c *gin.Context) {
+	authUID, _ := auth.GetAuthenticatedUID(c)
+	collections, err := h.stageService.GetCollections(c.Request.Context(), authUID)
+	if err != nil {
+		writeError(c, err)
 		return
 	}
 
-	screenName := userRecord.DisplayName
-	image := userRecord.PhotoURL
-	twitterUID := ""
+	resp := []openapi.Collection{}
+	for _, summary := range collections {
+		resp = append(resp, collectionResponse(summary.Collection, summary.Progress))
+	}
 
-	if claims, ok := token.Claims["firebase"].(map[string]interface{}); ok {
-		if identities, ok := claims["identities"].(map[string]interface{}); ok {
-			if twitterIds, ok := identities["twitter.com"].([]interface{}); ok && len(twitterIds) > 0 {
-				if twitterID, ok := twitterIds[0].(string); ok {
-					twitterUID = twitterID
-				}
-			}
-		}
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *Handler) GetCollection(c *gin.Context) {
+	authUID, _ := auth.GetAuthenticatedUID(c)
+	detail, err := h.stageService.GetCollection(c.Request.Context(), c.Param("collectionId"), authUID)
+	if err != nil {
+		writeError(c, err)
+		return
 	}
 
-	// Fallback: try to get screen name from Twitter provider data
-	if screenName == "" {
-		for _, provider := range userRecord.ProviderUserInfo {
-			if provider.ProviderID == "twitter.com" {
-				screenName = provider.DisplayName
-				if image == "" {
-					image = provider.PhotoURL
-				}
-				if twitterUID == "" {
-					twitterUID = provider.UID
-				}
-				break
-			}
-		}
+	summary := collectionResponse(detail.Collection, detail.Progress)
+	resp := openapi.CollectionDetail{
+		Id:          summary.Id,
+		Title:       summary.Title,
+		Description: summary.Description,
+		Author:      summary.Author,
+		StageNos:    summary.StageNos,
+		CreatedAt:   summary.CreatedAt,
+		UpdatedAt:   summary.UpdatedAt,
+		Progress:    summary.Progress,
+		Stages:      []openapi.Stage{},
+	}
+	for _, cs := range detail.Stages {
+		stage := stageResponse(cs.Stage, cs.Popularity)
+		stage.ClearDate = cs.ClearDate
+		resp.Stages = append(resp.Stages, stage)
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *Handler) PutCollection(c *gin.Context) {
+	var param openapi.CollectionParam
+	if err := c.ShouldBindJSON(&param); err != nil {
+		problem.Write(c, problem.InvalidRequest, err.Error())
+		return
+	}
+
+	collection, created, err := h.stageService.PutCollection(c.Request.Context(), c.Param("collectionId"), CollectionParam{
+		Title:       param.Title,
+		Description: param.Description,
+		Author:      param.Author,
+		StageNos:    param.StageNos,
+	})
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	c.JSON(status, collectionResponse(*collection, nil))
+}
+
+func (h *Handler) DeleteCollection(c *gin.Context) {
+	err := h.stageService.DeleteCollection(c.Request.Context(), c.Param("collectionId"))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handler) Login(c *gin.Context) {
+	var param openapi.LoginParam
+	if err := c.ShouldBindJSON(&param); err != nil {
+		problem.Write(c, problem.InvalidRequest, err.Error())
+		return
+	}
+	if param.DeviceId != "" && !auth.IsValidDeviceID(param.DeviceId) {
+		problem.Write(c, auth.ProblemInvalidDeviceID, "")
+		return
+	}
+	// The device ID is sent with every request, so merging its clears requires the token issued with it
+	if param.DeviceId != "" && !h.deviceTokens.Verify(param.DeviceId, param.DeviceToken) {
+		problem.Write(c, problemInvalidDeviceToken, "")
+		return
+	}
+
+	ctx := c.Request.Context()
+	token, err := h.tokenVerifier.VerifyIDToken(ctx, param.Token)
+	if err != nil {
+		problem.Write(c, auth.ProblemInvalidToken, "")
+		return
+	}
+
+	userRecord, err := h.tokenVerifier.GetUser(ctx, token.UID)
+	if err != nil {
+		problem.WriteInternal(c, fmt.Errorf("failed to get user information: %w", err))
+		return
 	}
 
+	profile := auth.ExtractProfile(token, userRecord)
+
 	user, err := h.datastoreService.CreateOrUpdateUserFromFirebase(
 		ctx,
 		token.UID,
-		screenName,
-		image,
-		twitterUID,
+		profile.ScreenName,
+		profile.Image,
+		profile.TwitterUID,
+		profile.Providers,
 	)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to create or update user",
-		})
+		problem.WriteInternal(c, fmt.Errorf("failed to create or update user: %w", err))
 		return
 	}
 
+	// Merge the clears made on this device before signing in
+	if param.DeviceId != "" {
+		if _, err := h.datastoreService.MergeAnonymousUser(ctx, auth.AnonymousUID(param.DeviceId), token.UID); err != nil {
+			fmt.Printf("Warning: failed to merge anonymous user: %v\n", err)
+		}
+	}
+
 	c.JSON(http.StatusOK, openapi.LoginResult{
 		ScreenName: user.ScreenName,
+		Providers:  user.Providers,
+	})
+}
+
+// LinkAccount merges another account, identified by its ID token, into the signed-in account.
+// It is used when a sign-in credential the player wants to link already belongs to a separate account:
+// the clear history of that account is merged and the account is deleted so the credential can be linked.
+func (h *Handler) LinkAccount(c *gin.Context) {
+	authUID, exists := auth.GetAuthenticatedUID(c)
+	if !exists {
+		problem.Write(c, problem.AuthenticationRequired, "")
+		return
+	}
+
+	var param openapi.LinkAccountParam
+	if err := c.ShouldBindJSON(&param); err != nil {
+		problem.Write(c, problem.InvalidRequest, err.Error())
+		return
+	}
+
+	user, merged, err := h.stageService.LinkAccount(c.Request.Context(), authUID, param.Token)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, openapi.LinkAccountResult{
+		ScreenName:        user.ScreenName,
+		Providers:         user.Providers,
+		MergedStageCount:  int64(merged),
+		ClearedStageCount: user.ClearStageCount,
 	})
 }
 
+// IssueDeviceID issues a device ID identifying a per-device anonymous player, with the device token
+// proving its ownership on login. The anonymous user itself is created on its first clear.
+func (h *Handler) IssueDeviceID(c *gin.Context) {
+	deviceID, err := auth.NewDeviceID()
+	if err != nil {
+		problem.WriteInternal(c, fmt.Errorf("failed to issue device ID: %w", err))
+		return
+	}
+
+	c.JSON(http.StatusCreated, openapi.Device{DeviceId: deviceID, DeviceToken: h.deviceTokens.Issue(deviceID)})
+}
+
 func (h *Handler) SyncStages(c *gin.Context) {
 	authUID, exists := auth.GetAuthenticatedUID(c)
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		problem.Write(c, problem.AuthenticationRequired, "")
 		return
 	}
 
 	var clientClearedStages []openapi.ClearedStage
 	if err := c.ShouldBindJSON(&clientClearedStages); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		problem.Write(c, problem.InvalidRequest, err.Error())
 		return
 	}
 
-	serverClearedStages, err := h.stageService.SyncStages(c.Request.Context(), authUID, clientClearedStages)
+	serverClearedStages, failures, err := h.stageService.SyncStages(c.Request.Context(), authUID, clientClearedStages)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(c, err)
 		return
 	}
 
-	var response []openapi.ClearedStage
+	response := openapi.SyncResponse{
+		ClearedStages: []openapi.ClearedStage{},
+		FailedStages:  []openapi.SyncStageFailure{},
+	}
 	for _, result := range serverClearedStages {
-		response = append(response, openapi.ClearedStage{
+		response.ClearedStages = append(response.ClearedStages, openapi.ClearedStage{
 			StageNo:   result.StageNo,
 			ClearDate: result.ClearDate,
 		})
 	}
+	for _, failure := range failures {
+		response.FailedStages = append(response.FailedStages, openapi.SyncStageFailure{
+			StageNo: failure.StageNo,
+			Reason:  failure.Reason,
+		})
+	}
 
 	c.JSON(http.StatusOK, response)
 }
@@ -249,13 +521,13 @@ func (h *Handler) SyncStages(c *gin.Context) {
 func (h *Handler) DeleteAccount(c *gin.Context) {
 	authUID, exists := auth.GetAuthenticatedUID(c)
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		problem.Write(c, problem.AuthenticationRequired, "")
 		return
 	}
 
 	err := h.stageService.DeleteAccount(c.Request.Context(), authUID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(c, err)
 		return
 	}
 
@@ -264,27 +536,73 @@ func (h *Handler) DeleteAccount(c *gin.Context) {
 	})
 }
 
+func (h *Handler) GetProfile(c *gin.Context) {
+	authUID, exists := auth.GetAuthenticatedUID(c)
+	if !exists || auth.IsGuestUser(authUID) {
+		problem.Write(c, problem.AuthenticationRequired, "")
+		return
+	}
+
+	profile, err := h.stageService.GetProfile(c.Request.Context(), authUID)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	resp := openapi.UserProfile{
+		ScreenName:      profile.User.ScreenName,
+		Image:           profile.User.Image,
+		ClearStageCount: profile.User.ClearStageCount,
+		CurrentStreak:   profile.Streak.Current,
+		LongestStreak:   profile.Streak.Longest,
+		Achievements:    []openapi.Achievement{},
+	}
+	for _, a := range profile.Achievements {
+		resp.Achievements = append(resp.Achievements, openapi.Achievement{
+			Id:         a.Badge,
+			UnlockedAt: a.UnlockedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
 func (h *Handler) GetRecentStages(c *gin.Context) {
-	stages, err := h.datastoreService.GetRecentStages(c.Request.Context(), 10)
+	ctx := c.Request.Context()
+	stages, stageKeys, err := h.datastoreService.GetRecentStages(ctx, 10)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	popularity, err := h.stageService.GetStagePopularity(ctx, stages, stageKeys)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(c, err)
 		return
 	}
 
 	stageList := []openapi.Stage{}
-	for _, stage := range stages {
-		stageList = append(stageList, openapi.Stage{
-			StageNo:    stage.StageNo,
-			Size:       stage.Size,
-			Stage:      stage.Stage,
-			Creator:    stage.Creator,
-			RegistDate: stage.RegistDate,
-		})
+	for i, stage := range stages {
+		stageList = append(stageList, stageResponse(stage, popularity[i]))
 	}
 
 	c.JSON(http.StatusOK, stageList)
 }
 
+// stageResponse converts a stage with its clear count and first clearer to its API representation
+func stageResponse(stage datastore.KyouenPuzzle, popularity StagePopularity) openapi.Stage {
+	return openapi.Stage{
+		StageNo:        stage.StageNo,
+		Size:           stage.Size,
+		Stage:          stage.Stage,
+		StageCompact:   compactStage(stage.Size, stage.Stage),
+		Creator:        stage.Creator,
+		RegistDate:     stage.RegistDate,
+		ClearCount:     popularity.ClearCount,
+		FirstClearedBy: popularity.FirstClearedBy,
+		FirstClearedAt: popularity.FirstClearedAt,
+	}
+}
+
 type ActivityStageResponse struct {
 	StageNo   int64     `json:"stage_no"`
 	ClearDate time.Time `json:"clear_date"`
@@ -296,13 +614,66 @@ type ActivityUserResponse struct {
 	ClearedStages []ActivityStageResponse `json:"cleared_stages"`
 }
 
+const (
+	defaultActivityLimit = 50
+	maxActivityLimit     = 100
+)
+
+// GetActivities returns a page of recent clears. By default clears are grouped by user;
+// format=flat returns them as a single list, newest first. The cursor of the next page is
+// sent in the X-Next-Cursor header, which is absent on the last page.
 func (h *Handler) GetActivities(c *gin.Context) {
-	activities, err := h.stageService.GetActivities(c.Request.Context(), 50)
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultActivityLimit)))
+	if err != nil || limit <= 0 {
+		limit = defaultActivityLimit
+	}
+	if limit > maxActivityLimit {
+		limit = maxActivityLimit
+	}
+	query := ActivityQuery{
+		UserID: c.Query("user_id"),
+		Limit:  limit,
+		Cursor: c.Query("cursor"),
+	}
+	if stageNo := c.Query("stage_no"); stageNo != "" {
+		query.StageNo, err = strconv.ParseInt(stageNo, 10, 64)
+		if err != nil || query.StageNo <= 0 {
+			problem.Write(c, problem.InvalidRequest, "invalid stage_no")
+			return
+		}
+	}
+	format := c.DefaultQuery("format", "grouped")
+	if format != "grouped" && format != "flat" {
+		problem.Write(c, problem.InvalidRequest, "format must be grouped or flat")
+		return
+	}
+
+	page, err := h.stageService.GetActivities(c.Request.Context(), query)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(c, err)
 		return
 	}
 
+	if page.NextCursor != "" {
+		c.Header("X-Next-Cursor", page.NextCursor)
+	}
+	c.Header("Cache-Control", "public, max-age=60")
+
+	if format == "flat" {
+		resp := make([]openapi.ActivityClearEvent, 0, len(page.Entries))
+		for _, e := range page.Entries {
+			resp = append(resp, openapi.ActivityClearEvent{
+				StageNo:    e.StageNo,
+				ScreenName: e.ScreenName,
+				Image:      e.Image,
+				ClearDate:  e.ClearDate,
+			})
+		}
+		c.JSON(http.StatusOK, resp)
+		return
+	}
+
+	activities := groupActivities(page.Entries)
 	resp := make([]ActivityUserResponse, 0, len(activities))
 	for _, a := range activities {
 		cs := make([]ActivityStageResponse, len(a.ClearedStages))
@@ -315,12 +686,66 @@ func (h *Handler) GetActivities(c *gin.Context) {
 			ClearedStages: cs,
 		})
 	}
-
-	c.Header("Cache-Control", "public, max-age=60")
 	c.JSON(http.StatusOK, resp)
 }
 
-// Helper function for validation
-func isKyouen(kyouenStage *models.KyouenStage) bool {
-	return kyouenStage.IsKyouenByWhite() != nil
+// streamRetry is the reconnection delay suggested to activity stream clients
+const streamRetry = 3 * time.Second
+
+// StreamActivities pushes new clears and stages as Server-Sent Events. A client reconnecting with
+// Last-Event-ID (or the last_event_id query parameter) first receives the recent events it missed.
+func (h *Handler) StreamActivities(c *gin.Context) {
+	if h.events == nil {
+		problem.Write(c, problemActivityStreamUnavailable, "")
+		return
+	}
+
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+	sub, backlog := h.events.Subscribe(lastEventID)
+	defer h.events.Unsubscribe(sub)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	// Disable response buffering in front proxies
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	w := c.Writer
+	if err := events.WriteSSERetry(w, streamRetry); err != nil {
+		return
+	}
+	for _, event := range backlog {
+		if err := events.WriteSSE(w, event); err != nil {
+			return
+		}
+	}
+	w.Flush()
+
+	heartbeat := time.NewTicker(h.streamHeartbeat)
+	defer heartbeat.Stop()
+
+	ctx := c.Request.Context()
+	for {
+		var err error
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-sub.C:
+			if !ok {
+				// Dropped for falling behind; the client reconnects with its last event ID
+				return
+			}
+			err = events.WriteSSE(w, event)
+		case <-heartbeat.C:
+			err = events.WriteSSEHeartbeat(w)
+		}
+		if err != nil {
+			return
+		}
+		w.Flush()
+	}
 }
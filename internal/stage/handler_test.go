@@ -1,6 +1,7 @@
 package stage
 
 import (
+	"context"
 	"errors"
 	"net/http"
 	"net/http/httptest"
@@ -10,6 +11,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"kyouen-server/internal/auth"
+	"kyouen-server/internal/events"
 )
 
 // StageServiceInterface defines the interface for stage service
@@ -320,4 +322,36 @@ func TestDeleteAccount_ServiceError(t *testing.T) {
 	if !mockService.WasDeleteAccountCalled("test-uid") {
 		t.Errorf("Expected DeleteAccount to be called with 'test-uid'")
 	}
-}
\ No newline at end of file
+}
+func TestStreamActivities_ReplaysAfterLastEventID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	bus := events.NewBus(nil, events.DefaultHistorySize)
+	handler := &Handler{events: bus, streamHeartbeat: time.Hour}
+	router := gin.New()
+	router.GET("/v2/activities/stream", handler.StreamActivities)
+
+	// The first subscriber observes the IDs of the published events
+	observer, _ := bus.Subscribe("")
+	bus.Publish(context.Background(), events.TypeStage, map[string]int{"stage_no": 1})
+	bus.Publish(context.Background(), events.TypeClear, map[string]int{"stage_no": 2})
+	first := <-observer.C
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", "/v2/activities/stream", nil)
+	req.Header.Set("Last-Event-ID", first.ID)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	if ct := resp.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Expected Content-Type text/event-stream, got %s", ct)
+	}
+	body := resp.Body.String()
+	if strings.Contains(body, "id: "+first.ID) {
+		t.Errorf("Expected the event of the last event ID not to be replayed, got: %s", body)
+	}
+	if !strings.Contains(body, "event: clear\ndata: {\"stage_no\":2}") {
+		t.Errorf("Expected the missed clear event to be replayed, got: %s", body)
+	}
+}
@@ -3,26 +3,33 @@ package stage
 import (
 	"context"
 	"errors"
-	"math"
+	"fmt"
+	"sort"
 	"strings"
 	"time"
 
 	"cloud.google.com/go/datastore"
 	"kyouen-server/internal/auth"
 	datastoreservice "kyouen-server/internal/datastore"
+	"kyouen-server/internal/events"
 	"kyouen-server/internal/generated/openapi"
 	"kyouen-server/pkg/models"
 )
 
 var (
-	ErrInsufficientStones = errors.New("stage must have 5 stones")
-	ErrNoKyouen           = errors.New("sent stage don't have kyouen")
-	ErrStageExists        = errors.New("sent stage is already exists")
-	ErrInvalidKyouen      = errors.New("invalid kyouen")
-	ErrStageNotFound      = errors.New("stage not found")
-	ErrStageMismatch      = errors.New("stage mismatch")
-	ErrUserNotFound       = errors.New("user not found")
-	ErrInvalidStageLength = errors.New("stage length must be size * size")
+	ErrInsufficientStones  = errors.New("stage must have 5 stones")
+	ErrNoKyouen            = errors.New("sent stage don't have kyouen")
+	ErrStageExists         = errors.New("sent stage is already exists")
+	ErrInvalidKyouen       = errors.New("invalid kyouen")
+	ErrStageNotFound       = errors.New("stage not found")
+	ErrStageMismatch       = errors.New("stage mismatch")
+	ErrUserNotFound        = errors.New("user not found")
+	ErrInvalidStageLength  = errors.New("stage length must be size * size")
+	ErrInvalidLinkToken    = errors.New("invalid ID token of the account to link")
+	ErrSameAccount         = errors.New("cannot link an account to itself")
+	ErrInvalidCursor       = errors.New("invalid cursor")
+	ErrInvalidExportFormat = errors.New("format must be ndjson or binary")
+	ErrInvalidCompactStage = errors.New("invalid stage_compact")
 )
 
 type ClearedStageResult struct {
@@ -32,13 +39,35 @@ type ClearedStageResult struct {
 
 type Service struct {
 	datastoreService *datastoreservice.DatastoreService
-	firebaseService  *datastoreservice.FirebaseService
+	tokenVerifier    auth.TokenVerifier
+	antiCheat        AntiCheatPolicy
+	solveTimeFloors  *solveTimeFloorCache
+	stageSizes       *stageSizeCounts
+	events           *events.Bus
 }
 
-func NewService(datastoreService *datastoreservice.DatastoreService, firebaseService *datastoreservice.FirebaseService) *Service {
+func NewService(datastoreService *datastoreservice.DatastoreService, tokenVerifier auth.TokenVerifier) *Service {
 	return &Service{
 		datastoreService: datastoreService,
-		firebaseService:  firebaseService,
+		tokenVerifier:    tokenVerifier,
+		antiCheat:        DefaultAntiCheatPolicy(),
+		solveTimeFloors:  newSolveTimeFloorCache(),
+		stageSizes:       &stageSizeCounts{},
+	}
+}
+
+// SetEventBus sets the bus that new clears and stages are published to
+func (s *Service) SetEventBus(bus *events.Bus) {
+	s.events = bus
+}
+
+// publishActivity publishes an activity event; a failure is logged and does not fail the request
+func (s *Service) publishActivity(ctx context.Context, eventType string, data interface{}) {
+	if s.events == nil {
+		return
+	}
+	if err := s.events.Publish(ctx, eventType, data); err != nil {
+		fmt.Printf("Warning: %v\n", err)
 	}
 }
 
@@ -59,12 +88,67 @@ func (s *Service) GetStages(ctx context.Context, startStageNo, limit int, authUI
 	return stages, stageKeys, clearedKeyIDs, nil
 }
 
-func (s *Service) CreateStage(ctx context.Context, param openapi.NewStage, creatorName string) (*datastoreservice.KyouenPuzzle, error) {
-	if len(param.Stage) != int(param.Size)*int(param.Size) {
-		return nil, ErrInvalidStageLength
+// StagePopularity is how many users cleared a stage and who cleared it first
+type StagePopularity struct {
+	ClearCount     int64
+	FirstClearedBy string     // screen name, empty if nobody cleared the stage or the first clearer is deleted or suspicious
+	FirstClearedAt *time.Time // nil if nobody cleared the stage
+}
+
+// GetStagePopularity returns the clear count and first clearer of each stage, in the same order.
+// Clear counts are read from the stages' sharded counters and may lag a few seconds behind.
+func (s *Service) GetStagePopularity(ctx context.Context, stages []datastoreservice.KyouenPuzzle, stageKeys []*datastore.Key) ([]StagePopularity, error) {
+	counters := make([]datastoreservice.ShardedCounter, len(stageKeys))
+	for i, key := range stageKeys {
+		counters[i] = datastoreservice.StageClearCounter(key)
+	}
+	counts, err := s.datastoreService.ReadCounters(ctx, counters)
+	if err != nil {
+		return nil, err
 	}
 
-	stage := *models.NewKyouenStage(int(param.Size), param.Stage)
+	var userKeys []*datastore.Key
+	for _, st := range stages {
+		if st.FirstClearedBy != nil {
+			userKeys = append(userKeys, st.FirstClearedBy)
+		}
+	}
+	uUserKeys, userIdx := uniqueKeys(userKeys)
+	users, err := s.datastoreService.GetUsersByKeys(ctx, uUserKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]StagePopularity, len(stages))
+	for i, st := range stages {
+		// Counters of stages cleared only before they were backfilled may lag below zero after deletions
+		result[i].ClearCount = max(counts[i].Count, 0)
+		if st.FirstClearedBy == nil {
+			continue
+		}
+		firstClearedAt := st.FirstClearedAt
+		result[i].FirstClearedAt = &firstClearedAt
+		if u := users[userIdx[st.FirstClearedBy.String()]]; u.UserID != "" && !u.Suspicious {
+			result[i].FirstClearedBy = u.ScreenName
+		}
+	}
+	return result, nil
+}
+
+func (s *Service) CreateStage(ctx context.Context, param openapi.NewStage, creatorName string) (*datastoreservice.KyouenPuzzle, error) {
+	size, stageStr, err := requestStage(param.Size, param.Stage, param.StageCompact)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := models.ParseStage(int(size), stageStr)
+	if err != nil {
+		var lengthErr *models.StageLengthError
+		if errors.As(err, &lengthErr) {
+			return nil, ErrInvalidStageLength
+		}
+		return nil, err
+	}
+	stage := *parsed
 
 	if stage.StoneCount() <= 4 {
 		return nil, ErrInsufficientStones
@@ -84,21 +168,80 @@ func (s *Service) CreateStage(ctx context.Context, param openapi.NewStage, creat
 	}
 
 	newStage := datastoreservice.KyouenPuzzle{
-		Size:    param.Size,
-		Stage:   param.Stage,
+		Size:    int64(stage.Size()),
+		Stage:   stageStr,
 		Creator: creatorName,
 	}
 
-	return s.datastoreService.CreateStage(ctx, newStage)
+	created, err := s.datastoreService.CreateStage(ctx, newStage)
+	if err != nil {
+		return nil, err
+	}
+
+	s.publishActivity(ctx, events.TypeStage, openapi.Stage{
+		StageNo:      created.StageNo,
+		Size:         created.Size,
+		Stage:        created.Stage,
+		StageCompact: compactStage(created.Size, created.Stage),
+		Creator:      created.Creator,
+		RegistDate:   created.RegistDate,
+	})
+	return created, nil
+}
+
+// requestStage returns the size and stage string of a request, which gives either the stage string
+// or its compact encoding (see models.EncodeCompactStage). A size given with stage_compact must match it.
+func requestStage(size int64, stage, compact string) (int64, string, error) {
+	if compact == "" {
+		return size, stage, nil
+	}
+	compactSize, compactStr, err := models.DecodeCompactStage(compact)
+	if err != nil {
+		return 0, "", ErrInvalidCompactStage
+	}
+	if stage != "" && stage != compactStr {
+		return 0, "", ErrInvalidCompactStage
+	}
+	if size != 0 && size != int64(compactSize) {
+		return 0, "", ErrInvalidStageLength
+	}
+	return int64(compactSize), compactStr, nil
 }
 
-func (s *Service) ClearStage(ctx context.Context, stageNo int, stageData string, userUID string) (*datastoreservice.User, error) {
-	size := int(math.Sqrt(float64(len(stageData))))
-	paramKyouenStage := models.NewKyouenStage(size, stageData)
+// compactStage returns the compact encoding of a stored stage, or "" if the stage is malformed
+func compactStage(size int64, stage string) string {
+	compact, err := models.EncodeCompactStage(int(size), stage)
+	if err != nil {
+		return ""
+	}
+	return compact
+}
 
-	if !isKyouen(paramKyouenStage) {
+// ClearStage checks the answer and records the clear with its solve details.
+// Clears of signed-in and anonymous users pass the anti-cheat heuristics first (see AntiCheatPolicy).
+func (s *Service) ClearStage(ctx context.Context, stageNo int, param openapi.ClearStage, userUID string) (*datastoreservice.User, error) {
+	_, stageStr, err := requestStage(0, param.Stage, param.StageCompact)
+	if err != nil {
+		return nil, err
+	}
+	paramKyouenStage, err := models.ParseStage(0, stageStr)
+	if err != nil {
+		return nil, err
+	}
+
+	kyouenData := paramKyouenStage.IsKyouenByWhite()
+	if kyouenData == nil {
 		return nil, ErrInvalidKyouen
 	}
+	details := datastoreservice.ClearDetails{
+		SolveTimeMs: param.SolveTimeMs,
+		Attempts:    param.Attempts,
+		HintsUsed:   param.HintsUsed,
+		Shape:       datastoreservice.ShapeCircle,
+	}
+	if kyouenData.IsLine() {
+		details.Shape = datastoreservice.ShapeLine
+	}
 
 	stage, stageKeys, err := s.datastoreService.GetStageByNo(ctx, stageNo)
 	if err != nil {
@@ -117,6 +260,11 @@ func (s *Service) ClearStage(ctx context.Context, stageNo int, stageData string,
 		if err != nil {
 			return nil, ErrUserNotFound
 		}
+	} else if auth.IsAnonymousUser(userUID) {
+		user, userKey, err = s.datastoreService.GetOrCreateAnonymousUser(ctx, userUID)
+		if err != nil {
+			return nil, ErrUserNotFound
+		}
 	} else {
 		user, userKey, err = s.datastoreService.GetUserByID(ctx, userUID)
 		if err != nil {
@@ -124,61 +272,164 @@ func (s *Service) ClearStage(ctx context.Context, stageNo int, stageData string,
 		}
 	}
 
-	err = s.datastoreService.CreateStageUser(ctx, stageKeys[0], userKey)
+	var rate datastoreservice.ClearRateLimit
+	if !auth.IsGuestUser(userUID) {
+		rate = s.clearRateLimit()
+	}
+	err = s.datastoreService.CreateStageUser(ctx, stageKeys[0], userKey, details, rate)
 	if err != nil {
-		return nil, err
+		return nil, s.clearRateError(ctx, user, userKey, err)
+	}
+	if !auth.IsGuestUser(userUID) {
+		s.checkSolveTime(ctx, user, userKey, stageKeys[0], stage.StageNo, details.SolveTimeMs)
+	}
+
+	// Suspicious users are left out of the live feed as they are of the activity list
+	if !user.Suspicious {
+		s.publishActivity(ctx, events.TypeClear, openapi.ActivityClearEvent{
+			StageNo:    stage.StageNo,
+			ScreenName: user.ScreenName,
+			Image:      user.Image,
+			ClearDate:  time.Now(),
+		})
 	}
 
 	return user, nil
 }
 
-func (s *Service) SyncStages(ctx context.Context, userUID string, clientClearedStages []openapi.ClearedStage) ([]ClearedStageResult, error) {
+// syncConcurrency bounds the number of Datastore requests a sync runs in parallel
+const syncConcurrency = 4
+
+// Reasons reported for stages that could not be synced
+const (
+	SyncFailureInvalidStageNo = "invalid_stage_no"
+	SyncFailureStageNotFound  = "stage_not_found"
+	SyncFailureWriteFailed    = "write_failed"
+)
+
+// SyncFailure describes a client-cleared stage that could not be recorded
+type SyncFailure struct {
+	StageNo int64
+	Reason  string
+}
+
+// SyncStages records the stages the client cleared offline and returns all stages cleared by the user.
+// Stages are resolved and written in batches; the client's clear dates are kept,
+// and stages that cannot be recorded are returned as failures instead of aborting the sync.
+func (s *Service) SyncStages(ctx context.Context, userUID string, clientClearedStages []openapi.ClearedStage) ([]ClearedStageResult, []SyncFailure, error) {
 	_, userKey, err := s.datastoreService.GetUserByID(ctx, userUID)
 	if err != nil {
-		return nil, ErrUserNotFound
+		return nil, nil, ErrUserNotFound
 	}
 
-	for _, clearedStage := range clientClearedStages {
-		_, stageKeys, err := s.datastoreService.GetStageByNo(ctx, int(clearedStage.StageNo))
-		if err != nil {
+	clears, failures := normalizeClientClears(clientClearedStages, time.Now())
+
+	stageNos := make([]int64, len(clears))
+	for i, clear := range clears {
+		stageNos[i] = clear.StageNo
+	}
+	stageKeys, err := s.datastoreService.GetStageKeysByNos(ctx, stageNos, syncConcurrency)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	existing, err := s.datastoreService.GetClearedStagesByUser(ctx, userKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	cleared := make(map[string]bool, len(existing))
+	for _, su := range existing {
+		cleared[su.StageKey.String()] = true
+	}
+
+	var newStageUsers []datastoreservice.StageUser
+	var newStageNos []int64
+	for _, clear := range clears {
+		stageKey, ok := stageKeys[clear.StageNo]
+		if !ok {
+			failures = append(failures, SyncFailure{StageNo: clear.StageNo, Reason: SyncFailureStageNotFound})
 			continue
 		}
-
-		exists, err := s.datastoreService.HasStageUser(ctx, stageKeys[0], userKey)
-		if err != nil {
+		if cleared[stageKey.String()] {
 			continue
 		}
+		newStageUsers = append(newStageUsers, datastoreservice.StageUser{
+			StageKey:  stageKey,
+			UserKey:   userKey,
+			ClearDate: clear.ClearDate,
+		})
+		newStageNos = append(newStageNos, clear.StageNo)
+	}
 
-		if !exists {
-			err = s.datastoreService.CreateStageUser(ctx, stageKeys[0], userKey)
-			if err != nil {
-				continue
-			}
+	var results []ClearedStageResult
+	for i, putErr := range s.datastoreService.PutStageUsers(ctx, newStageUsers, syncConcurrency) {
+		if putErr != nil {
+			fmt.Printf("Warning: failed to sync stage %d for user %s: %v\n", newStageNos[i], userUID, putErr)
+			failures = append(failures, SyncFailure{StageNo: newStageNos[i], Reason: SyncFailureWriteFailed})
+			continue
 		}
+		results = append(results, ClearedStageResult{StageNo: newStageNos[i], ClearDate: newStageUsers[i].ClearDate})
 	}
-
-	stageUsers, err := s.datastoreService.GetClearedStagesByUser(ctx, userKey)
-	if err != nil {
-		return nil, err
+	if len(results) > 0 {
+		if _, err := s.datastoreService.RefreshUserClearCount(ctx, userKey); err != nil {
+			fmt.Printf("Warning: failed to refresh clear count of user %s: %v\n", userUID, err)
+		}
 	}
 
-	stageKeys := make([]*datastore.Key, len(stageUsers))
-	for i, su := range stageUsers {
-		stageKeys[i] = su.StageKey
+	existingKeys := make([]*datastore.Key, len(existing))
+	for i, su := range existing {
+		existingKeys[i] = su.StageKey
 	}
-	stages, err := s.datastoreService.GetStagesByKeys(ctx, stageKeys)
+	stages, err := s.datastoreService.GetStagesByKeys(ctx, existingKeys)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-
-	results := make([]ClearedStageResult, len(stageUsers))
-	for i, su := range stageUsers {
-		results[i] = ClearedStageResult{
+	for i, su := range existing {
+		results = append(results, ClearedStageResult{
 			StageNo:   stages[i].StageNo,
 			ClearDate: su.ClearDate,
+		})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].ClearDate.Before(results[j].ClearDate)
+	})
+	sort.Slice(failures, func(i, j int) bool {
+		return failures[i].StageNo < failures[j].StageNo
+	})
+	return results, failures, nil
+}
+
+// normalizeClientClears validates the stages sent by the client and keeps one clear per stage.
+// The earliest clear date of a stage wins; missing or future dates are replaced with now.
+func normalizeClientClears(clientClearedStages []openapi.ClearedStage, now time.Time) ([]openapi.ClearedStage, []SyncFailure) {
+	var failures []SyncFailure
+	byStageNo := make(map[int64]openapi.ClearedStage, len(clientClearedStages))
+	var order []int64
+
+	for _, clear := range clientClearedStages {
+		if clear.StageNo < 1 {
+			failures = append(failures, SyncFailure{StageNo: clear.StageNo, Reason: SyncFailureInvalidStageNo})
+			continue
+		}
+		if clear.ClearDate.IsZero() || clear.ClearDate.After(now) {
+			clear.ClearDate = now
+		}
+
+		prev, ok := byStageNo[clear.StageNo]
+		if !ok {
+			order = append(order, clear.StageNo)
+		}
+		if !ok || clear.ClearDate.Before(prev.ClearDate) {
+			byStageNo[clear.StageNo] = clear
 		}
 	}
-	return results, nil
+
+	clears := make([]openapi.ClearedStage, len(order))
+	for i, stageNo := range order {
+		clears[i] = byStageNo[stageNo]
+	}
+	return clears, failures
 }
 
 // Helper function to check if stage exists in all rotations and reflections
@@ -205,6 +456,146 @@ func (s *Service) hasRegisteredStageAll(ctx context.Context, stage models.Kyouen
 	return false, nil
 }
 
+const (
+	// fastestSolversLimit is the number of fastest solvers reported in stage stats
+	fastestSolversLimit = 5
+	// fastestSolverCandidates is the number of fastest records looked up to fill the ranking
+	// after skipping deleted and suspicious users
+	fastestSolverCandidates = fastestSolversLimit * 4
+)
+
+// StageStats summarizes how players solved a stage, for stage details and difficulty scoring.
+// Solve details are optional in clear requests, so averages only cover clears that reported them.
+type StageStats struct {
+	StageNo           int64
+	ClearCount        int64   // number of users who cleared the stage
+	SolveTimeSamples  int64   // number of first clears that reported a solve time
+	MedianSolveTimeMs int64   // median first-clear solve time (0 if no samples)
+	AverageAttempts   float64 // average attempts of first clears that reported them
+	HintUsageRate     float64 // ratio of first clears that used at least one hint
+	LineClears        int64   // first clears answered with a line
+	CircleClears      int64   // first clears answered with a circle
+	FastestSolvers    []FastestSolver
+	FirstClearedBy    string     // see StagePopularity
+	FirstClearedAt    *time.Time // see StagePopularity
+}
+
+// FastestSolver is a user with one of the fastest solve times of a stage
+type FastestSolver struct {
+	ScreenName  string
+	Image       string
+	SolveTimeMs int64
+}
+
+// GetStageStats aggregates the clear records of a stage.
+// Suspicious users are left out of the fastest solvers ranking.
+func (s *Service) GetStageStats(ctx context.Context, stageNo int) (*StageStats, error) {
+	stage, stageKeys, err := s.datastoreService.GetStageByNo(ctx, stageNo)
+	if err != nil {
+		return nil, ErrStageNotFound
+	}
+
+	stageUsers, err := s.datastoreService.GetStageUsersByStage(ctx, stageKeys[0])
+	if err != nil {
+		return nil, err
+	}
+
+	stats, fastest := computeStageStats(stageUsers, fastestSolverCandidates)
+	stats.StageNo = int64(stageNo)
+
+	// The clear count is exact here since all records are read; only the first clearer is taken from the stage
+	popularity, err := s.GetStagePopularity(ctx, []datastoreservice.KyouenPuzzle{*stage}, stageKeys[:1])
+	if err != nil {
+		return nil, err
+	}
+	stats.FirstClearedBy = popularity[0].FirstClearedBy
+	stats.FirstClearedAt = popularity[0].FirstClearedAt
+
+	userKeys := make([]*datastore.Key, len(fastest))
+	for i, su := range fastest {
+		userKeys[i] = su.UserKey
+	}
+	users, err := s.datastoreService.GetUsersByKeys(ctx, userKeys)
+	if err != nil {
+		return nil, err
+	}
+	stats.FastestSolvers = []FastestSolver{}
+	for i, u := range users {
+		if len(stats.FastestSolvers) == fastestSolversLimit {
+			break
+		}
+		// Skip users deleted after clearing and users flagged by anti-cheat
+		if u.UserID == "" || u.Suspicious {
+			continue
+		}
+		stats.FastestSolvers = append(stats.FastestSolvers, FastestSolver{
+			ScreenName:  u.ScreenName,
+			Image:       u.Image,
+			SolveTimeMs: fastest[i].BestSolveTimeMs,
+		})
+	}
+
+	return stats, nil
+}
+
+// computeStageStats aggregates clear records of a stage and returns the records with the fastest solve times
+func computeStageStats(stageUsers []datastoreservice.StageUser, fastestLimit int) (*StageStats, []datastoreservice.StageUser) {
+	stats := &StageStats{ClearCount: int64(len(stageUsers))}
+
+	var solveTimes []int64
+	var attempts, attemptSamples, hintSamples, hintUsers int64
+	var fastest []datastoreservice.StageUser
+	for _, su := range stageUsers {
+		if su.SolveTimeMs > 0 {
+			solveTimes = append(solveTimes, su.SolveTimeMs)
+		}
+		if su.Attempts > 0 {
+			attempts += su.Attempts
+			attemptSamples++
+		}
+		// Hints are only known for clears that reported solve details
+		if su.SolveTimeMs > 0 || su.Attempts > 0 || su.HintsUsed > 0 {
+			hintSamples++
+			if su.HintsUsed > 0 {
+				hintUsers++
+			}
+		}
+		switch su.Shape {
+		case datastoreservice.ShapeLine:
+			stats.LineClears++
+		case datastoreservice.ShapeCircle:
+			stats.CircleClears++
+		}
+		if su.BestSolveTimeMs > 0 {
+			fastest = append(fastest, su)
+		}
+	}
+
+	stats.SolveTimeSamples = int64(len(solveTimes))
+	if len(solveTimes) > 0 {
+		sort.Slice(solveTimes, func(i, j int) bool { return solveTimes[i] < solveTimes[j] })
+		mid := len(solveTimes) / 2
+		if len(solveTimes)%2 == 0 {
+			stats.MedianSolveTimeMs = (solveTimes[mid-1] + solveTimes[mid]) / 2
+		} else {
+			stats.MedianSolveTimeMs = solveTimes[mid]
+		}
+	}
+	if attemptSamples > 0 {
+		stats.AverageAttempts = float64(attempts) / float64(attemptSamples)
+	}
+	if hintSamples > 0 {
+		stats.HintUsageRate = float64(hintUsers) / float64(hintSamples)
+	}
+
+	sort.SliceStable(fastest, func(i, j int) bool { return fastest[i].BestSolveTimeMs < fastest[j].BestSolveTimeMs })
+	if len(fastest) > fastestLimit {
+		fastest = fastest[:fastestLimit]
+	}
+
+	return stats, fastest
+}
+
 type ActivityStage struct {
 	StageNo   int64
 	ClearDate time.Time
@@ -217,13 +608,58 @@ type ActivityUser struct {
 	ClearedStages []ActivityStage
 }
 
-func (s *Service) GetActivities(ctx context.Context, limit int) ([]ActivityUser, error) {
-	stageUsers, err := s.datastoreService.GetRecentActivities(ctx, limit)
-	if err != nil {
+// ActivityEntry is a single clear in the activity feed
+type ActivityEntry struct {
+	UserID     string
+	ScreenName string
+	Image      string
+	StageNo    int64
+	ClearDate  time.Time
+}
+
+// ActivityQuery selects a page of the activity feed. UserID and StageNo are optional filters (zero matches all),
+// and Cursor is the NextCursor of the previous page (empty for the first page).
+type ActivityQuery struct {
+	UserID  string
+	StageNo int64
+	Limit   int
+	Cursor  string
+}
+
+// ActivityPage is a page of clears, newest first. NextCursor is empty on the last page.
+// A page may hold fewer than Limit entries when clears by suspicious users or of deleted stages are left out.
+type ActivityPage struct {
+	Entries    []ActivityEntry
+	NextCursor string
+}
+
+// GetActivities returns a page of recent clears, newest first
+func (s *Service) GetActivities(ctx context.Context, q ActivityQuery) (*ActivityPage, error) {
+	var filter datastoreservice.ActivityFilter
+	if q.UserID != "" {
+		_, userKey, err := s.datastoreService.GetUserByID(ctx, q.UserID)
+		if err != nil {
+			return nil, ErrUserNotFound
+		}
+		filter.UserKey = userKey
+	}
+	if q.StageNo != 0 {
+		_, stageKeys, err := s.datastoreService.GetStageByNo(ctx, int(q.StageNo))
+		if err != nil {
+			return nil, ErrStageNotFound
+		}
+		filter.StageKey = stageKeys[0]
+	}
+
+	stageUsers, nextCursor, err := s.datastoreService.GetActivityPage(ctx, filter, q.Limit, q.Cursor)
+	if errors.Is(err, datastoreservice.ErrInvalidCursor) {
+		return nil, ErrInvalidCursor
+	} else if err != nil {
 		return nil, err
 	}
+	page := &ActivityPage{Entries: []ActivityEntry{}, NextCursor: nextCursor}
 	if len(stageUsers) == 0 {
-		return []ActivityUser{}, nil
+		return page, nil
 	}
 
 	userKeys := make([]*datastore.Key, len(stageUsers))
@@ -244,28 +680,42 @@ func (s *Service) GetActivities(ctx context.Context, limit int) ([]ActivityUser,
 		return nil, err
 	}
 
-	activityMap := make(map[string]*ActivityUser)
-	var order []string
 	for _, su := range stageUsers {
 		u := users[userIdx[su.UserKey.String()]]
-		if u.UserID == "" {
+		if u.UserID == "" || u.Suspicious {
 			continue
 		}
 		st := stages[stageIdx[su.StageKey.String()]]
 		if st.StageNo == 0 {
 			continue
 		}
-		if _, ok := activityMap[u.UserID]; !ok {
-			activityMap[u.UserID] = &ActivityUser{
-				UserID:     u.UserID,
-				ScreenName: u.ScreenName,
-				Image:      u.Image,
+		page.Entries = append(page.Entries, ActivityEntry{
+			UserID:     u.UserID,
+			ScreenName: u.ScreenName,
+			Image:      u.Image,
+			StageNo:    st.StageNo,
+			ClearDate:  su.ClearDate,
+		})
+	}
+	return page, nil
+}
+
+// groupActivities groups clears by user, ordering users by their most recent clear in entries
+func groupActivities(entries []ActivityEntry) []ActivityUser {
+	activityMap := make(map[string]*ActivityUser)
+	var order []string
+	for _, e := range entries {
+		if _, ok := activityMap[e.UserID]; !ok {
+			activityMap[e.UserID] = &ActivityUser{
+				UserID:     e.UserID,
+				ScreenName: e.ScreenName,
+				Image:      e.Image,
 			}
-			order = append(order, u.UserID)
+			order = append(order, e.UserID)
 		}
-		activityMap[u.UserID].ClearedStages = append(
-			activityMap[u.UserID].ClearedStages,
-			ActivityStage{StageNo: st.StageNo, ClearDate: su.ClearDate},
+		activityMap[e.UserID].ClearedStages = append(
+			activityMap[e.UserID].ClearedStages,
+			ActivityStage{StageNo: e.StageNo, ClearDate: e.ClearDate},
 		)
 	}
 
@@ -273,7 +723,7 @@ func (s *Service) GetActivities(ctx context.Context, limit int) ([]ActivityUser,
 	for _, id := range order {
 		result = append(result, *activityMap[id])
 	}
-	return result, nil
+	return result
 }
 
 func uniqueKeys(keys []*datastore.Key) ([]*datastore.Key, map[string]int) {
@@ -299,7 +749,7 @@ func (s *Service) DeleteAccount(ctx context.Context, userUID string) error {
 		return err
 	}
 
-	err = s.firebaseService.DeleteUser(ctx, userUID)
+	err = s.tokenVerifier.DeleteUser(ctx, userUID)
 	if err != nil {
 		// Don't fail the entire operation since Datastore deletion succeeded
 		// TODO: Add error log for Firebase Auth deletion failure (for manual cleanup)
@@ -307,3 +757,28 @@ func (s *Service) DeleteAccount(ctx context.Context, userUID string) error {
 
 	return nil
 }
+
+// LinkAccount merges the account identified by linkToken into the user's account.
+// The merged account is deleted from the identity provider as well, so that its sign-in credential
+// can afterwards be linked to the user's account on the client.
+func (s *Service) LinkAccount(ctx context.Context, userUID, linkToken string) (*datastoreservice.User, int, error) {
+	token, err := s.tokenVerifier.VerifyIDToken(ctx, linkToken)
+	if err != nil {
+		return nil, 0, ErrInvalidLinkToken
+	}
+	if token.UID == userUID {
+		return nil, 0, ErrSameAccount
+	}
+
+	user, merged, err := s.datastoreService.MergeUsers(ctx, token.UID, userUID)
+	if err != nil {
+		return nil, merged, err
+	}
+
+	if err := s.tokenVerifier.DeleteUser(ctx, token.UID); err != nil {
+		// The data is already merged; the leftover identity account can be removed manually
+		fmt.Printf("Warning: failed to delete linked account %s from identity provider: %v\n", token.UID, err)
+	}
+
+	return user, merged, nil
+}
@@ -1,9 +1,26 @@
 package stage
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"cloud.google.com/go/datastore"
+	datastoreservice "kyouen-server/internal/datastore"
+	"kyouen-server/internal/generated/openapi"
+	"kyouen-server/pkg/models"
+
+	"github.com/gin-gonic/gin"
 )
 
 func makeKey(kind string, id int64) *datastore.Key {
@@ -57,3 +74,529 @@ func TestUniqueKeys_OrderPreserved(t *testing.T) {
 		t.Errorf("Expected order [k3, k1, k2], got [%d, %d, %d]", unique[0].ID, unique[1].ID, unique[2].ID)
 	}
 }
+
+func TestNormalizeClientClears(t *testing.T) {
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	earlier := now.Add(-48 * time.Hour)
+	later := now.Add(-24 * time.Hour)
+
+	clears, failures := normalizeClientClears([]openapi.ClearedStage{
+		{StageNo: 3, ClearDate: later},
+		{StageNo: 1, ClearDate: now.Add(time.Hour)},
+		{StageNo: 3, ClearDate: earlier},
+		{StageNo: 0, ClearDate: earlier},
+		{StageNo: 2},
+	}, now)
+
+	if len(failures) != 1 || failures[0].StageNo != 0 || failures[0].Reason != SyncFailureInvalidStageNo {
+		t.Errorf("Expected stage 0 to fail as invalid, got %+v", failures)
+	}
+	if len(clears) != 3 {
+		t.Fatalf("Expected 3 clears, got %d", len(clears))
+	}
+
+	// The earliest clear date of a duplicated stage is kept, in the order stages were first sent
+	if clears[0].StageNo != 3 || !clears[0].ClearDate.Equal(earlier) {
+		t.Errorf("Expected stage 3 cleared at %v, got %+v", earlier, clears[0])
+	}
+	// Future and missing dates are replaced with now
+	if clears[1].StageNo != 1 || !clears[1].ClearDate.Equal(now) {
+		t.Errorf("Expected stage 1 cleared at %v, got %+v", now, clears[1])
+	}
+	if clears[2].StageNo != 2 || !clears[2].ClearDate.Equal(now) {
+		t.Errorf("Expected stage 2 cleared at %v, got %+v", now, clears[2])
+	}
+}
+
+func TestComputeStageStats(t *testing.T) {
+	stageUsers := []datastoreservice.StageUser{
+		{UserKey: makeKey("User", 1), SolveTimeMs: 30000, BestSolveTimeMs: 12000, Attempts: 2, Shape: datastoreservice.ShapeCircle},
+		{UserKey: makeKey("User", 2), SolveTimeMs: 10000, BestSolveTimeMs: 10000, Attempts: 1, HintsUsed: 1, Shape: datastoreservice.ShapeLine},
+		{UserKey: makeKey("User", 3), SolveTimeMs: 50000, BestSolveTimeMs: 50000, Attempts: 3, Shape: datastoreservice.ShapeCircle},
+		{UserKey: makeKey("User", 4), SolveTimeMs: 20000, BestSolveTimeMs: 20000, Shape: datastoreservice.ShapeCircle},
+		{UserKey: makeKey("User", 5)}, // legacy clear without details
+	}
+
+	stats, fastest := computeStageStats(stageUsers, 2)
+
+	if stats.ClearCount != 5 || stats.SolveTimeSamples != 4 {
+		t.Errorf("Expected 5 clears and 4 samples, got %d and %d", stats.ClearCount, stats.SolveTimeSamples)
+	}
+	if stats.MedianSolveTimeMs != 25000 {
+		t.Errorf("Expected median 25000ms, got %d", stats.MedianSolveTimeMs)
+	}
+	if stats.AverageAttempts != 2 {
+		t.Errorf("Expected 2 average attempts, got %f", stats.AverageAttempts)
+	}
+	if stats.HintUsageRate != 0.25 {
+		t.Errorf("Expected hint usage rate 0.25, got %f", stats.HintUsageRate)
+	}
+	if stats.LineClears != 1 || stats.CircleClears != 3 {
+		t.Errorf("Expected 1 line and 3 circle clears, got %d and %d", stats.LineClears, stats.CircleClears)
+	}
+	if len(fastest) != 2 || fastest[0].UserKey.ID != 2 || fastest[1].UserKey.ID != 1 {
+		t.Errorf("Expected fastest solvers [2, 1], got %+v", fastest)
+	}
+}
+
+func TestMinPlausibleSolveTimeMs(t *testing.T) {
+	policy := AntiCheatPolicy{MinSolveTimeMs: 1000, SolveTimeSamples: 20, MedianDivisor: 10}
+
+	tests := []struct {
+		name  string
+		stats StageStats
+		want  int64
+	}{
+		{"no history", StageStats{}, 1000},
+		{"too few samples", StageStats{SolveTimeSamples: 19, MedianSolveTimeMs: 60000}, 1000},
+		{"median raises the floor", StageStats{SolveTimeSamples: 20, MedianSolveTimeMs: 60000}, 6000},
+		{"floor is never lowered", StageStats{SolveTimeSamples: 50, MedianSolveTimeMs: 5000}, 1000},
+	}
+
+	for _, tt := range tests {
+		if got := minPlausibleSolveTimeMs(&tt.stats, policy); got != tt.want {
+			t.Errorf("%s: expected %d, got %d", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestClearRateErrorIsErrClearRateExceeded(t *testing.T) {
+	var err error = &ClearRateError{RetryAfter: time.Minute}
+	if !errors.Is(err, ErrClearRateExceeded) {
+		t.Errorf("ClearRateError must match ErrClearRateExceeded")
+	}
+}
+
+func TestDailySelectionDate(t *testing.T) {
+	tests := []struct {
+		name string
+		now  time.Time
+		want string
+	}{
+		{"scheduled at midnight JST", time.Date(2026, 1, 1, 15, 0, 0, 0, time.UTC), "2026-01-02"},
+		{"scheduler fires early", time.Date(2026, 1, 1, 14, 50, 0, 0, time.UTC), "2026-01-02"},
+		{"before the margin", time.Date(2026, 1, 1, 14, 44, 0, 0, time.UTC), "2026-01-01"},
+		{"rerun during the day", time.Date(2026, 1, 2, 3, 0, 0, 0, time.UTC), "2026-01-02"},
+	}
+	for _, tt := range tests {
+		if got := DailySelectionDate(tt.now); got != tt.want {
+			t.Errorf("%s: DailySelectionDate(%v) = %s, want %s", tt.name, tt.now, got, tt.want)
+		}
+	}
+
+	// The day served by GET /v2/daily rolls over at midnight JST, not at midnight UTC
+	if got := DailyChallengeDate(time.Date(2026, 1, 1, 14, 59, 59, 0, time.UTC)); got != "2026-01-01" {
+		t.Errorf("DailyChallengeDate before midnight JST = %s", got)
+	}
+	if got := DailyChallengeDate(time.Date(2026, 1, 1, 15, 0, 0, 0, time.UTC)); got != "2026-01-02" {
+		t.Errorf("DailyChallengeDate at midnight JST = %s", got)
+	}
+}
+
+func TestSelectDailyStage(t *testing.T) {
+	candidates := []dailyCandidate{{key: "1", clears: 100}, {key: "2", clears: 0}, {key: "3", clears: 5}}
+
+	first, ok := selectDailyStage("2026-01-01", candidates, nil)
+	if !ok {
+		t.Fatalf("a stage must be selected")
+	}
+	reordered := []dailyCandidate{candidates[2], candidates[0], candidates[1]}
+	if again, _ := selectDailyStage("2026-01-01", reordered, nil); again != first {
+		t.Errorf("selection must not depend on candidate order: %s != %s", again, first)
+	}
+
+	recent := map[string]bool{"1": true, "2": true}
+	if selected, _ := selectDailyStage("2026-01-01", candidates, recent); selected != "3" {
+		t.Errorf("recently picked stages must be skipped, got %s", selected)
+	}
+	all := map[string]bool{"1": true, "2": true, "3": true}
+	if _, ok := selectDailyStage("2026-01-01", candidates, all); !ok {
+		t.Errorf("a stage must be selected even if all were picked recently")
+	}
+	if _, ok := selectDailyStage("2026-01-01", nil, nil); ok {
+		t.Errorf("no stage can be selected without candidates")
+	}
+
+	// Unplayed stages are favoured
+	picks := map[string]int{}
+	for day := 1; day <= 200; day++ {
+		date := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, day).Format(DailyChallengeDateLayout)
+		selected, _ := selectDailyStage(date, candidates, nil)
+		picks[selected]++
+	}
+	if picks["2"] <= picks["3"] || picks["3"] <= picks["1"] {
+		t.Errorf("stages with fewer clears must be picked more often: %v", picks)
+	}
+}
+
+func TestRankDailyClears(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, dailyChallengeZone)
+	end := start.AddDate(0, 0, 1)
+	stageUsers := []datastoreservice.StageUser{
+		{UserKey: makeKey("User", 1), ClearDate: start.Add(time.Hour), BestSolveTimeMs: 0},
+		{UserKey: makeKey("User", 2), ClearDate: start.Add(2 * time.Hour), BestSolveTimeMs: 20000},
+		{UserKey: makeKey("User", 3), ClearDate: start.Add(3 * time.Hour), BestSolveTimeMs: 10000},
+		{UserKey: makeKey("User", 4), ClearDate: start.Add(-time.Hour), BestSolveTimeMs: 5000},
+		{UserKey: makeKey("User", 5), ClearDate: start.AddDate(0, 0, -3), LastClearDate: start.Add(4 * time.Hour), BestSolveTimeMs: 15000},
+		{UserKey: makeKey("User", 6), ClearDate: end, BestSolveTimeMs: 1000},
+	}
+
+	ranked := rankDailyClears(stageUsers, start, end)
+
+	var ids []int64
+	for _, su := range ranked {
+		ids = append(ids, su.UserKey.ID)
+	}
+	// User 5 first cleared the stage before the day, so a re-clear on the day does not count
+	expected := []int64{3, 2, 1}
+	if !reflect.DeepEqual(ids, expected) {
+		t.Errorf("Expected ranking %v, got %v", expected, ids)
+	}
+}
+
+func TestEvaluateAchievements(t *testing.T) {
+	base := time.Date(2026, 1, 1, 12, 0, 0, 0, dailyChallengeZone)
+	var clears []achievementClear
+	// Seven consecutive days of clears of size 6 stages; the first is someone else's stage cleared 30 minutes after creation
+	for i := 0; i < 7; i++ {
+		clears = append(clears, achievementClear{
+			StageSize:       6,
+			StageCreator:    "other",
+			StageRegistDate: base.AddDate(0, 0, -10),
+			FirstClear:      base.AddDate(0, 0, i),
+		})
+	}
+	clears[0].StageRegistDate = base.Add(-30 * time.Minute)
+	// Own stage cleared right after creation does not count for early_bird
+	clears = append(clears, achievementClear{StageSize: 9, StageCreator: "me", StageRegistDate: base.AddDate(0, 0, 20), FirstClear: base.AddDate(0, 0, 20)})
+
+	badges := evaluateAchievements(clears, map[int64]int64{6: 7, 9: 2}, "me")
+
+	got := make(map[string]time.Time)
+	for _, b := range badges {
+		got[b.Badge] = b.UnlockedAt
+	}
+	expected := map[string]time.Time{
+		BadgeFirstClear:      base,
+		sizeCompleteBadge(6): base.AddDate(0, 0, 6),
+		BadgeStreak7:         base.AddDate(0, 0, 6),
+		BadgeEarlyBird:       base,
+	}
+	if len(got) != len(expected) {
+		t.Errorf("Expected badges %v, got %v", expected, got)
+	}
+	for badge, at := range expected {
+		if !got[badge].Equal(at) {
+			t.Errorf("Expected %s unlocked at %v, got %v", badge, at, got[badge])
+		}
+	}
+}
+
+func TestComputeStreak(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2026, 1, d, 23, 0, 0, 0, dailyChallengeZone) }
+	clears := []achievementClear{
+		{FirstClear: day(1)},
+		{FirstClear: day(2), LastClear: day(3)},
+		{FirstClear: day(4)},
+		{FirstClear: day(8)},
+		{FirstClear: day(9)},
+	}
+	days := clearDays(clears)
+
+	if streak := computeStreak(days, day(10)); streak != (Streak{Current: 2, Longest: 4}) {
+		t.Errorf("Expected current 2, longest 4 the day after the last clear, got %+v", streak)
+	}
+	if streak := computeStreak(days, day(11)); streak != (Streak{Current: 0, Longest: 4}) {
+		t.Errorf("Expected the current streak to be broken after a day without clears, got %+v", streak)
+	}
+	// 23:00 JST on the 9th is 14:00 UTC on the 9th, so the UTC day does not matter
+	if streak := computeStreak(days, day(9).Add(2*time.Hour)); streak.Current != 2 {
+		t.Errorf("Expected days to roll over at midnight JST, got %+v", streak)
+	}
+}
+
+func TestValidateCollection(t *testing.T) {
+	valid := CollectionParam{Title: "7x7 beginner", StageNos: []int64{3, 1, 2}}
+
+	tests := []struct {
+		name    string
+		id      string
+		param   CollectionParam
+		wantErr bool
+	}{
+		{"valid", "7x7-beginner", valid, false},
+		{"uppercase id", "Beginner", valid, true},
+		{"leading hyphen", "-beginner", valid, true},
+		{"blank title", "lines-only", CollectionParam{Title: "  ", StageNos: []int64{1}}, true},
+		{"no stages", "lines-only", CollectionParam{Title: "Lines only"}, true},
+		{"duplicate stage", "lines-only", CollectionParam{Title: "Lines only", StageNos: []int64{1, 2, 1}}, true},
+		{"invalid stage number", "lines-only", CollectionParam{Title: "Lines only", StageNos: []int64{0}}, true},
+	}
+
+	for _, tt := range tests {
+		err := validateCollection(tt.id, tt.param)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: expected error %v, got %v", tt.name, tt.wantErr, err)
+		}
+		if err != nil && !errors.Is(err, ErrInvalidCollection) {
+			t.Errorf("%s: expected ErrInvalidCollection, got %v", tt.name, err)
+		}
+	}
+}
+
+func TestCollectionProgress(t *testing.T) {
+	collection := datastoreservice.Collection{
+		StageKeys: []*datastore.Key{makeKey("KyouenPuzzle", 1), makeKey("KyouenPuzzle", 2), makeKey("KyouenPuzzle", 3)},
+	}
+	clears := map[string]time.Time{"1": time.Now(), "3": time.Now(), "4": time.Now()}
+
+	progress := collectionProgress(collection, clears)
+	if progress.Cleared != 2 || progress.Total != 3 || progress.Completed() {
+		t.Errorf("Expected 2 of 3 cleared and not completed, got %+v", progress)
+	}
+
+	clears["2"] = time.Now()
+	if progress := collectionProgress(collection, clears); !progress.Completed() {
+		t.Errorf("Expected completed, got %+v", progress)
+	}
+}
+
+func TestGroupActivities(t *testing.T) {
+	now := time.Now()
+	entries := []ActivityEntry{
+		{UserID: "a", ScreenName: "Alice", StageNo: 3, ClearDate: now},
+		{UserID: "b", ScreenName: "Bob", StageNo: 2, ClearDate: now.Add(-time.Minute)},
+		{UserID: "a", ScreenName: "Alice", StageNo: 1, ClearDate: now.Add(-2 * time.Minute)},
+	}
+
+	got := groupActivities(entries)
+	if len(got) != 2 || got[0].UserID != "a" || got[1].UserID != "b" {
+		t.Fatalf("Expected users [a b] in order of their latest clear, got %+v", got)
+	}
+	want := []ActivityStage{{StageNo: 3, ClearDate: now}, {StageNo: 1, ClearDate: now.Add(-2 * time.Minute)}}
+	if !reflect.DeepEqual(got[0].ClearedStages, want) {
+		t.Errorf("Expected %+v, got %+v", want, got[0].ClearedStages)
+	}
+
+	if got := groupActivities(nil); got == nil || len(got) != 0 {
+		t.Errorf("Expected an empty non-nil slice, got %#v", got)
+	}
+}
+
+func TestPackStageCells(t *testing.T) {
+	got, err := packStageCells("012210", 3)
+	if err == nil {
+		t.Errorf("Expected an error for a length that does not match the size, got %v", got)
+	}
+	if _, err := packStageCells("0120", 2); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	got, _ = packStageCells("01202", 0)
+	if got != nil {
+		t.Errorf("Expected nil for size 0, got %v", got)
+	}
+	// 0 1 2 0 | 2 0 0 0 0 -> 0b00011000, 0b10000000, 0b00000000
+	got, err = packStageCells("012020000", 3)
+	if err != nil || !reflect.DeepEqual(got, []byte{0x18, 0x80, 0x00}) {
+		t.Errorf("Expected [18 80 00], got %x, %v", got, err)
+	}
+	if _, err := packStageCells("01x0", 2); err == nil {
+		t.Error("Expected an error for an invalid cell")
+	}
+}
+
+func exportTestStages() []datastoreservice.KyouenPuzzle {
+	registDate := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	return []datastoreservice.KyouenPuzzle{
+		{StageNo: 7, Size: 6, Stage: "000000010010000000000000010010000000", Creator: "noboru", RegistDate: registDate},
+		{StageNo: 9, Size: 2, Stage: "1002", Creator: "ステージ", RegistDate: registDate.Add(time.Hour)},
+	}
+}
+
+func writeExport(t *testing.T, exporter stageExporter, stages []datastoreservice.KyouenPuzzle) string {
+	t.Helper()
+	if err := exporter.begin(); err != nil {
+		t.Fatal(err)
+	}
+	for _, stage := range stages {
+		if err := exporter.write(stage); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sum, err := exporter.end(int64(len(stages)), stages[len(stages)-1].StageNo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sum
+}
+
+func TestNDJSONExporter(t *testing.T) {
+	stages := exportTestStages()
+	var buf bytes.Buffer
+	sum := writeExport(t, newNDJSONExporter(&buf), stages)
+
+	lines := strings.SplitAfter(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != len(stages)+1 {
+		t.Fatalf("Expected %d lines, got %q", len(stages)+1, buf.String())
+	}
+	for i, stage := range stages {
+		var record openapi.StageExportRecord
+		if err := json.Unmarshal([]byte(lines[i]), &record); err != nil {
+			t.Fatal(err)
+		}
+		if record.StageNo != stage.StageNo || record.Stage != stage.Stage || record.Creator != stage.Creator || !record.RegistDate.Equal(stage.RegistDate) {
+			t.Errorf("Expected %+v, got %+v", stage, record)
+		}
+	}
+
+	var trailer openapi.StageExportTrailer
+	if err := json.Unmarshal([]byte(lines[len(stages)]), &trailer); err != nil {
+		t.Fatal(err)
+	}
+	records := sha256.Sum256([]byte(strings.Join(lines[:len(stages)], "")))
+	if trailer.Count != 2 || trailer.LastStageNo != 9 || trailer.Sha256 != sum || sum != hex.EncodeToString(records[:]) {
+		t.Errorf("Unexpected trailer %+v (sum %s)", trailer, sum)
+	}
+}
+
+func TestBinaryExporter(t *testing.T) {
+	stages := exportTestStages()
+	var buf bytes.Buffer
+	sum := writeExport(t, newBinaryExporter(&buf), stages)
+
+	data := buf.Bytes()
+	if string(data[:4]) != binaryExportMagic || data[4] != binaryExportVersion {
+		t.Fatalf("Unexpected header %q", data[:5])
+	}
+	r := bytes.NewReader(data[5:])
+	for _, stage := range stages {
+		if tag, _ := r.ReadByte(); tag != binaryExportTagStage {
+			t.Fatalf("Expected a stage record, got tag %d", tag)
+		}
+		stageNo, _ := binary.ReadUvarint(r)
+		size, _ := r.ReadByte()
+		cells := make([]byte, (int(size)*int(size)+3)/4)
+		r.Read(cells)
+		creatorLen, _ := binary.ReadUvarint(r)
+		creator := make([]byte, creatorLen)
+		r.Read(creator)
+		registDate, _ := binary.ReadVarint(r)
+
+		want, _ := packStageCells(stage.Stage, stage.Size)
+		if int64(stageNo) != stage.StageNo || int64(size) != stage.Size || !bytes.Equal(cells, want) ||
+			string(creator) != stage.Creator || registDate != stage.RegistDate.Unix() {
+			t.Errorf("Expected %+v, got %d %d %x %q %d", stage, stageNo, size, cells, creator, registDate)
+		}
+	}
+
+	trailerAt := len(data) - r.Len()
+	if tag, _ := r.ReadByte(); tag != binaryExportTagEnd {
+		t.Fatalf("Expected the trailer, got tag %d", tag)
+	}
+	count, _ := binary.ReadUvarint(r)
+	lastStageNo, _ := binary.ReadUvarint(r)
+	hashed := make([]byte, sha256.Size)
+	if n, _ := r.Read(hashed); n != sha256.Size || r.Len() != 0 {
+		t.Fatalf("Expected the 32-byte hash to end the export, %d bytes left", r.Len())
+	}
+	want := sha256.Sum256(data[:trailerAt])
+	if count != 2 || lastStageNo != 9 || !bytes.Equal(hashed, want[:]) || sum != hex.EncodeToString(want[:]) {
+		t.Errorf("Unexpected trailer: count %d, last %d, hash %x (sum %s)", count, lastStageNo, hashed, sum)
+	}
+}
+
+func TestRequestStage(t *testing.T) {
+	stage := "000000010000002200002200000000001000"
+	compact, err := models.EncodeCompactStage(6, stage)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		size      int64
+		stage     string
+		compact   string
+		wantSize  int64
+		wantStage string
+		wantErr   error
+	}{
+		{"stage string", 6, stage, "", 6, stage, nil},
+		{"compact only", 0, "", compact, 6, stage, nil},
+		{"compact with matching size and stage", 6, stage, compact, 6, stage, nil},
+		{"compact with another size", 5, "", compact, 0, "", ErrInvalidStageLength},
+		{"compact with another stage", 0, strings.Replace(stage, "2", "1", -1), compact, 0, "", ErrInvalidCompactStage},
+		{"malformed compact", 0, "", compact + "A", 0, "", ErrInvalidCompactStage},
+	}
+	for _, tt := range tests {
+		size, got, err := requestStage(tt.size, tt.stage, tt.compact)
+		if size != tt.wantSize || got != tt.wantStage || err != tt.wantErr {
+			t.Errorf("%s: expected %d %q %v, got %d %q %v", tt.name, tt.wantSize, tt.wantStage, tt.wantErr, size, got, err)
+		}
+	}
+
+	if got := compactStage(6, stage); got != compact {
+		t.Errorf("Expected %q, got %q", compact, got)
+	}
+	if got := compactStage(6, stage+strings.Repeat("0", 45)); got != "" {
+		t.Errorf("Expected no compact encoding for a padded stage, got %q", got)
+	}
+}
+
+func TestProblemOf(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{ErrStageNotFound, 404, "STAGE_NOT_FOUND"},
+		{ErrNoKyouen, 400, "NO_KYOUEN"},
+		{ErrStageExists, 409, "STAGE_EXISTS"},
+		{ErrInvalidStageLength, 400, "INVALID_STAGE_LENGTH"},
+		{&models.StageLengthError{Size: 6, Length: 81}, 400, "INVALID_STAGE_LENGTH"},
+		{&models.StageCharacterError{Index: 3, Character: 'x'}, 400, "INVALID_STAGE_CHARACTER"},
+		{&models.StageSizeError{Size: 2}, 400, "INVALID_STAGE_SIZE"},
+		{&models.StageStonesError{Stones: 61}, 400, "TOO_MANY_STONES"},
+		{&ClearRateError{RetryAfter: time.Minute}, 429, "CLEAR_RATE_EXCEEDED"},
+		{fmt.Errorf("%w: title must be 1-100 characters", ErrInvalidCollection), 400, "INVALID_COLLECTION"},
+		{ErrCollectionNotFound, 404, "COLLECTION_NOT_FOUND"},
+		{ErrInvalidCursor, 400, "INVALID_CURSOR"},
+	}
+	for _, tt := range tests {
+		got, ok := problemOf(tt.err)
+		if !ok || got.Status != tt.status || got.Code != tt.code {
+			t.Errorf("problemOf(%v) = %+v, %v; expected %d %s", tt.err, got, ok, tt.status, tt.code)
+		}
+	}
+
+	if got, ok := problemOf(errors.New("rpc error: deadline exceeded")); ok || got.Status != 500 {
+		t.Errorf("Expected an internal error for an unknown error, got %+v, %v", got, ok)
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	for _, tt := range []struct {
+		err        error
+		status     int
+		body       string
+		retryAfter string
+	}{
+		{&ClearRateError{RetryAfter: 90 * time.Second}, 429, `"code":"CLEAR_RATE_EXCEEDED"`, "90"},
+		{ErrStageNotFound, 404, `"detail":"stage not found"`, ""},
+		{errors.New("datastore: no such entity"), 500, `"code":"INTERNAL_ERROR"`, ""},
+	} {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPut, "/v2/stages/1/clear", nil)
+		writeError(c, tt.err)
+
+		if w.Code != tt.status || !strings.Contains(w.Body.String(), tt.body) || w.Header().Get("Retry-After") != tt.retryAfter {
+			t.Errorf("writeError(%v): got %d %s (Retry-After %q)", tt.err, w.Code, w.Body.String(), w.Header().Get("Retry-After"))
+		}
+		if strings.Contains(w.Body.String(), "datastore") {
+			t.Errorf("Internal errors must not be sent to the client, got %s", w.Body.String())
+		}
+	}
+}
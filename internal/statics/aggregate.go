@@ -0,0 +1,160 @@
+package statics
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/datastore"
+	datastoreservice "kyouen-server/internal/datastore"
+	"kyouen-server/internal/stage"
+)
+
+// rankingLimit is the number of stages and creators kept in each ranking
+const rankingLimit = 10
+
+// aggregator accumulates the statistics of all stages and clears
+type aggregator struct {
+	stages      []datastoreservice.KyouenPuzzle
+	stageNos    map[string]int64 // stage number by StageKeyName
+	clears      map[int64]int64  // clears by stage number
+	players     map[string]bool  // users with a clear, by key
+	days        map[string]*dayAggregate
+	totalClears int64
+}
+
+type dayAggregate struct {
+	clears  int64
+	players map[string]bool
+}
+
+func newAggregator(stages []datastoreservice.KyouenPuzzle, keys []*datastore.Key) *aggregator {
+	a := &aggregator{
+		stages:   stages,
+		stageNos: make(map[string]int64, len(stages)),
+		clears:   make(map[int64]int64, len(stages)),
+		players:  make(map[string]bool),
+		days:     make(map[string]*dayAggregate),
+	}
+	for i, st := range stages {
+		a.stageNos[datastoreservice.StageKeyName(keys[i])] = st.StageNo
+		a.clears[st.StageNo] = 0
+	}
+	return a
+}
+
+// addClear counts a StageUser record. Clears of deleted stages are ignored.
+func (a *aggregator) addClear(su datastoreservice.StageUser) {
+	if su.StageKey == nil || su.UserKey == nil {
+		return
+	}
+	stageNo, ok := a.stageNos[datastoreservice.StageKeyName(su.StageKey)]
+	if !ok {
+		return
+	}
+	user := su.UserKey.String()
+
+	a.totalClears++
+	a.clears[stageNo]++
+	a.players[user] = true
+
+	date := stage.DailyChallengeDate(su.FirstClearDate())
+	day, ok := a.days[date]
+	if !ok {
+		day = &dayAggregate{players: make(map[string]bool)}
+		a.days[date] = day
+	}
+	day.clears++
+	day.players[user] = true
+}
+
+// summary returns the aggregated statistics and the clears of every date with at least one clear, oldest first
+func (a *aggregator) summary(now time.Time) (datastoreservice.StatisticsSummary, []datastoreservice.DailyClearStats) {
+	summary := datastoreservice.StatisticsSummary{
+		StageCount:   int64(len(a.stages)),
+		StagesBySize: []datastoreservice.SizeCount{},
+		TotalClears:  a.totalClears,
+		Players:      int64(len(a.players)),
+		AggregatedAt: now,
+	}
+
+	sizes := make(map[int64]int64)
+	creators := make(map[string]int64)
+	for _, st := range a.stages {
+		sizes[st.Size]++
+		if st.Creator != "" {
+			creators[st.Creator]++
+		}
+	}
+	for size, count := range sizes {
+		summary.StagesBySize = append(summary.StagesBySize, datastoreservice.SizeCount{Size: size, Count: count})
+	}
+	sort.Slice(summary.StagesBySize, func(i, j int) bool {
+		return summary.StagesBySize[i].Size < summary.StagesBySize[j].Size
+	})
+
+	byStage := make([]datastoreservice.StageClearCount, 0, len(a.clears))
+	for stageNo, clears := range a.clears {
+		byStage = append(byStage, datastoreservice.StageClearCount{StageNo: stageNo, Clears: clears})
+	}
+	// Ties go to the older stage in both rankings
+	sort.Slice(byStage, func(i, j int) bool {
+		if byStage[i].Clears != byStage[j].Clears {
+			return byStage[i].Clears > byStage[j].Clears
+		}
+		return byStage[i].StageNo < byStage[j].StageNo
+	})
+	summary.MostCleared = append([]datastoreservice.StageClearCount{}, byStage[:min(rankingLimit, len(byStage))]...)
+	sort.SliceStable(byStage, func(i, j int) bool { return byStage[i].Clears < byStage[j].Clears })
+	summary.LeastCleared = append([]datastoreservice.StageClearCount{}, byStage[:min(rankingLimit, len(byStage))]...)
+
+	summary.TopCreators = make([]datastoreservice.CreatorCount, 0, len(creators))
+	for creator, stages := range creators {
+		summary.TopCreators = append(summary.TopCreators, datastoreservice.CreatorCount{Creator: creator, Stages: stages})
+	}
+	sort.Slice(summary.TopCreators, func(i, j int) bool {
+		if summary.TopCreators[i].Stages != summary.TopCreators[j].Stages {
+			return summary.TopCreators[i].Stages > summary.TopCreators[j].Stages
+		}
+		return summary.TopCreators[i].Creator < summary.TopCreators[j].Creator
+	})
+	summary.TopCreators = summary.TopCreators[:min(rankingLimit, len(summary.TopCreators))]
+
+	days := make([]datastoreservice.DailyClearStats, 0, len(a.days))
+	for date, day := range a.days {
+		days = append(days, datastoreservice.DailyClearStats{Date: date, Clears: day.clears, Players: int64(len(day.players))})
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Date < days[j].Date })
+
+	return summary, days
+}
+
+// AggregateResult is the outcome of a statistics aggregation
+type AggregateResult struct {
+	Summary datastoreservice.StatisticsSummary
+	Days    int // dates with at least one clear
+}
+
+// Aggregate recomputes the statistics from all stages and clears and stores them
+// for GET /v2/statics/extended. It reads every KyouenPuzzle and StageUser entity, so it runs
+// as a scheduled job rather than at request time.
+func Aggregate(ctx context.Context, ds *datastoreservice.DatastoreService, now time.Time) (*AggregateResult, error) {
+	stages, keys, err := ds.GetAllStages(ctx)
+	if err != nil {
+		return nil, err
+	}
+	a := newAggregator(stages, keys)
+	if err := ds.ScanStageUsers(ctx, a.addClear); err != nil {
+		return nil, err
+	}
+
+	summary, days := a.summary(now)
+	// Write the days first so that the summary's aggregatedAt never claims more than what is stored
+	if err := ds.PutDailyClearStats(ctx, days); err != nil {
+		return nil, err
+	}
+	if err := ds.PutStatisticsSummary(ctx, summary); err != nil {
+		return nil, err
+	}
+	return &AggregateResult{Summary: summary, Days: len(days)}, nil
+}
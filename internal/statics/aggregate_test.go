@@ -0,0 +1,65 @@
+package statics
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/datastore"
+	datastoreservice "kyouen-server/internal/datastore"
+)
+
+func TestAggregator(t *testing.T) {
+	stages := []datastoreservice.KyouenPuzzle{
+		{StageNo: 1, Size: 6, Creator: "alice"},
+		{StageNo: 2, Size: 6, Creator: "bob"},
+		{StageNo: 3, Size: 9, Creator: "alice"},
+	}
+	keys := []*datastore.Key{
+		datastore.IDKey("KyouenPuzzle", 1, nil),
+		datastore.IDKey("KyouenPuzzle", 2, nil),
+		datastore.IDKey("KyouenPuzzle", 3, nil),
+	}
+	a := newAggregator(stages, keys)
+
+	u1 := datastore.NameKey("User", "KEYu1", nil)
+	u2 := datastore.NameKey("User", "KEYu2", nil)
+	// 2026-10-18 20:00 UTC is 2026-10-19 in JST
+	day1 := time.Date(2026, 10, 18, 20, 0, 0, 0, time.UTC)
+	day2 := day1.Add(24 * time.Hour)
+	a.addClear(datastoreservice.StageUser{StageKey: keys[1], UserKey: u1, ClearDate: day1})
+	a.addClear(datastoreservice.StageUser{StageKey: keys[1], UserKey: u2, ClearDate: day1})
+	a.addClear(datastoreservice.StageUser{StageKey: keys[0], UserKey: u1, ClearDate: day2})
+	// A clear of a deleted stage is ignored
+	a.addClear(datastoreservice.StageUser{StageKey: datastore.IDKey("KyouenPuzzle", 99, nil), UserKey: u2, ClearDate: day2})
+
+	now := time.Now()
+	summary, days := a.summary(now)
+
+	if summary.StageCount != 3 || summary.TotalClears != 3 || summary.Players != 2 || !summary.AggregatedAt.Equal(now) {
+		t.Errorf("Unexpected totals: %+v", summary)
+	}
+	wantSizes := []datastoreservice.SizeCount{{Size: 6, Count: 2}, {Size: 9, Count: 1}}
+	if !reflect.DeepEqual(summary.StagesBySize, wantSizes) {
+		t.Errorf("Expected stages by size %+v, got %+v", wantSizes, summary.StagesBySize)
+	}
+	wantMost := []datastoreservice.StageClearCount{{StageNo: 2, Clears: 2}, {StageNo: 1, Clears: 1}, {StageNo: 3, Clears: 0}}
+	if !reflect.DeepEqual(summary.MostCleared, wantMost) {
+		t.Errorf("Expected most cleared %+v, got %+v", wantMost, summary.MostCleared)
+	}
+	wantLeast := []datastoreservice.StageClearCount{{StageNo: 3, Clears: 0}, {StageNo: 1, Clears: 1}, {StageNo: 2, Clears: 2}}
+	if !reflect.DeepEqual(summary.LeastCleared, wantLeast) {
+		t.Errorf("Expected least cleared %+v, got %+v", wantLeast, summary.LeastCleared)
+	}
+	wantCreators := []datastoreservice.CreatorCount{{Creator: "alice", Stages: 2}, {Creator: "bob", Stages: 1}}
+	if !reflect.DeepEqual(summary.TopCreators, wantCreators) {
+		t.Errorf("Expected top creators %+v, got %+v", wantCreators, summary.TopCreators)
+	}
+	wantDays := []datastoreservice.DailyClearStats{
+		{Date: "2026-10-19", Clears: 2, Players: 2},
+		{Date: "2026-10-20", Clears: 1, Players: 1},
+	}
+	if !reflect.DeepEqual(days, wantDays) {
+		t.Errorf("Expected days %+v, got %+v", wantDays, days)
+	}
+}
@@ -2,11 +2,25 @@ package statics
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"kyouen-server/internal/datastore"
+	"kyouen-server/internal/generated/openapi"
+	"kyouen-server/internal/problem"
+	"kyouen-server/internal/stage"
 )
 
+const (
+	// defaultStatsDays is the number of days of clears returned when no range is given
+	defaultStatsDays = 30
+	// maxStatsDays bounds the range of clears per day
+	maxStatsDays = 366
+)
+
+// problemStatisticsNotAggregated is returned until the aggregation job has run once
+var problemStatisticsNotAggregated = problem.Type{Status: http.StatusServiceUnavailable, Code: "STATISTICS_NOT_AGGREGATED", Title: "Statistics have not been aggregated yet"}
+
 type Handler struct {
 	datastoreService *datastore.DatastoreService
 }
@@ -20,7 +34,7 @@ func NewHandler(datastoreService *datastore.DatastoreService) *Handler {
 func (h *Handler) GetStatics(c *gin.Context) {
 	summary, err := h.datastoreService.GetSummary(c.Request.Context())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		problem.WriteInternal(c, err)
 		return
 	}
 
@@ -29,3 +43,97 @@ func (h *Handler) GetStatics(c *gin.Context) {
 		"lastUpdatedAt": summary.LastDate,
 	})
 }
+
+// GetExtendedStatics returns the statistics stored by the aggregation job, with the clears per day
+// from the from date to the to date (YYYY-MM-DD, JST, inclusive; the last 30 days by default)
+func (h *Handler) GetExtendedStatics(c *gin.Context) {
+	from, to, ok := statsDateRange(c.Query("from"), c.Query("to"), time.Now())
+	if !ok {
+		problem.Write(c, problem.InvalidRequest, "from and to must be YYYY-MM-DD, from <= to, and at most 366 days apart")
+		return
+	}
+
+	ctx := c.Request.Context()
+	summary, err := h.datastoreService.GetStatisticsSummary(ctx)
+	if err != nil {
+		problem.WriteInternal(c, err)
+		return
+	}
+	if summary == nil {
+		problem.Write(c, problemStatisticsNotAggregated, "")
+		return
+	}
+	days, err := h.datastoreService.GetDailyClearStats(ctx, from.Format(stage.DailyChallengeDateLayout), to.Format(stage.DailyChallengeDateLayout))
+	if err != nil {
+		problem.WriteInternal(c, err)
+		return
+	}
+
+	resp := openapi.ExtendedStatics{
+		StageCount:         summary.StageCount,
+		StagesBySize:       []openapi.StageSizeCount{},
+		TotalClears:        summary.TotalClears,
+		Players:            summary.Players,
+		ClearsPerDay:       clearsPerDay(from, to, days),
+		MostClearedStages:  stageClearCounts(summary.MostCleared),
+		LeastClearedStages: stageClearCounts(summary.LeastCleared),
+		TopCreators:        []openapi.CreatorStageCount{},
+		AggregatedAt:       summary.AggregatedAt,
+	}
+	for _, s := range summary.StagesBySize {
+		resp.StagesBySize = append(resp.StagesBySize, openapi.StageSizeCount{Size: s.Size, Count: s.Count})
+	}
+	for _, cr := range summary.TopCreators {
+		resp.TopCreators = append(resp.TopCreators, openapi.CreatorStageCount{Creator: cr.Creator, Stages: cr.Stages})
+	}
+
+	c.Header("Cache-Control", "public, max-age=60")
+	c.JSON(http.StatusOK, resp)
+}
+
+// statsDateRange parses the from and to dates, defaulting to the last defaultStatsDays days up to today
+func statsDateRange(fromParam, toParam string, now time.Time) (time.Time, time.Time, bool) {
+	to, err := time.Parse(stage.DailyChallengeDateLayout, stage.DailyChallengeDate(now))
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+	if toParam != "" {
+		if to, err = time.Parse(stage.DailyChallengeDateLayout, toParam); err != nil {
+			return time.Time{}, time.Time{}, false
+		}
+	}
+	from := to.AddDate(0, 0, -(defaultStatsDays - 1))
+	if fromParam != "" {
+		if from, err = time.Parse(stage.DailyChallengeDateLayout, fromParam); err != nil {
+			return time.Time{}, time.Time{}, false
+		}
+	}
+	if from.After(to) || to.Sub(from) >= maxStatsDays*24*time.Hour {
+		return time.Time{}, time.Time{}, false
+	}
+	return from, to, true
+}
+
+// clearsPerDay lists every date from from to to, with zero clears for the dates missing in days
+func clearsPerDay(from, to time.Time, days []datastore.DailyClearStats) []openapi.DailyClearCount {
+	byDate := make(map[string]datastore.DailyClearStats, len(days))
+	for _, d := range days {
+		byDate[d.Date] = d
+	}
+
+	result := []openapi.DailyClearCount{}
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		date := day.Format(stage.DailyChallengeDateLayout)
+		d := byDate[date]
+		result = append(result, openapi.DailyClearCount{Date: date, Clears: d.Clears, Players: d.Players})
+	}
+	return result
+}
+
+func stageClearCounts(counts []datastore.StageClearCount) []openapi.StageClearCount {
+	result := make([]openapi.StageClearCount, 0, len(counts))
+	for _, sc := range counts {
+		result = append(result, openapi.StageClearCount{StageNo: sc.StageNo, Clears: sc.Clears})
+	}
+	return result
+}
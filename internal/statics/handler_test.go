@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
@@ -39,4 +40,40 @@ func TestGetStatics(t *testing.T) {
 	// Assert the response
 	assert.Equal(t, http.StatusOK, resp.Code)
 	assert.Contains(t, resp.Body.String(), "count")
-}
\ No newline at end of file
+}
+func TestStatsDateRange(t *testing.T) {
+	// 2026-10-18 20:00 UTC is 2026-10-19 in JST
+	now := time.Date(2026, 10, 18, 20, 0, 0, 0, time.UTC)
+
+	from, to, ok := statsDateRange("", "", now)
+	if !ok || from.Format("2006-01-02") != "2026-09-20" || to.Format("2006-01-02") != "2026-10-19" {
+		t.Errorf("Expected the last 30 days up to 2026-10-19, got %v to %v (ok=%v)", from, to, ok)
+	}
+
+	tests := []struct {
+		from, to string
+		ok       bool
+	}{
+		{"2026-10-01", "2026-10-01", true},
+		{"2025-10-19", "2026-10-19", true},
+		{"2025-10-18", "2026-10-19", false},
+		{"2026-10-02", "2026-10-01", false},
+		{"2026/10/01", "", false},
+	}
+	for _, tt := range tests {
+		if _, _, ok := statsDateRange(tt.from, tt.to, now); ok != tt.ok {
+			t.Errorf("statsDateRange(%q, %q): expected ok=%v, got %v", tt.from, tt.to, tt.ok, ok)
+		}
+	}
+}
+
+func TestClearsPerDay(t *testing.T) {
+	from := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2026, 10, 3, 0, 0, 0, 0, time.UTC)
+	days := []datastore.DailyClearStats{{Date: "2026-10-02", Clears: 5, Players: 3}}
+
+	got := clearsPerDay(from, to, days)
+	if len(got) != 3 || got[0].Clears != 0 || got[1].Date != "2026-10-02" || got[1].Clears != 5 || got[1].Players != 3 || got[2].Date != "2026-10-03" {
+		t.Errorf("Expected 3 days with zero-filled gaps, got %+v", got)
+	}
+}
@@ -22,7 +22,7 @@ func SetupDatastoreTest() *datastore.Client {
 
 func CleanupDatastore(client *datastore.Client) {
 	ctx := context.Background()
-	entities := []string{"KyouenPuzzle", "User", "StageUser", "KyouenPuzzleSummary"}
+	entities := []string{"KyouenPuzzle", "User", "StageUser", "KyouenPuzzleSummary", "CounterShard", "ClearEvent", "Achievement"}
 	
 	for _, entityKind := range entities {
 		query := datastore.NewQuery(entityKind).KeysOnly()
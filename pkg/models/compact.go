@@ -0,0 +1,110 @@
+package models
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// CompactStageVersion is the version of the compact stage encoding written by EncodeCompactStage.
+//
+// Version 1 is base64url without padding of:
+//
+//	byte 0:  version (1)
+//	byte 1:  size
+//	black:   ceil(size²/8) bytes, bit i set if cell i is "1"
+//	white:   ceil(size²/8) bytes, bit i set if cell i is "2"
+//
+// Cells are numbered row-major from the top left, and cell i is bit i%8 (least significant first) of byte i/8.
+// Bits past the last cell must be zero, and a cell must not be set in both bitsets.
+const CompactStageVersion = 1
+
+// Grid sizes accepted for stages.
+const (
+	MinStageSize = 3
+	MaxStageSize = 20
+)
+
+// compactStageHeaderSize is the number of bytes before the bitsets.
+const compactStageHeaderSize = 2
+
+var (
+	// ErrInvalidCompactStage is returned for a compact stage that is not well formed.
+	ErrInvalidCompactStage = errors.New("invalid compact stage")
+	// ErrUnsupportedCompactStageVersion is returned for a compact stage of an unknown version.
+	ErrUnsupportedCompactStageVersion = errors.New("unsupported compact stage version")
+)
+
+var compactStageEncoding = base64.RawURLEncoding.Strict()
+
+// EncodeCompactStage returns the compact encoding of a stage string of size*size cells.
+// An invalid stage fails with the errors of ParseStage other than *StageStonesError.
+func EncodeCompactStage(size int, stage string) (string, error) {
+	if err := checkStage(size, stage); err != nil {
+		return "", err
+	}
+	cells := size * size
+
+	bitsetSize := (cells + 7) / 8
+	b := make([]byte, compactStageHeaderSize+2*bitsetSize)
+	b[0] = CompactStageVersion
+	b[1] = byte(size)
+	black := b[compactStageHeaderSize : compactStageHeaderSize+bitsetSize]
+	white := b[compactStageHeaderSize+bitsetSize:]
+	for i := 0; i < cells; i++ {
+		switch stage[i] {
+		case '1':
+			black[i/8] |= 1 << (i % 8)
+		case '2':
+			white[i/8] |= 1 << (i % 8)
+		}
+	}
+	return compactStageEncoding.EncodeToString(b), nil
+}
+
+// DecodeCompactStage returns the size and stage string of a compact stage.
+// Errors wrap ErrInvalidCompactStage or ErrUnsupportedCompactStageVersion.
+func DecodeCompactStage(encoded string) (int, string, error) {
+	b, err := compactStageEncoding.DecodeString(encoded)
+	if err != nil {
+		return 0, "", fmt.Errorf("%w: %v", ErrInvalidCompactStage, err)
+	}
+	if len(b) < compactStageHeaderSize {
+		return 0, "", fmt.Errorf("%w: missing header", ErrInvalidCompactStage)
+	}
+	if b[0] != CompactStageVersion {
+		return 0, "", fmt.Errorf("%w: %d", ErrUnsupportedCompactStageVersion, b[0])
+	}
+	size := int(b[1])
+	if size < MinStageSize || size > MaxStageSize {
+		return 0, "", fmt.Errorf("%w: size %d is out of range", ErrInvalidCompactStage, size)
+	}
+	cells := size * size
+	bitsetSize := (cells + 7) / 8
+	if len(b) != compactStageHeaderSize+2*bitsetSize {
+		return 0, "", fmt.Errorf("%w: %d bytes for size %d", ErrInvalidCompactStage, len(b), size)
+	}
+
+	black := b[compactStageHeaderSize : compactStageHeaderSize+bitsetSize]
+	white := b[compactStageHeaderSize+bitsetSize:]
+	// Unused bits must be zero so that every stage has exactly one encoding
+	if unused := byte(0xff) << (cells % 8); cells%8 != 0 && (black[bitsetSize-1]|white[bitsetSize-1])&unused != 0 {
+		return 0, "", fmt.Errorf("%w: bits set past the last cell", ErrInvalidCompactStage)
+	}
+	stage := make([]byte, cells)
+	for i := 0; i < cells; i++ {
+		mask := byte(1) << (i % 8)
+		isBlack, isWhite := black[i/8]&mask != 0, white[i/8]&mask != 0
+		switch {
+		case isBlack && isWhite:
+			return 0, "", fmt.Errorf("%w: cell %d is both black and white", ErrInvalidCompactStage, i)
+		case isBlack:
+			stage[i] = '1'
+		case isWhite:
+			stage[i] = '2'
+		default:
+			stage[i] = '0'
+		}
+	}
+	return size, string(stage), nil
+}
@@ -0,0 +1,90 @@
+package models
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCompactStageRoundTrip(t *testing.T) {
+	stageList := []struct {
+		size  int
+		stage string
+	}{
+		{6, "000000010000001100001100000000001000"},
+		{6, "000000010000002200002200000000001000"},
+		{3, "120000021"},
+		{4, "1111222200001212"},
+		{20, strings.Repeat("12", 200)},
+	}
+
+	for _, tt := range stageList {
+		encoded, err := EncodeCompactStage(tt.size, tt.stage)
+		if err != nil {
+			t.Fatalf("%q must be encoded. err = %v", tt.stage, err)
+		}
+		if want := (2 + 2*((tt.size*tt.size+7)/8)) * 4 / 3; len(encoded) > want+1 {
+			t.Errorf("%q must be encoded in about %d characters. actual = %q", tt.stage, want, encoded)
+		}
+		size, stage, err := DecodeCompactStage(encoded)
+		if err != nil || size != tt.size || stage != tt.stage {
+			t.Errorf("%q must be decoded to %d %q. actual = %d %q, %v", encoded, tt.size, tt.stage, size, stage, err)
+		}
+	}
+}
+
+func TestEncodeCompactStage(t *testing.T) {
+	// cells 1, 2 and 9 (bit 1 of the second byte) are set
+	encoded, err := EncodeCompactStage(3, "012000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := base64.RawURLEncoding.EncodeToString([]byte{1, 3, 0x02, 0x00, 0x04, 0x00}); encoded != want {
+		t.Errorf("expected %q. actual = %q", want, encoded)
+	}
+
+	invalid := []struct {
+		size  int
+		stage string
+	}{
+		{6, "000000010000001100001100000000001000" + strings.Repeat("0", 45)},
+		{3, "12000002"},
+		{3, "1200000x1"},
+		{2, "1200"},
+		{21, strings.Repeat("0", 441)},
+	}
+	for _, tt := range invalid {
+		if encoded, err := EncodeCompactStage(tt.size, tt.stage); err == nil {
+			t.Errorf("%d %q must not be encoded. actual = %q", tt.size, tt.stage, encoded)
+		}
+	}
+}
+
+func TestDecodeCompactStage(t *testing.T) {
+	encode := func(b ...byte) string {
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+
+	tests := []struct {
+		name    string
+		encoded string
+		want    error
+	}{
+		{"not base64url", "AQM+AAQA", ErrInvalidCompactStage},
+		{"padded", encode(1, 3, 0, 0, 0, 0) + "==", ErrInvalidCompactStage},
+		{"empty", "", ErrInvalidCompactStage},
+		{"unknown version", encode(2, 3, 0, 0, 0, 0), ErrUnsupportedCompactStageVersion},
+		{"size too small", encode(1, 2, 0, 0), ErrInvalidCompactStage},
+		{"size too large", encode(1, 21), ErrInvalidCompactStage},
+		{"too short", encode(1, 3, 0, 0, 0), ErrInvalidCompactStage},
+		{"too long", encode(1, 3, 0, 0, 0, 0, 0), ErrInvalidCompactStage},
+		{"bits past the last cell", encode(1, 3, 0, 0x02, 0, 0), ErrInvalidCompactStage},
+		{"black and white cell", encode(1, 3, 0x01, 0, 0x01, 0), ErrInvalidCompactStage},
+	}
+	for _, tt := range tests {
+		if size, stage, err := DecodeCompactStage(tt.encoded); !errors.Is(err, tt.want) {
+			t.Errorf("%s: %q must fail with %v. actual = %d %q, %v", tt.name, tt.encoded, tt.want, size, stage, err)
+		}
+	}
+}
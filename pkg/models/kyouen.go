@@ -22,6 +22,7 @@ type KyouenData struct {
 }
 
 // NewKyouenStage create stage by string.
+// It does not check the string; use ParseStage for stages that are not known to be valid.
 func NewKyouenStage(size int, stage string) *KyouenStage {
 	points := []Point{}
 	whitePoints := []Point{}
@@ -74,6 +75,11 @@ func newKyouenData(p1 Point, p2 Point, p3 Point, p4 Point, aIsLine bool, aCenter
 	return &KyouenData{points, aIsLine, aCenter, aRadius, aLine}
 }
 
+// IsLine returns true if kyouen is made by a line, false if it is made by a circle.
+func (k KyouenData) IsLine() bool {
+	return k.lineKyouen
+}
+
 // ToString returns stage as string.
 func (k KyouenStage) ToString() string {
 	result := make([]string, k.size*k.size)
@@ -91,6 +97,11 @@ func (k KyouenStage) ToString() string {
 	return strings.Join(result, "")
 }
 
+// Size returns size of the stage.
+func (k KyouenStage) Size() int {
+	return k.size
+}
+
 // StoneCount returns count of stones.
 func (k KyouenStage) StoneCount() int {
 	return len(k.stonePointList)
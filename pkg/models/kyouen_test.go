@@ -116,6 +116,18 @@ func TestIsKyouenWithLine(t *testing.T) {
 	}
 }
 
+func TestIsKyouenByWhiteIsLine(t *testing.T) {
+	line := NewKyouenStage(6, "000000000000222200000000000000000000").IsKyouenByWhite()
+	if line == nil || !line.IsLine() {
+		t.Errorf("white stones on a row must be line kyouen. actual = %v", line)
+	}
+
+	oval := NewKyouenStage(6, "000000000000002200002200000000000000").IsKyouenByWhite()
+	if oval == nil || oval.IsLine() {
+		t.Errorf("white stones on a square must be oval kyouen. actual = %v", oval)
+	}
+}
+
 func TestSomeKyouen(t *testing.T) {
 	// all stages are kyouen
 	stageList := []string{
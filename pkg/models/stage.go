@@ -0,0 +1,110 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// MaxStageStones is the maximum number of stones ("1" and "2") in a stage.
+// Finding a kyouen checks every 4 stones, so the number of stones bounds the work of HasKyouen.
+const MaxStageStones = 60
+
+// ErrInvalidStage is matched by every error of ParseStage with errors.Is.
+var ErrInvalidStage = errors.New("invalid stage")
+
+// StageSizeError is returned for a size out of MinStageSize..MaxStageSize.
+type StageSizeError struct {
+	Size int
+}
+
+func (e *StageSizeError) Error() string {
+	return fmt.Sprintf("invalid stage: size %d is out of range %d..%d", e.Size, MinStageSize, MaxStageSize)
+}
+
+func (e *StageSizeError) Unwrap() error {
+	return ErrInvalidStage
+}
+
+// StageLengthError is returned for a stage string that is not size*size long,
+// or whose length is not a perfect square when the size is not given (Size is 0).
+type StageLengthError struct {
+	Size   int
+	Length int
+}
+
+func (e *StageLengthError) Error() string {
+	if e.Size == 0 {
+		return fmt.Sprintf("invalid stage: length %d is not a square", e.Length)
+	}
+	return fmt.Sprintf("invalid stage: length %d does not match size %d", e.Length, e.Size)
+}
+
+func (e *StageLengthError) Unwrap() error {
+	return ErrInvalidStage
+}
+
+// StageCharacterError is returned for a character other than "0", "1" and "2".
+type StageCharacterError struct {
+	Index     int
+	Character byte
+}
+
+func (e *StageCharacterError) Error() string {
+	return fmt.Sprintf("invalid stage: invalid character %q at %d", e.Character, e.Index)
+}
+
+func (e *StageCharacterError) Unwrap() error {
+	return ErrInvalidStage
+}
+
+// StageStonesError is returned for a stage with more than MaxStageStones stones.
+type StageStonesError struct {
+	Stones int
+}
+
+func (e *StageStonesError) Error() string {
+	return fmt.Sprintf("invalid stage: %d stones exceed %d", e.Stones, MaxStageStones)
+}
+
+func (e *StageStonesError) Unwrap() error {
+	return ErrInvalidStage
+}
+
+// ParseStage create stage by string, checking that it is well formed.
+// If size is 0, it is taken from the length of the stage, which must be a perfect square.
+// The errors are *StageSizeError, *StageLengthError, *StageCharacterError and *StageStonesError,
+// checked in this order; all of them match ErrInvalidStage.
+func ParseStage(size int, stage string) (*KyouenStage, error) {
+	if size == 0 {
+		size = int(math.Sqrt(float64(len(stage))))
+		if size*size != len(stage) {
+			return nil, &StageLengthError{Length: len(stage)}
+		}
+	}
+	if err := checkStage(size, stage); err != nil {
+		return nil, err
+	}
+
+	k := NewKyouenStage(size, stage)
+	if stones := len(k.stonePointList) + len(k.whiteStonePointList); stones > MaxStageStones {
+		return nil, &StageStonesError{Stones: stones}
+	}
+	return k, nil
+}
+
+// checkStage checks the size, length and characters of a stage string.
+func checkStage(size int, stage string) error {
+	if size < MinStageSize || size > MaxStageSize {
+		return &StageSizeError{Size: size}
+	}
+	if len(stage) != size*size {
+		return &StageLengthError{Size: size, Length: len(stage)}
+	}
+	for i := 0; i < len(stage); i++ {
+		if c := stage[i]; c != '0' && c != '1' && c != '2' {
+			return &StageCharacterError{Index: i, Character: c}
+		}
+	}
+	return nil
+}
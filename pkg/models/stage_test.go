@@ -0,0 +1,81 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseStage(t *testing.T) {
+	stage := "000000010000002200002200000000001000"
+	for _, size := range []int{6, 0} {
+		s, err := ParseStage(size, stage)
+		if err != nil {
+			t.Fatalf("%q must be parsed with size %d. err = %v", stage, size, err)
+		}
+		if s.size != 6 || s.StoneCount() != 2 || len(s.whiteStonePointList) != 4 || s.ToString() != stage {
+			t.Errorf("%q must be parsed with size %d. actual = %+v", stage, size, s)
+		}
+	}
+
+	if _, err := ParseStage(20, strings.Repeat("1", MaxStageStones)+strings.Repeat("0", 400-MaxStageStones)); err != nil {
+		t.Errorf("%d stones must be accepted. err = %v", MaxStageStones, err)
+	}
+}
+
+func TestParseStageErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		size  int
+		stage string
+		check func(err error) bool
+	}{
+		{"zero padded", 6, stageWithPadding(), func(err error) bool {
+			var e *StageLengthError
+			return errors.As(err, &e) && e.Size == 6 && e.Length == 81
+		}},
+		{"short", 6, "00000001", func(err error) bool {
+			var e *StageLengthError
+			return errors.As(err, &e) && e.Length == 8
+		}},
+		{"not a square", 0, "0000000100", func(err error) bool {
+			var e *StageLengthError
+			return errors.As(err, &e) && e.Size == 0 && e.Length == 10
+		}},
+		{"empty", 0, "", func(err error) bool {
+			var e *StageSizeError
+			return errors.As(err, &e) && e.Size == 0
+		}},
+		{"character", 3, "0001a0000", func(err error) bool {
+			var e *StageCharacterError
+			return errors.As(err, &e) && e.Index == 4 && e.Character == 'a'
+		}},
+		{"multibyte character", 3, "00010000あ"[:9], func(err error) bool {
+			var e *StageCharacterError
+			return errors.As(err, &e) && e.Index == 8
+		}},
+		{"size too small", 2, "1111", func(err error) bool {
+			var e *StageSizeError
+			return errors.As(err, &e) && e.Size == 2
+		}},
+		{"size too large", 21, strings.Repeat("0", 441), func(err error) bool {
+			var e *StageSizeError
+			return errors.As(err, &e) && e.Size == 21
+		}},
+		{"too many stones", 20, strings.Repeat("12", 31) + strings.Repeat("0", 338), func(err error) bool {
+			var e *StageStonesError
+			return errors.As(err, &e) && e.Stones == 62
+		}},
+	}
+
+	for _, tt := range tests {
+		s, err := ParseStage(tt.size, tt.stage)
+		if !tt.check(err) || !errors.Is(err, ErrInvalidStage) {
+			t.Errorf("%s: %d %q must fail. actual = %+v, %v", tt.name, tt.size, tt.stage, s, err)
+		}
+	}
+}
+
+func stageWithPadding() string {
+	return "000000010000001100001100000000001000" + strings.Repeat("0", 45)
+}